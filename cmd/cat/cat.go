@@ -0,0 +1,92 @@
+package cat
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type catConfg struct {
+	nfsPath string
+}
+
+// Cat function provides functionaltiy to stream a file from the NFS server to stdout.
+func Cat() *cli.Command {
+	var cc catConfg
+	return &cli.Command{
+		Name:      "cat",
+		Usage:     "The 'cat' command writes a file on the NFS server to stdout, for use in shell pipelines.",
+		UsageText: "ncp cat --host 192.168.0.80 --nfspath logs/app.log | grep ERROR",
+		Flags: append(remote.Flags(),
+			&cli.StringFlag{
+				Destination: &cc.nfsPath,
+				Name:        "nfspath",
+				Aliases:     []string{"p"},
+				Required:    true,
+				Usage:       "Path of the file on the NFS server.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			job, err := helper.NewJob(ctx)
+			if err != nil {
+				return err
+			}
+			if job.Events != nil {
+				return fmt.Errorf("cat writes the file to stdout, --output json can not be used with it")
+			}
+			job.Destination = "stdout"
+			// The data is the output, a summary after it is only shown on request
+			if !ctx.IsSet("progress") {
+				job.Output.Progress = helper.ProgressNone
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			src := remote.Clean(cc.nfsPath)
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			job.Start()
+			fsys, err := remote.Dial(jobCtx, cfg, src)
+			if err != nil {
+				return job.Fail(jobCtx, err)
+			}
+			defer fsys.Close()
+
+			info, err := fsys.Stat(src)
+			if err != nil {
+				return job.Fail(jobCtx, err)
+			}
+			if info.IsDir() {
+				return job.Fail(jobCtx, fmt.Errorf("%s is a folder", src))
+			}
+			size := info.Size
+			if info.Type != remote.TypeFile {
+				size = -1
+			}
+			_, err = job.Transfer(jobCtx, []string{src}, size, func(ctx context.Context, slot int, file string) error {
+				return streamFile(ctx, job, slot, fsys, file, size, os.Stdout)
+			})
+			return err
+		},
+	}
+}
+
+// streamFile copies file to w, hashing it on the way.
+func streamFile(ctx context.Context, job *helper.Job, slot int, fsys remote.FS, file string, size int64, w io.Writer) error {
+	h := sha256.New()
+	progress := job.Progress.File(slot, file, size, file)
+	out := io.MultiWriter(helper.LimitWriter(ctx, helper.ContextWriter(ctx, w), job.Limiter), h, progress)
+	if _, err := fsys.ReadFile(file, 0, out); err != nil {
+		return fmt.Errorf("error reading %s: %w", file, err)
+	}
+	progress.Finish(h.Sum(nil))
+	return nil
+}
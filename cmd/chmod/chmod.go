@@ -0,0 +1,78 @@
+package chmod
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type chmodConfg struct {
+	recursive bool
+	verbose   bool
+}
+
+// ChangeMode function provides functionaltiy to change permissions of files on the NFS server.
+func ChangeMode() *cli.Command {
+	var cc chmodConfg
+	return &cli.Command{
+		Name:      "chmod",
+		Usage:     "The 'chmod' command changes the permissions of files and folders on the NFS server.",
+		UsageText: "ncp chmod --host 192.168.0.80 -R 0750 /data/src/folder",
+		Flags: append(remote.Flags(),
+			&cli.BoolFlag{
+				Destination: &cc.recursive,
+				Name:        "recursive",
+				Aliases:     []string{"R"},
+				Usage:       "Change folders and their contents.",
+			},
+			&cli.BoolFlag{
+				Destination: &cc.verbose,
+				Name:        "verbose",
+				Aliases:     []string{"v"},
+				Usage:       "Print every file changed.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() < 2 {
+				return fmt.Errorf("expected a mode and at least one path")
+			}
+			mode, err := remote.ParseMode(ctx.Args().First())
+			if err != nil {
+				return err
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			paths := ctx.Args().Tail()
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, remote.CommonDir(paths))
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			changed := func(p string) {
+				if cc.verbose {
+					fmt.Printf("mode of %s changed to %04o\n", p, remote.UnixMode(mode))
+				}
+			}
+			failed := false
+			for _, p := range paths {
+				if err := remote.SetAttrAll(fsys, p, remote.Change{Mode: &mode}, cc.recursive, changed); err != nil {
+					fmt.Fprintf(os.Stderr, "chmod: %s: %v\n", p, err)
+					failed = true
+				}
+			}
+			if failed {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
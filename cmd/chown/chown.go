@@ -0,0 +1,110 @@
+package chown
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type chownConfg struct {
+	recursive bool
+	verbose   bool
+}
+
+// ChangeOwner function provides functionaltiy to change the owner of files on the NFS server.
+func ChangeOwner() *cli.Command {
+	var cc chownConfg
+	return &cli.Command{
+		Name:      "chown",
+		Usage:     "The 'chown' command changes the owner and group of files and folders on the NFS server.",
+		UsageText: "ncp chown --host 192.168.0.80 -R 1000:1000 /data/src/folder",
+		Flags: append(remote.Flags(),
+			&cli.BoolFlag{
+				Destination: &cc.recursive,
+				Name:        "recursive",
+				Aliases:     []string{"R"},
+				Usage:       "Change folders and their contents.",
+			},
+			&cli.BoolFlag{
+				Destination: &cc.verbose,
+				Name:        "verbose",
+				Aliases:     []string{"v"},
+				Usage:       "Print every file changed.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() < 2 {
+				return fmt.Errorf("expected an owner and at least one path")
+			}
+			change, err := parseOwner(ctx.Args().First())
+			if err != nil {
+				return err
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			paths := ctx.Args().Tail()
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, remote.CommonDir(paths))
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			changed := func(p string) {
+				if cc.verbose {
+					fmt.Printf("owner of %s changed to %s\n", p, ctx.Args().First())
+				}
+			}
+			failed := false
+			for _, p := range paths {
+				if err := remote.SetAttrAll(fsys, p, change, cc.recursive, changed); err != nil {
+					fmt.Fprintf(os.Stderr, "chown: %s: %v\n", p, err)
+					failed = true
+				}
+			}
+			if failed {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// parseOwner reads numeric ids in the form uid, uid:gid or :gid. The server
+// only sees ids, so names can not be resolved on this side.
+func parseOwner(s string) (remote.Change, error) {
+	var change remote.Change
+	user, group, hasGroup := strings.Cut(s, ":")
+	parse := func(v string) (*uint32, error) {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid owner %q, expected numeric uid:gid", s)
+		}
+		id32 := uint32(id)
+		return &id32, nil
+	}
+	var err error
+	if user != "" {
+		if change.UID, err = parse(user); err != nil {
+			return change, err
+		}
+	}
+	if hasGroup && group != "" {
+		if change.GID, err = parse(group); err != nil {
+			return change, err
+		}
+	}
+	if change.UID == nil && change.GID == nil {
+		return change, fmt.Errorf("invalid owner %q, expected numeric uid:gid", s)
+	}
+	return change, nil
+}
@@ -0,0 +1,58 @@
+package chown
+
+import "testing"
+
+func TestParseOwner(t *testing.T) {
+	id := func(v uint32) *uint32 { return &v }
+	tests := []struct {
+		in       string
+		uid, gid *uint32
+		err      bool
+	}{
+		{in: "1000", uid: id(1000)},
+		{in: "1000:", uid: id(1000)},
+		{in: "1000:100", uid: id(1000), gid: id(100)},
+		{in: ":100", gid: id(100)},
+		{in: "0:0", uid: id(0), gid: id(0)},
+		{in: "4294967295", uid: id(4294967295)},
+		{in: "", err: true},
+		{in: ":", err: true},
+		{in: "root", err: true},
+		{in: "1000:staff", err: true},
+		{in: "-1", err: true},
+		{in: "4294967296", err: true},
+	}
+	for _, tt := range tests {
+		change, err := parseOwner(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseOwner(%q) succeeded, want an error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseOwner(%q): %v", tt.in, err)
+			continue
+		}
+		if !sameID(change.UID, tt.uid) || !sameID(change.GID, tt.gid) {
+			t.Errorf("parseOwner(%q) = uid %v, gid %v, want %v, %v", tt.in, show(change.UID), show(change.GID), show(tt.uid), show(tt.gid))
+		}
+		if change.Mode != nil || change.Size != nil || change.Atime != nil || change.Mtime != nil {
+			t.Errorf("parseOwner(%q) changes more than the owner", tt.in)
+		}
+	}
+}
+
+func sameID(a, b *uint32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func show(id *uint32) interface{} {
+	if id == nil {
+		return "unset"
+	}
+	return *id
+}
@@ -0,0 +1,199 @@
+package cp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kha7iq/ncp/cmd/get"
+	"github.com/kha7iq/ncp/cmd/put"
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+// Copy function provides functionaltiy to copy between local paths and NFS locations given as host:/path or nfs:// URLs, or between two NFS locations.
+func Copy() *cli.Command {
+	return &cli.Command{
+		Name:  "cp",
+		Usage: "The 'cp' command copies files and folders between the local machine and NFS servers named as host:/path or nfs://host:port/path, or from one NFS server to another.",
+		UsageText: "ncp cp src 192.168.0.80:/data\n" +
+			"   ncp cp 'nfs://192.168.0.80/data/src?version=4&uid=1000' ./out/\n" +
+			"   ncp cp a.txt b.txt 192.168.0.80:/data/incoming/\n" +
+			"   ncp cp dist nfs://filer-eu/releases/ nfs://filer-us/releases/\n" +
+			"   ncp --parallel 8 cp --preserve nfs://old/vol/a nfs://new/vol/a\n" +
+			"   ncp cp --server-side nfs://192.168.0.80/data/vm.img nfs://192.168.0.80/backup/",
+		ArgsUsage: "SRC... DST",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "nfs-version",
+				Usage: "NFS version for locations that do not set one: 3, 4, 4.1, 4.2, or auto to try v4 and fall back to v3.",
+				Value: "auto",
+			},
+			&cli.StringFlag{
+				Name:    "port",
+				Aliases: []string{"pr"},
+				Usage:   "NFS v4 server port for locations that do not set one.",
+				Value:   "2049",
+			},
+			&cli.BoolFlag{
+				Name:  "preserve",
+				Usage: "Between two NFS locations, keep the mode, times and, when the server allows it, the owner of files and folders.",
+			},
+			&cli.BoolFlag{
+				Name:  "server-side",
+				Usage: "Ask the server to clone or copy the files, and warn when the copy goes through this machine. Between two NFS locations on one NFS v4.2 server this is tried anyway.",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			args := ctx.Args().Slice()
+			if len(args) < 2 {
+				return fmt.Errorf("expected one or more sources and a destination")
+			}
+			locs := make([]remote.Location, len(args))
+			for i, arg := range args {
+				loc, err := remote.ParseLocation(arg)
+				if err != nil {
+					return err
+				}
+				locs[i] = loc
+			}
+			// Local sources followed by several NFS locations go to all of them
+			if n := trailingRemote(locs); n > 1 && n < len(locs) {
+				return fanOut(ctx, locs[:len(locs)-n], locs[len(locs)-n:])
+			}
+			srcs, dst := locs[:len(locs)-1], locs[len(locs)-1]
+
+			remoteSrcs := 0
+			for _, src := range srcs {
+				if src.Remote() {
+					remoteSrcs++
+				}
+			}
+			switch {
+			case remoteSrcs != 0 && remoteSrcs != len(srcs):
+				return fmt.Errorf("the sources must be either all local or all on NFS servers")
+			case remoteSrcs == 0 && !dst.Remote():
+				return fmt.Errorf("no NFS location given, write it as host:/path or nfs://host/path")
+			case remoteSrcs > 0 && dst.Remote():
+				return relay(ctx, srcs, dst)
+			case dst.Remote():
+				return fanOut(ctx, srcs, []remote.Location{dst})
+			}
+			return download(ctx, srcs, dst)
+		},
+	}
+}
+
+// trailingRemote returns how many of the last locs are NFS locations.
+func trailingRemote(locs []remote.Location) int {
+	n := 0
+	for n < len(locs) && locs[len(locs)-1-n].Remote() {
+		n++
+	}
+	return n
+}
+
+// fanOut uploads the local srcs to every one of dsts in a single pass, see
+// put.FanOut. Like cp, a dst is a folder the sources go into when there are
+// several of them, when it ends with a slash or when it is an existing folder,
+// otherwise a single file is uploaded under the name dst. Folders always go into
+// dst with their own name, like rsync without a trailing slash.
+func fanOut(ctx *cli.Context, srcs, dsts []remote.Location) error {
+	paths := make([]string, len(srcs))
+	for i, src := range srcs {
+		paths[i] = src.Path
+	}
+	targets := make([]put.Target, len(dsts))
+	for i, dst := range dsts {
+		cfg, err := dst.Config(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dst, err)
+		}
+		targets[i] = put.Target{Config: cfg, Path: dst.Path, Dir: dst.Dir}
+	}
+	return put.FanOut(ctx, paths, targets)
+}
+
+// download copies the srcs on NFS servers to the local dst as a single job,
+// with the same rules for dst as fanOut except that a folder source ending with
+// a slash copies what it holds, like rsync.
+func download(ctx *cli.Context, srcs []remote.Location, dst remote.Location) error {
+	sources, err := newSources(ctx, srcs)
+	if err != nil {
+		return err
+	}
+	job, err := helper.NewJob(ctx)
+	if err != nil {
+		return err
+	}
+	job.Source, job.Host = jobSource(sources)
+	job.Destination = dst.Path
+	jobCtx, cancel := helper.JobContext(ctx)
+	defer cancel()
+	job.Start()
+
+	stat, err := os.Stat(dst.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return job.Fail(jobCtx, err)
+	}
+	exists := err == nil
+	into := len(srcs) > 1 || dst.Dir || (exists && stat.IsDir())
+	if exists && !stat.IsDir() && into {
+		return job.Fail(jobCtx, fmt.Errorf("%s is not a folder", dst))
+	}
+	defer closeSources(sources)
+	if err := openSources(jobCtx, job, sources); err != nil {
+		return job.Fail(jobCtx, err)
+	}
+
+	dirs := []string{dst.Path}
+	if !into {
+		dirs[0] = filepath.Dir(dst.Path)
+	}
+	var files []relayFile
+	var total int64
+	for _, s := range sources {
+		f, d, n, err := s.walk(job, s.target(dst.Path, into, filepath.Join), filepath.Join)
+		if err != nil {
+			return job.Fail(jobCtx, fmt.Errorf("%s: %w", s.loc, err))
+		}
+		files, total = append(files, f...), total+n
+		for _, dir := range d {
+			dirs = append(dirs, dir.Path)
+		}
+	}
+	names, byName, err := transferNames(files)
+	if err != nil {
+		return job.Fail(jobCtx, err)
+	}
+	for _, dir := range dirs {
+		if err := mkdirLocal(job, dir); err != nil {
+			return job.Fail(jobCtx, err)
+		}
+	}
+
+	completed, err := job.Transfer(jobCtx, names, total, func(ctx context.Context, slot int, name string) error {
+		f := byName[name]
+		return get.DownloadFile(ctx, job, slot, f.src.fsys[slot], f.info.Path, f.info.Size, f.dst)
+	})
+	if err != nil && jobCtx.Err() != nil {
+		helper.PrintInterrupted(err, completed, len(files))
+	}
+	return err
+}
+
+// mkdirLocal creates the local folder dir with its parents, and records it with
+// the job when it did not exist.
+func mkdirLocal(job *helper.Job, dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	job.DirCreated(dir)
+	return nil
+}
@@ -0,0 +1,241 @@
+package cp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+// A worker holds relayBuffers buffers of relayBufferSize bytes at most, so the
+// reading side can run ahead of the writing side without the memory growing.
+const (
+	relayBuffers    = 8
+	relayBufferSize = 1 << 20
+)
+
+// relayFile is a file copied from a source to its destination, on the local
+// machine or on an NFS server.
+type relayFile struct {
+	src  *source
+	info *remote.FileInfo
+	dst  string
+}
+
+// relay copies the srcs on NFS servers to dst on another, or the same, NFS
+// server as a single job. The data goes from READ on one server straight to
+// WRITE on the other through memory, the versions of the two sides may differ.
+// The dst rules are the ones of download.
+func relay(ctx *cli.Context, srcs []remote.Location, dst remote.Location) error {
+	dstCfg, err := dst.Config(ctx)
+	if err != nil {
+		return err
+	}
+	sources, err := newSources(ctx, srcs)
+	if err != nil {
+		return err
+	}
+	job, err := helper.NewJob(ctx)
+	if err != nil {
+		return err
+	}
+	job.Source, _ = jobSource(sources)
+	job.Host, job.Destination = dstCfg.Host, dst.String()
+	jobCtx, cancel := helper.JobContext(ctx)
+	defer cancel()
+	job.Start()
+
+	defer closeSources(sources)
+	if err := openSources(jobCtx, job, sources); err != nil {
+		return job.Fail(jobCtx, err)
+	}
+	// Every worker gets its own connection to the destination too
+	tos := make([]remote.FS, 0, job.Parallel)
+	for len(tos) < job.Parallel {
+		to, err := remote.Dial(jobCtx, dstCfg, dst.Path)
+		if err != nil {
+			return job.Fail(jobCtx, err)
+		}
+		defer to.Close()
+		tos = append(tos, to)
+	}
+	info, err := tos[0].Stat(dst.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return job.Fail(jobCtx, err)
+	}
+	exists := err == nil
+	into := len(srcs) > 1 || dst.Dir || (exists && info.IsDir())
+	if exists && !info.IsDir() && into {
+		return job.Fail(jobCtx, fmt.Errorf("%s is not a folder", dst))
+	}
+
+	var dirs []*remote.FileInfo
+	var files []relayFile
+	var total int64
+	for _, s := range sources {
+		target := s.target(dst.Path, into, path.Join)
+		if from, to := s.cfg.Abs(s.root.Path), dstCfg.Abs(target); s.cfg.Host == dstCfg.Host && (from == to || strings.HasPrefix(to, from+"/")) {
+			return job.Fail(jobCtx, fmt.Errorf("can not copy %s into itself", s.loc))
+		}
+		f, d, n, err := s.walk(job, target, path.Join)
+		if err != nil {
+			return job.Fail(jobCtx, fmt.Errorf("%s: %w", s.loc, err))
+		}
+		files, dirs, total = append(files, f...), append(dirs, d...), total+n
+	}
+	names, byName, err := transferNames(files)
+	if err != nil {
+		return job.Fail(jobCtx, err)
+	}
+	dir := dst.Path
+	if !into {
+		dir = path.Dir(dst.Path)
+	}
+	if !ctx.Bool("no-space-check") {
+		if err := remote.CheckSpace(jobCtx, dstCfg, dir, total); err != nil {
+			return job.Fail(jobCtx, err)
+		}
+	}
+	if err := remote.MkdirAll(tos[0], dir, 0o755, job.DirCreated); err != nil {
+		return job.Fail(jobCtx, err)
+	}
+	for _, d := range dirs {
+		if err := remote.MkdirAll(tos[0], d.Path, 0o755, job.DirCreated); err != nil {
+			return job.Fail(jobCtx, err)
+		}
+	}
+
+	asked := ctx.Bool("server-side")
+	for _, s := range sources {
+		if s.copiers, err = serverCopiers(jobCtx, asked, s.loc, s.cfg, dstCfg, job.Parallel); err != nil {
+			return job.Fail(jobCtx, err)
+		}
+	}
+
+	preserve := ctx.Bool("preserve")
+	completed, err := job.Transfer(jobCtx, names, total, func(ctx context.Context, slot int, name string) error {
+		f := byName[name]
+		s := f.src
+		var err error
+		if s.copiers != nil {
+			err = serverCopyFile(ctx, job, slot, s.copiers[slot], tos[slot], s.cfg.Abs(f.info.Path), dstCfg.Abs(f.dst), f)
+			if errors.Is(err, remote.ErrNoServerCopy) && asked {
+				s.fallback.Do(func() {
+					fmt.Fprintf(os.Stderr, "cp: %s: %v, copying through this machine\n", s.loc, err)
+				})
+			}
+		}
+		if s.copiers == nil || errors.Is(err, remote.ErrNoServerCopy) {
+			err = relayFileData(ctx, job, slot, s.fsys[slot], tos[slot], f)
+		}
+		if err != nil {
+			return err
+		}
+		if preserve {
+			return setAttrs(tos[slot], f.dst, f.info)
+		}
+		return nil
+	})
+	if err != nil {
+		if jobCtx.Err() != nil {
+			helper.PrintInterrupted(err, completed, len(files))
+		}
+		return err
+	}
+
+	// Folders get their mode and times last, writing the files changed them.
+	// The deepest ones come first so setting a folder does not touch its parent.
+	if preserve {
+		sort.Slice(dirs, func(i, j int) bool { return len(dirs[i].Path) > len(dirs[j].Path) })
+		for _, d := range dirs {
+			if err := setAttrs(tos[0], d.Path, d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// relayFileData streams f from the FS from into the FS to while hashing it. The
+// reading side runs in its own goroutine, so both servers work at the same time.
+// When the job verifies, the copy is read back to compare the sums. A partial
+// copy is removed on failure unless the job keeps partial files.
+func relayFileData(ctx context.Context, job *helper.Job, slot int, from, to remote.FS, f relayFile) (err error) {
+	progress := fileProgress(job, slot, f)
+
+	pr, pw := helper.Pipe(relayBuffers, relayBufferSize)
+	h := sha256.New()
+	readErr := make(chan error, 1)
+	go func() {
+		w := io.MultiWriter(helper.LimitWriter(ctx, helper.ContextWriter(ctx, pw), job.Limiter), h, progress)
+		_, err := from.ReadFile(f.info.Path, 0, w)
+		pw.CloseWithError(err)
+		readErr <- err
+	}()
+	defer func() {
+		if err != nil && !job.KeepPartial {
+			to.Remove(f.dst)
+		}
+	}()
+	_, writeErr := to.WriteFile(f.dst, remote.FileMode, pr)
+	// Stops the reading side when the write failed
+	pr.Close()
+	// A read that stopped because the write failed is not the cause
+	if err := <-readErr; err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		return fmt.Errorf("error reading %s: %w", f.info.Path, err)
+	}
+	if writeErr != nil {
+		return fmt.Errorf("error writing %s: %w", f.dst, writeErr)
+	}
+	expectedSum := h.Sum(nil)
+	if !job.Verify {
+		progress.Finish(expectedSum)
+		return nil
+	}
+
+	h = sha256.New()
+	if _, err := to.ReadFile(f.dst, 0, helper.LimitWriter(ctx, helper.ContextWriter(ctx, h), job.Limiter)); err != nil {
+		return fmt.Errorf("error reading target file for verification: %w", err)
+	}
+	if actualSum := h.Sum(nil); !bytes.Equal(actualSum, expectedSum) {
+		return fmt.Errorf("verification failed: actual SHA=%x expected SHA=%x", actualSum, expectedSum)
+	}
+	progress.Finish(expectedSum)
+	return nil
+}
+
+// fileProgress registers f with the progress display of the job.
+func fileProgress(job *helper.Job, slot int, f relayFile) *helper.FileProgress {
+	displayName := f.info.Path
+	if job.Truncate {
+		displayName = helper.TruncateFileName(displayName)
+	}
+	return job.Progress.File(slot, f.dst, f.info.Size, displayName)
+}
+
+// setAttrs gives p the mode and times of info. The owner and group are set too
+// when they are numeric, like cp -p the server refusing them is not an error.
+func setAttrs(fsys remote.FS, p string, info *remote.FileInfo) error {
+	mode, atime, mtime := info.Mode, info.Atime, info.Mtime
+	if err := fsys.SetAttr(p, remote.Change{Mode: &mode, Atime: &atime, Mtime: &mtime}); err != nil {
+		return fmt.Errorf("unable to set the mode and times of %s: %w", p, err)
+	}
+	uid, uidErr := strconv.ParseUint(info.Owner, 10, 32)
+	gid, gidErr := strconv.ParseUint(info.Group, 10, 32)
+	if uidErr == nil && gidErr == nil {
+		u, g := uint32(uid), uint32(gid)
+		fsys.SetAttr(p, remote.Change{UID: &u, GID: &g})
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package cp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+)
+
+// serverCopiers returns a server side copier for each of the n workers when src
+// and the destination are on the same server. It returns none when the copy has
+// to go through this machine, and says so when --server-side asked for a server
+// side copy.
+func serverCopiers(ctx context.Context, asked bool, src remote.Location, srcCfg, dstCfg remote.Config, n int) ([]*remote.ServerCopy, error) {
+	if srcCfg.Host != dstCfg.Host || srcCfg.Port != dstCfg.Port {
+		if asked {
+			fmt.Fprintf(os.Stderr, "cp: %s: --server-side needs both locations on one server, copying through this machine\n", src)
+		}
+		return nil, nil
+	}
+	copiers := make([]*remote.ServerCopy, 0, n)
+	for len(copiers) < n {
+		c, err := remote.DialServerCopy(ctx, srcCfg)
+		if err != nil {
+			for _, c := range copiers {
+				c.Close()
+			}
+			switch {
+			case !asked:
+				// The server was only tried, the copy goes on without it
+				return nil, nil
+			case errors.Is(err, remote.ErrNoServerCopy):
+				fmt.Fprintf(os.Stderr, "cp: %s: %v, copying through this machine\n", src, err)
+				return nil, nil
+			}
+			return nil, err
+		}
+		copiers = append(copiers, c)
+	}
+	return copiers, nil
+}
+
+// serverCopyFile has the server copy f, whose server paths are from and to, with
+// c. No data goes through this machine, so the files are not read back even when
+// the job verifies: that would move both of them over the network, twice what a
+// copy through this machine costs. Such files are reported as unverified. It fails with remote.ErrNoServerCopy when the
+// server can not copy f by itself.
+func serverCopyFile(ctx context.Context, job *helper.Job, slot int, c *remote.ServerCopy, dstFS remote.FS, from, to string, f relayFile) (err error) {
+	// CLONE and COPY write into a file that exists
+	if _, err := dstFS.WriteFile(f.dst, remote.FileMode, strings.NewReader("")); err != nil {
+		return fmt.Errorf("error writing %s: %w", f.dst, err)
+	}
+	defer func() {
+		if err != nil && !errors.Is(err, remote.ErrNoServerCopy) && !job.KeepPartial {
+			dstFS.Remove(f.dst)
+		}
+	}()
+	progress := fileProgress(job, slot, f)
+	if err := c.Copy(ctx, from, to, f.info.Size, func(n int64) { progress.Add(int(n)) }); err != nil {
+		if errors.Is(err, remote.ErrNoServerCopy) {
+			return err
+		}
+		return fmt.Errorf("error copying %s on the server: %w", f.info.Path, err)
+	}
+	if job.Verify {
+		return progress.FinishUnverified()
+	}
+	return progress.Finish(nil)
+}
@@ -0,0 +1,148 @@
+package cp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+// source is an NFS location the files of a job are read from. All the sources
+// of a cp run are copied by a single job.
+type source struct {
+	loc remote.Location
+	cfg remote.Config
+	// fsys holds a connection per worker, the NFS v4 client is not safe for
+	// concurrent use
+	fsys []remote.FS
+	root *remote.FileInfo
+	// copiers are the server side copiers of the workers, nil when the files
+	// of the source go through this machine
+	copiers  []*remote.ServerCopy
+	fallback sync.Once
+}
+
+// newSources resolves the server settings of srcs.
+func newSources(ctx *cli.Context, srcs []remote.Location) ([]*source, error) {
+	sources := make([]*source, len(srcs))
+	for i, loc := range srcs {
+		cfg, err := loc.Config(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", loc, err)
+		}
+		sources[i] = &source{loc: loc, cfg: cfg}
+	}
+	return sources, nil
+}
+
+// openSources connects every worker of the job to each of the sources and
+// looks up what they name.
+func openSources(ctx context.Context, job *helper.Job, sources []*source) error {
+	for _, s := range sources {
+		for len(s.fsys) < job.Parallel {
+			fsys, err := remote.Dial(ctx, s.cfg, s.loc.Path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", s.loc, err)
+			}
+			s.fsys = append(s.fsys, fsys)
+		}
+		root, err := s.fsys[0].Stat(s.loc.Path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.loc, err)
+		}
+		s.root = root
+	}
+	return nil
+}
+
+func (s *source) close() {
+	for _, c := range s.copiers {
+		c.Close()
+	}
+	for _, fsys := range s.fsys {
+		fsys.Close()
+	}
+}
+
+func closeSources(sources []*source) {
+	for _, s := range sources {
+		s.close()
+	}
+}
+
+// target returns the path the root of s is copied to with join. A folder goes
+// into dst under its own name unless its contents are asked for, a file does
+// when dst is a folder.
+func (s *source) target(dst string, into bool, join func(...string) string) string {
+	if (into || s.root.IsDir()) && !(s.root.IsDir() && s.loc.Dir) {
+		return join(dst, s.root.Name)
+	}
+	return dst
+}
+
+// walk lists the files of s with their copy below target, along with the
+// folders to create there. Excluded names are skipped, and so are symlinks and
+// other special files, with a warning.
+func (s *source) walk(job *helper.Job, target string, join func(...string) string) (files []relayFile, dirs []*remote.FileInfo, total int64, err error) {
+	root := s.root.Path
+	err = remote.Walk(s.fsys[0], root, func(p string, info *remote.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != root && job.Excluded(info.Name) {
+			if info.IsDir() {
+				return remote.SkipDir
+			}
+			return nil
+		}
+		to := join(target, strings.TrimPrefix(p, root))
+		switch info.Type {
+		case remote.TypeDir:
+			dirs = append(dirs, &remote.FileInfo{Path: to, Mode: info.Mode, Atime: info.Atime, Mtime: info.Mtime, Owner: info.Owner, Group: info.Group})
+		case remote.TypeFile:
+			files = append(files, relayFile{src: s, info: info, dst: to})
+			total += info.Size
+		default:
+			fmt.Fprintf(os.Stderr, "cp: skipping %s, a %s can not be copied\n", p, info.Type)
+		}
+		return nil
+	})
+	return files, dirs, total, err
+}
+
+// transferNames returns the names the job transfers files under, their
+// destination paths, with the file of each. Two sources that would write the
+// same file are an error.
+func transferNames(files []relayFile) ([]string, map[string]relayFile, error) {
+	names := make([]string, len(files))
+	byName := make(map[string]relayFile, len(files))
+	for i, f := range files {
+		if other, ok := byName[f.dst]; ok {
+			return nil, nil, fmt.Errorf("%s:%s and %s:%s would both be copied to %s",
+				other.src.cfg.Host, other.info.Path, f.src.cfg.Host, f.info.Path, f.dst)
+		}
+		names[i], byName[f.dst] = f.dst, f
+	}
+	return names, byName, nil
+}
+
+// jobSource describes the sources of a job for its events and its history,
+// with the hosts they are on.
+func jobSource(sources []*source) (src, hosts string) {
+	names := make([]string, len(sources))
+	var hostList []string
+	seen := map[string]bool{}
+	for i, s := range sources {
+		names[i] = s.loc.String()
+		if !seen[s.cfg.Host] {
+			seen[s.cfg.Host] = true
+			hostList = append(hostList, s.cfg.Host)
+		}
+	}
+	return strings.Join(names, " "), strings.Join(hostList, ",")
+}
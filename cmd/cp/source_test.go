@@ -0,0 +1,54 @@
+package cp
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/kha7iq/ncp/internal/remote"
+)
+
+func TestSourceTarget(t *testing.T) {
+	dir := &remote.FileInfo{Path: "/data/src", Name: "src", Type: remote.TypeDir}
+	file := &remote.FileInfo{Path: "/data/a.txt", Name: "a.txt", Type: remote.TypeFile}
+	tests := []struct {
+		name     string
+		root     *remote.FileInfo
+		contents bool
+		into     bool
+		want     string
+	}{
+		{name: "file", root: file, want: "/backup/b.txt"},
+		{name: "file into folder", root: file, into: true, want: "/backup/b.txt/a.txt"},
+		{name: "folder", root: dir, want: "/backup/b.txt/src"},
+		{name: "folder contents", root: dir, contents: true, into: true, want: "/backup/b.txt"},
+	}
+	for _, tt := range tests {
+		s := &source{loc: remote.Location{Host: "filer", Path: tt.root.Path, Dir: tt.contents}, root: tt.root}
+		if got := s.target("/backup/b.txt", tt.into, path.Join); got != tt.want {
+			t.Errorf("%s: target = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTransferNames(t *testing.T) {
+	eu := &source{cfg: remote.Config{Host: "filer-eu"}}
+	us := &source{cfg: remote.Config{Host: "filer-us"}}
+	files := []relayFile{
+		{src: eu, info: &remote.FileInfo{Path: "/data/a.txt"}, dst: "out/a.txt"},
+		{src: us, info: &remote.FileInfo{Path: "/data/b.txt"}, dst: "out/b.txt"},
+	}
+	names, byName, err := transferNames(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || byName["out/b.txt"].src != us {
+		t.Errorf("names %v, files %v", names, byName)
+	}
+
+	// The same path on two servers goes to the same file
+	files = append(files, relayFile{src: us, info: &remote.FileInfo{Path: "/data/a.txt"}, dst: "out/a.txt"})
+	if _, _, err := transferNames(files); err == nil || !strings.Contains(err.Error(), "filer-us:/data/a.txt") {
+		t.Errorf("duplicate destination: %v", err)
+	}
+}
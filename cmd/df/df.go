@@ -0,0 +1,104 @@
+package df
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type dfConfg struct {
+	human bool
+}
+
+// DiskFree function provides functionaltiy to show the capacity of file systems on the NFS server.
+func DiskFree() *cli.Command {
+	var dc dfConfg
+	return &cli.Command{
+		Name:      "df",
+		Usage:     "The 'df' command shows the total, used and free space and inodes of exports on the NFS server.",
+		UsageText: "ncp df --host 192.168.0.80 --hr /data",
+		Flags: append(remote.Flags(),
+			&cli.BoolFlag{
+				Destination: &dc.human,
+				Name:        "human-readable",
+				Aliases:     []string{"hr"},
+				Usage:       "Print sizes like 1.2 GB.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			paths := ctx.Args().Slice()
+			if len(paths) == 0 {
+				paths = []string{"/"}
+			}
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, remote.CommonDir(paths))
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			var enc *json.Encoder
+			if ctx.String("output") == "json" {
+				enc = json.NewEncoder(os.Stdout)
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+			if enc == nil {
+				fmt.Fprintln(w, "SIZE\tUSED\tAVAIL\tUSE%\tINODES\tIUSED\tIFREE\t\tPATH")
+			}
+			failed := false
+			for _, p := range paths {
+				p = remote.Clean(p)
+				st, err := fsys.StatFS(p)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "df: %s: %v\n", p, err)
+					failed = true
+					continue
+				}
+				if enc != nil {
+					enc.Encode(struct {
+						Path string `json:"path"`
+						*remote.FSStat
+					}{p, st})
+					continue
+				}
+				used := st.TotalBytes - st.FreeBytes
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t\t%s\n",
+					dc.size(st.TotalBytes), dc.size(used), dc.size(st.AvailBytes), percent(used, st.AvailBytes),
+					st.TotalFiles, st.TotalFiles-st.FreeFiles, st.FreeFiles, p)
+			}
+			w.Flush()
+			if failed {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+func (dc *dfConfg) size(n uint64) string {
+	if dc.human {
+		return helper.FormatBytes(int64(n))
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+// percent returns the share of the space the user can have that is used,
+// rounded up like df does, so space reserved for root is not counted as free.
+func percent(used, avail uint64) string {
+	if used+avail == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d%%", (used*100+used+avail-1)/(used+avail))
+}
@@ -0,0 +1,535 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-nfs/nfsv3/nfs"
+	"github.com/go-nfs/nfsv3/nfs/rpc"
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/nfs4x"
+	"github.com/kha7iq/ncp/internal/probe"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type doctorConfg struct {
+	nfsPath string
+}
+
+// Step is the outcome of one check. Cause and Fix explain a failure or a warning.
+type Step struct {
+	Name   string `json:"step"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Cause  string `json:"cause,omitempty"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// Status of a Step.
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+func (s *Step) fail(err error, cause, fix string) {
+	s.Status, s.Detail, s.Cause, s.Fix = StatusFail, err.Error(), cause, fix
+}
+
+// Doctor function provides functionaltiy to find out why a server or a path can not be used.
+func Doctor() *cli.Command {
+	var dc doctorConfg
+	return &cli.Command{
+		Name:      "doctor",
+		Usage:     "The 'doctor' command checks step by step that a path on an NFS server can be reached, read and written, and explains what fails.",
+		UsageText: "ncp --uid 1000 --gid 1000 doctor --host 192.168.0.80 --nfspath /srv/nfs/data",
+		Flags: append(remote.Flags(),
+			&cli.StringFlag{
+				Destination: &dc.nfsPath,
+				Name:        "nfspath",
+				Aliases:     []string{"p"},
+				Required:    true,
+				Usage:       "Path on the NFS server to check, the probe file is written in it or in its folder.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			// The checks find the export themselves, so they work on server paths
+			nfsPath := cfg.Abs(dc.nfsPath)
+			cfg.Root, cfg.Export = "", ""
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+
+			asJSON := ctx.String("output") == "json"
+			if !asJSON {
+				fmt.Printf("Checking %s:%s over NFS v%s as uid %d gid %d\n\n", cfg.Host, nfsPath, cfg.Version, cfg.UID, cfg.GID)
+			}
+			c := &checker{ctx: jobCtx, cfg: cfg, path: nfsPath, print: printStep(asJSON)}
+			defer c.close()
+			c.run("DNS resolution", c.resolve)
+			c.run("portmapper", c.portmapper)
+			c.run("mount protocol", c.mountProtocol)
+			c.run("NFS NULL", c.null)
+			c.run("export access", c.export)
+			c.run("lookup", c.lookup)
+			c.run("access", c.access)
+			c.run("probe file", c.probeFile)
+
+			if !asJSON {
+				switch {
+				case c.failed:
+					fmt.Println("\nsome checks failed, see the cause and fix above")
+				case c.warned:
+					fmt.Println("\nall checks passed with warnings")
+				default:
+					fmt.Println("\nall checks passed")
+				}
+			}
+			if c.failed {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// printStep returns the function that shows each step as soon as it is done,
+// slow steps are usually the ones timing out.
+func printStep(asJSON bool) func(Step) {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		return func(s Step) { enc.Encode(s) }
+	}
+	return func(s Step) {
+		label := s.Status
+		if s.Status == StatusFail {
+			label = "FAIL"
+		}
+		fmt.Println(strings.TrimRight(fmt.Sprintf("%-4s  %-15s %s", label, s.Name, s.Detail), " "))
+		if s.Cause != "" {
+			fmt.Printf("      cause: %s\n", s.Cause)
+		}
+		if s.Fix != "" {
+			fmt.Printf("      fix:   %s\n", s.Fix)
+		}
+	}
+}
+
+// checker runs the steps in order, each one relies on the previous ones so
+// everything after a failure is skipped.
+type checker struct {
+	ctx   context.Context
+	cfg   remote.Config
+	path  string
+	print func(Step)
+
+	failed, warned bool
+	exports        []probe.Export
+	nfsPort        string
+	fsys           remote.FS
+	info           *remote.FileInfo
+	dir            string
+	dirInfo        *remote.FileInfo
+}
+
+func (c *checker) run(name string, check func(s *Step)) {
+	s := Step{Name: name, Status: StatusOK}
+	if c.failed {
+		s.Status = StatusSkip
+	} else {
+		check(&s)
+	}
+	switch s.Status {
+	case StatusFail:
+		c.failed = true
+	case StatusWarn:
+		c.warned = true
+	}
+	c.print(s)
+}
+
+func (c *checker) close() {
+	if c.fsys != nil {
+		c.fsys.Close()
+	}
+}
+
+func (c *checker) v3() bool {
+	return c.cfg.Version == "3"
+}
+
+func (c *checker) resolve(s *Step) {
+	addrs, err := net.DefaultResolver.LookupHost(c.ctx, c.cfg.Host)
+	if err != nil {
+		s.fail(err, "the name of the server does not resolve",
+			"check the spelling of --host and the DNS settings of this machine, or use the IP address of the server")
+		return
+	}
+	s.Detail = strings.Join(addrs, ", ")
+}
+
+func (c *checker) portmapper(s *Step) {
+	programs, err := probe.Programs(c.cfg.Host, c.cfg.IOTimeout)
+	if err != nil {
+		if !c.v3() {
+			s.Status, s.Detail = StatusWarn, err.Error()
+			s.Cause = "the portmapper does not answer, NFS v4 does not need it but 'exports' and NFS v3 do"
+			return
+		}
+		s.fail(err, "tcp port 111 is blocked by a firewall or rpcbind is not running on the server",
+			"start rpcbind on the server and allow tcp/111 and the mountd port, or use --nfs-version 4 which only needs port "+c.cfg.Port)
+		return
+	}
+
+	versions := map[string][]string{}
+	ports := map[string]uint32{}
+	for _, p := range programs {
+		if p.Protocol != "tcp" || (p.Name != "nfs" && p.Name != "mountd") {
+			continue
+		}
+		versions[p.Name] = append(versions[p.Name], strconv.Itoa(int(p.Version)))
+		ports[p.Name] = p.Port
+		if p.Name == "nfs" && p.Version == nfs.Nfs3Vers {
+			c.nfsPort = strconv.Itoa(int(p.Port))
+		}
+	}
+	var found []string
+	for _, name := range []string{"nfs", "mountd"} {
+		if len(versions[name]) > 0 {
+			found = append(found, fmt.Sprintf("%s v%s on port %d", name, strings.Join(versions[name], ","), ports[name]))
+		}
+	}
+	s.Detail = strings.Join(found, ", ")
+	if s.Detail == "" {
+		s.Detail = "no nfs or mountd over tcp registered"
+	}
+	if !c.v3() {
+		return
+	}
+	if c.nfsPort == "" || !contains(versions["mountd"], strconv.Itoa(nfs.MountVers)) {
+		s.fail(errors.New(s.Detail), "the server does not offer NFS v3 and MOUNT v3 over TCP",
+			"enable NFS v3 on the server (vers3=y in the [nfsd] section of nfs.conf), or use --nfs-version 4")
+	}
+}
+
+func (c *checker) mountProtocol(s *Step) {
+	if !c.v3() {
+		s.Status, s.Detail = StatusSkip, "not used by NFS v4"
+		return
+	}
+	exports, err := probe.Exports(c.cfg.Host, c.cfg.IOTimeout)
+	if err != nil {
+		s.fail(err, "mountd does not answer",
+			"make sure nfs-mountd runs on the server and that its port is open in the firewall, pin the port with 'port=' in the [mountd] section of nfs.conf")
+		return
+	}
+	c.exports = exports
+	dirs := make([]string, len(exports))
+	for i, e := range exports {
+		dirs[i] = e.Dir
+	}
+	s.Detail = fmt.Sprintf("%d exports", len(exports))
+	if len(dirs) > 0 {
+		s.Detail += ": " + strings.Join(dirs, ", ")
+	}
+}
+
+func (c *checker) null(s *Step) {
+	port := c.cfg.Port
+	if c.v3() && c.nfsPort != "" {
+		port = c.nfsPort
+	}
+	p, err := probe.DialNull(c.ctx, c.cfg.Host, port, c.cfg.Version, c.cfg.IOTimeout)
+	var rtt time.Duration
+	if err == nil {
+		start := time.Now()
+		err = p.Null()
+		rtt = time.Since(start)
+		p.Close()
+	}
+	if err != nil {
+		s.fail(err, fmt.Sprintf("nothing answers NFS v%s on tcp port %s", c.cfg.Version, port),
+			fmt.Sprintf("check that the NFS server is running with v%s enabled and that the firewall allows tcp/%s", c.cfg.Version, port))
+		return
+	}
+	s.Detail = fmt.Sprintf("port %s answered in %.3f ms", port, float64(rtt)/float64(time.Millisecond))
+}
+
+func (c *checker) export(s *Step) {
+	export := c.path
+	if c.v3() && len(c.exports) > 0 {
+		e := probe.MatchExport(c.exports, c.path)
+		if e == nil {
+			dirs := make([]string, len(c.exports))
+			for i, e := range c.exports {
+				dirs[i] = e.Dir
+			}
+			s.fail(fmt.Errorf("%s is not inside any export", c.path),
+				"the export path is wrong, NFS v3 paths start with the exported directory",
+				fmt.Sprintf("use a path below one of %s, see 'ncp exports %s'", strings.Join(dirs, ", "), c.cfg.Host))
+			return
+		}
+		export = e.Dir
+		groups := strings.Join(e.Groups, ",")
+		if groups == "" {
+			groups = "everyone"
+		}
+		s.Detail = fmt.Sprintf("export %s allowed for %s, ", e.Dir, groups)
+	}
+
+	fsys, err := remote.Dial(c.ctx, c.cfg, c.path)
+	if err == nil && !c.v3() {
+		// Dialing v4 only connects, the root of the pseudo file system is the first access
+		if _, err = fsys.Stat("/"); err != nil {
+			fsys.Close()
+		}
+	}
+	if err != nil {
+		cause, fix := c.exportHint(err, export)
+		s.fail(err, cause, fix)
+		return
+	}
+	c.fsys = fsys
+	s.Detail += "mounted"
+}
+
+func (c *checker) exportHint(err error, export string) (string, string) {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "MNT3ERR_NOENT") || status(err) == nfs4x.ErrNoEnt:
+		return "the exported directory does not exist on the server",
+			fmt.Sprintf("check the export path, see 'ncp exports %s'", c.cfg.Host)
+	case strings.Contains(msg, "MNT3ERR_ACCES") || strings.Contains(msg, "MNT3ERR_PERM") ||
+		status(err) == nfs4x.ErrAccess || status(err) == nfs4x.ErrPerm:
+		if c.v3() && securePort(c.cfg, export) {
+			return "the export requires a privileged source port (the 'secure' option, the default on Linux) and ncp connects from an unprivileged port",
+				"add the 'insecure' option to the export in /etc/exports and run 'exportfs -ra'"
+		}
+		return "the server does not export the path to this client, or it requires a privileged source port (the 'secure' option, the default on Linux)",
+			"allow the address of this machine for the export and add the 'insecure' option in /etc/exports, then run 'exportfs -ra'"
+	case status(err) == nfs4x.ErrWrongSec:
+		return "the export requires a security flavour other than AUTH_SYS, such as Kerberos",
+			"add sec=sys to the export options, ncp only supports AUTH_SYS"
+	}
+	return "the server refused access to the export", "check the export options and the logs of the server"
+}
+
+// securePort reports whether the mount that failed from an unprivileged port
+// succeeds from a privileged one. Binding such a port needs root, so it is only
+// tried when ncp runs as root.
+func securePort(cfg remote.Config, export string) bool {
+	if os.Geteuid() != 0 {
+		return false
+	}
+	err := helper.WithV3Timeout(cfg.IOTimeout, func() error {
+		mount, err := nfs.DialMount(cfg.Host, true)
+		if err != nil {
+			return err
+		}
+		defer mount.Close()
+		name, _ := os.Hostname()
+		t, err := mount.Mount(export, rpc.NewAuthUnix(name, cfg.UID, cfg.GID).Auth())
+		if err != nil {
+			return err
+		}
+		mount.Unmount()
+		return t.Close()
+	})
+	return err == nil
+}
+
+func (c *checker) lookup(s *Step) {
+	info, err := c.fsys.Stat(c.path)
+	if err != nil {
+		switch status(err) {
+		case nfs4x.ErrNoEnt:
+			fix := "check --nfspath, for example with 'ncp ls' on its parent"
+			if !c.v3() {
+				fix += ", NFS v4 paths start at the pseudo root of the server which can differ from the v3 export path"
+			}
+			s.fail(err, "the path does not exist", fix)
+		case nfs4x.ErrAccess, nfs4x.ErrPerm:
+			s.fail(err, fmt.Sprintf("a folder above the path does not let uid %d gid %d search it", c.cfg.UID, c.cfg.GID),
+				"pass --uid and --gid of a user that may open the parent folders, or give them execute permission on the server")
+		default:
+			s.fail(err, "the server could not look up the path", "check the logs of the server")
+		}
+		return
+	}
+	c.info, c.dir, c.dirInfo = info, c.path, info
+	if !info.IsDir() {
+		c.dir = path.Dir(c.path)
+		if c.dirInfo, err = c.fsys.Stat(c.dir); err != nil {
+			c.dirInfo = info
+		}
+	}
+	s.Detail = fmt.Sprintf("%s, mode %04o, owner %s, group %s", info.Type, remote.UnixMode(info.Mode), info.Owner, info.Group)
+}
+
+func (c *checker) access(s *Step) {
+	mask := uint32(remote.AccessRead | remote.AccessModify | remote.AccessExtend)
+	if c.info.IsDir() {
+		mask |= remote.AccessLookup | remote.AccessDelete
+	}
+	granted, err := c.fsys.Access(c.path, mask)
+	if err != nil {
+		s.fail(err, "the server did not answer the ACCESS check", "check the logs of the server")
+		return
+	}
+	var rights []string
+	for _, r := range []struct {
+		bit  uint32
+		name string
+	}{
+		{remote.AccessRead, "read"},
+		{remote.AccessLookup, "lookup"},
+		{remote.AccessModify, "modify"},
+		{remote.AccessExtend, "extend"},
+		{remote.AccessDelete, "delete"},
+	} {
+		if granted&r.bit != 0 {
+			rights = append(rights, r.name)
+		}
+	}
+	if len(rights) == 0 {
+		rights = []string{"nothing"}
+	}
+	s.Detail = fmt.Sprintf("uid %d gid %d may %s", c.cfg.UID, c.cfg.GID, strings.Join(rights, ", "))
+	switch {
+	case granted&remote.AccessRead == 0:
+		cause, fix := c.permission(c.info)
+		s.Status, s.Cause, s.Fix = StatusFail, "the path can not be read: "+cause, fix
+	case granted&(remote.AccessModify|remote.AccessExtend) == 0:
+		cause, fix := c.permission(c.info)
+		s.Status, s.Cause, s.Fix = StatusWarn, "the path is read-only, downloads work but uploads fail: "+cause, fix
+	}
+}
+
+// permission explains why the credentials in use are refused on info.
+func (c *checker) permission(info *remote.FileInfo) (string, string) {
+	if c.cfg.UID == 0 {
+		return "the server maps root to nobody (root_squash, the default)",
+			fmt.Sprintf("pass --uid %s --gid %s to act as the owner, or set no_root_squash on the export", info.Owner, info.Group)
+	}
+	return fmt.Sprintf("mode %04o with owner %s and group %s does not allow uid %d gid %d", remote.UnixMode(info.Mode), info.Owner, info.Group, c.cfg.UID, c.cfg.GID),
+		fmt.Sprintf("pass --uid %s --gid %s to act as the owner, or change the permissions on the server", info.Owner, info.Group)
+}
+
+func (c *checker) probeFile(s *Step) {
+	name := path.Join(c.dir, fmt.Sprintf(".ncp-doctor-%d", os.Getpid()))
+	data := fmt.Sprintf("ncp doctor probe %s\n", time.Now().Format(time.RFC3339Nano))
+	if _, err := c.fsys.WriteFile(name, 0o600, strings.NewReader(data)); err != nil {
+		c.fsys.Remove(name)
+		cause, fix := c.writeHint(err)
+		s.fail(fmt.Errorf("write %s: %w", name, err), cause, fix)
+		return
+	}
+	removed := false
+	defer func() {
+		if !removed {
+			c.fsys.Remove(name)
+		}
+	}()
+
+	var got bytes.Buffer
+	if _, err := c.fsys.ReadFile(name, 0, &got); err != nil {
+		cause, fix := c.permission(c.dirInfo)
+		s.fail(fmt.Errorf("read %s: %w", name, err), "the file was written but can not be read back: "+cause, fix)
+		return
+	}
+	if got.String() != data {
+		s.fail(fmt.Errorf("read %d bytes back from %s, wrote %d", got.Len(), name, len(data)),
+			"the data read back differs from what was written",
+			"check the server and the network for corruption, and any cache or proxy in between")
+		return
+	}
+	info, err := c.fsys.Stat(name)
+	if err != nil {
+		s.fail(fmt.Errorf("stat %s: %w", name, err), "the file was written but its attributes can not be read", "check the logs of the server")
+		return
+	}
+	removed = true
+	if err := c.fsys.Remove(name); err != nil {
+		s.fail(fmt.Errorf("remove %s: %w", name, err), "the file was written but can not be removed",
+			"remove it by hand, and check the sticky bit and the permissions of "+c.dir)
+		return
+	}
+	s.Detail = fmt.Sprintf("created, wrote and read back %d bytes, removed %s", len(data), name)
+
+	if want := strconv.FormatUint(uint64(c.cfg.UID), 10); squashed(info.Owner, want) {
+		s.Status = StatusWarn
+		s.Cause = fmt.Sprintf("the file written as uid %s is owned by %s, the server maps the user (root_squash or all_squash)", want, info.Owner)
+		s.Fix = "pass --uid and --gid of the intended owner, or set no_root_squash and remove all_squash on the export"
+	}
+}
+
+// squashed reports whether a file created by uid ended up with another owner.
+// NFS v4 servers may send names instead of numbers, only a numeric owner or
+// nobody can be compared.
+func squashed(owner, uid string) bool {
+	if owner == uid {
+		return false
+	}
+	if strings.HasPrefix(owner, "nobody") {
+		return true
+	}
+	_, err := strconv.ParseUint(owner, 10, 32)
+	return err == nil
+}
+
+func (c *checker) writeHint(err error) (string, string) {
+	switch status(err) {
+	case nfs4x.ErrAccess, nfs4x.ErrPerm:
+		return c.permission(c.dirInfo)
+	case nfs4x.ErrROFS:
+		return "the export is read-only (the 'ro' option)", "export it with the 'rw' option and run 'exportfs -ra'"
+	case nfs4x.ErrNoSpc:
+		return "the file system is full", "free some space on the server, see 'ncp df'"
+	case nfs4x.ErrDQuot:
+		return fmt.Sprintf("the quota of uid %d is exhausted", c.cfg.UID), "free some space or raise the quota on the server"
+	}
+	return "the server refused to create the file", "check the logs of the server"
+}
+
+// status returns the NFS status of err. NFS v3 and v4 use the same numbers for
+// the errors explained here.
+func status(err error) uint32 {
+	var (
+		e3 *nfs.Error
+		e4 *nfs4x.Error
+	)
+	switch {
+	case errors.As(err, &e4):
+		return e4.Status
+	case errors.As(err, &e3):
+		return e3.ErrorNum
+	case errors.Is(err, os.ErrPermission):
+		return nfs4x.ErrPerm
+	case errors.Is(err, os.ErrNotExist):
+		return nfs4x.ErrNoEnt
+	}
+	return 0
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+package du
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type duConfg struct {
+	summarize bool
+	human     bool
+	depth     int
+	top       int
+}
+
+// Usage is the disk usage of a folder and everything below it.
+type Usage struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Used  int64  `json:"used"`
+	Files int64  `json:"files"`
+	Dirs  int64  `json:"dirs"`
+}
+
+// File is one of the largest files found.
+type File struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Used int64  `json:"used"`
+}
+
+// Report is the result for one path given on the command line.
+type Report struct {
+	Usage
+	Directories []*Usage `json:"directories"`
+	Largest     []File   `json:"largest"`
+}
+
+// DiskUsage function provides functionaltiy to report the space used by folders on the NFS server.
+func DiskUsage() *cli.Command {
+	var dc duConfg
+	return &cli.Command{
+		Name:      "du",
+		Usage:     "The 'du' command reports the size, space used and file count of folders on the NFS server.",
+		UsageText: "ncp du --host 192.168.0.80 --depth 1 --top 20 /data/projects",
+		Flags: append(remote.Flags(),
+			&cli.BoolFlag{
+				Destination: &dc.summarize,
+				Name:        "summarize",
+				Aliases:     []string{"s"},
+				Usage:       "Only print the total of each path, same as --depth 0.",
+			},
+			&cli.BoolFlag{
+				Destination: &dc.human,
+				Name:        "human-readable",
+				Aliases:     []string{"hr"},
+				Usage:       "Print sizes like 1.2 MB. -h shows the help, as for every command.",
+			},
+			&cli.IntFlag{
+				Destination: &dc.depth,
+				Name:        "depth",
+				Aliases:     []string{"d"},
+				Value:       -1,
+				Usage:       "Print folders at most this many levels below the path, -1 prints all.",
+			},
+			&cli.IntFlag{
+				Destination: &dc.top,
+				Name:        "top",
+				Value:       10,
+				Usage:       "Number of largest files to list, 0 turns the list off.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			if dc.summarize {
+				dc.depth = 0
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			paths := ctx.Args().Slice()
+			if len(paths) == 0 {
+				paths = []string{"/"}
+			}
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			// Every walker reads folders over its own connection
+			workers := ctx.Int("parallel")
+			if workers < 1 {
+				workers = 1
+			}
+			fss := make([]remote.FS, 0, workers)
+			for len(fss) < workers {
+				fsys, err := remote.Dial(jobCtx, cfg, remote.CommonDir(paths))
+				if err != nil {
+					return err
+				}
+				defer fsys.Close()
+				fss = append(fss, fsys)
+			}
+
+			var enc *json.Encoder
+			if ctx.String("output") == "json" {
+				enc = json.NewEncoder(os.Stdout)
+			}
+			failed := false
+			for i, p := range paths {
+				report, walkFailed, err := dc.scan(jobCtx, fss, remote.Clean(p))
+				if err != nil {
+					return err
+				}
+				failed = failed || walkFailed
+				if enc != nil {
+					enc.Encode(report)
+					continue
+				}
+				if i > 0 {
+					fmt.Println()
+				}
+				dc.print(report)
+			}
+			if failed {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// scan walks root and adds every entry to the folders above it. Only folders
+// down to the requested depth are kept, so the memory used does not grow with
+// the number of files. It reports whether some folders could not be read.
+func (dc *duConfg) scan(ctx context.Context, fss []remote.FS, root string) (*Report, bool, error) {
+	var (
+		dirs    = map[string]*Usage{}
+		largest = &fileHeap{}
+		// Files with several links are counted once, like du does
+		linked = map[uint64]bool{}
+		failed bool
+		top    *remote.FileInfo
+	)
+	err := remote.WalkParallel(ctx, fss, root, func(p string, info *remote.FileInfo, err error) error {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "du: %s: %v\n", p, err)
+			failed = true
+			return nil
+		}
+		if p == root {
+			top = info
+		}
+		if !info.IsDir() && info.Nlink > 1 {
+			if linked[info.FileID] {
+				return nil
+			}
+			linked[info.FileID] = true
+		}
+		dir := path.Dir(p)
+		if info.IsDir() {
+			dir = p
+			if dc.depth < 0 || remote.Depth(root, p) <= dc.depth {
+				dirs[p] = &Usage{Path: p}
+			}
+		} else if dc.top > 0 && info.Type == remote.TypeFile {
+			heap.Push(largest, File{Path: p, Size: info.Size, Used: info.Used})
+			if largest.Len() > dc.top {
+				heap.Pop(largest)
+			}
+		}
+		for {
+			if u, ok := dirs[dir]; ok {
+				u.Size += info.Size
+				u.Used += info.Used
+				if info.IsDir() {
+					if dir != p {
+						u.Dirs++
+					}
+				} else {
+					u.Files++
+				}
+			}
+			if dir == root || dir == "/" {
+				break
+			}
+			dir = path.Dir(dir)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, failed, err
+	}
+
+	report := &Report{}
+	if u, ok := dirs[root]; ok {
+		report.Usage = *u
+	} else if top != nil {
+		report.Usage = Usage{Path: root, Size: top.Size, Used: top.Used, Files: 1}
+	}
+	for _, u := range dirs {
+		report.Directories = append(report.Directories, u)
+	}
+	sort.Slice(report.Directories, func(i, j int) bool {
+		return report.Directories[i].Path < report.Directories[j].Path
+	})
+	report.Largest = make([]File, largest.Len())
+	for i := len(report.Largest) - 1; i >= 0; i-- {
+		report.Largest[i] = heap.Pop(largest).(File)
+	}
+	return report, failed, nil
+}
+
+func (dc *duConfg) print(r *Report) {
+	size := func(n int64) string {
+		if dc.human {
+			return helper.FormatBytes(n)
+		}
+		return strconv.FormatInt(n, 10)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "SIZE\tUSED\tFILES\tDIRS\t\tPATH")
+	for _, u := range r.Directories {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t\t%s\n", size(u.Size), size(u.Used), u.Files, u.Dirs, u.Path)
+	}
+	if len(r.Directories) == 0 {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t\t%s\n", size(r.Size), size(r.Used), r.Files, r.Dirs, r.Path)
+	}
+	w.Flush()
+	if len(r.Largest) == 0 || len(r.Directories) == 0 {
+		return
+	}
+	fmt.Printf("\nLargest files:\n")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, f := range r.Largest {
+		fmt.Fprintf(w, "%s\t\t%s\n", size(f.Size), f.Path)
+	}
+	w.Flush()
+}
+
+// fileHeap keeps the largest files with the smallest on top, so it is the one
+// dropped when the heap grows past --top.
+type fileHeap []File
+
+func (h fileHeap) Len() int            { return len(h) }
+func (h fileHeap) Less(i, j int) bool  { return h[i].Size < h[j].Size }
+func (h fileHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *fileHeap) Push(x interface{}) { *h = append(*h, x.(File)) }
+func (h *fileHeap) Pop() interface{} {
+	old := *h
+	f := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return f
+}
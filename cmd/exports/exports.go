@@ -0,0 +1,50 @@
+package exports
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kha7iq/ncp/internal/probe"
+	"github.com/urfave/cli/v2"
+)
+
+// ShowExports function provides functionaltiy to list the exports of an NFS server like showmount -e.
+func ShowExports() *cli.Command {
+	return &cli.Command{
+		Name:      "exports",
+		Usage:     "The 'exports' command lists the directories an NFS server exports and who may mount them.",
+		UsageText: "ncp exports 192.168.0.80",
+		ArgsUsage: "HOST",
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 1 {
+				return fmt.Errorf("expected the host of the NFS server")
+			}
+			host := ctx.Args().First()
+			exports, err := probe.Exports(host, ctx.Duration("io-timeout"))
+			if err != nil {
+				return err
+			}
+			if ctx.String("output") == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				for _, e := range exports {
+					enc.Encode(e)
+				}
+				return nil
+			}
+			fmt.Printf("Export list for %s:\n", host)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, e := range exports {
+				groups := strings.Join(e.Groups, ",")
+				if groups == "" {
+					groups = "(everyone)"
+				}
+				fmt.Fprintf(w, "%s\t%s\n", e.Dir, groups)
+			}
+			w.Flush()
+			return nil
+		},
+	}
+}
@@ -0,0 +1,241 @@
+package find
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+// test is a single predicate of the expression, all of them must match.
+type test func(info *remote.FileInfo) bool
+
+type expression struct {
+	tests    []test
+	maxDepth int
+	print0   bool
+}
+
+// FindFiles function provides functionaltiy to search for files on the NFS server.
+func FindFiles() *cli.Command {
+	return &cli.Command{
+		Name:  "find",
+		Usage: "The 'find' command searches folders on the NFS server for files matching name, type, size and age.",
+		UsageText: "ncp find --host 192.168.0.80 /data/src -name '*.log' -type f -size +100M -mtime +30\n\n" +
+			"Connection flags go before the paths, the tests after them like with find(1).\n" +
+			"At least one path is needed, use / to search the whole export:\n" +
+			"   -name GLOB      base name matches the shell pattern\n" +
+			"   -type f|d|l     regular file, folder or symbolic link\n" +
+			"   -size [+-]N     more than, less than or exactly N bytes, K, M, G and T are powers of 1024\n" +
+			"   -mtime [+-]N    modified more than, less than or exactly N days ago\n" +
+			"   -maxdepth N     descend at most N levels below the paths\n" +
+			"   -print0         separate results with NUL instead of newline",
+		ArgsUsage: "path... [test...]",
+		Flags:     remote.Flags(),
+		// Without a path the first test is read as an unknown flag
+		OnUsageError: func(ctx *cli.Context, err error, isSubcommand bool) error {
+			if strings.HasPrefix(err.Error(), "flag provided but not defined") {
+				return fmt.Errorf("%w, tests go after a path such as /", err)
+			}
+			return err
+		},
+		Action: func(ctx *cli.Context) error {
+			paths, args := splitArgs(ctx.Args().Slice())
+			if len(paths) == 0 {
+				return fmt.Errorf("missing path to search, use / for the whole export")
+			}
+			expr, err := parseExpression(args, time.Now())
+			if err != nil {
+				return err
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, remote.CommonDir(paths))
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			var enc *json.Encoder
+			if ctx.String("output") == "json" {
+				enc = json.NewEncoder(os.Stdout)
+			}
+			failed := false
+			for _, root := range paths {
+				root = remote.Clean(root)
+				err := remote.Walk(fsys, root, func(p string, info *remote.FileInfo, err error) error {
+					if err := jobCtx.Err(); err != nil {
+						return err
+					}
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "find: %s: %v\n", p, err)
+						failed = true
+						return nil
+					}
+					if expr.match(info) {
+						expr.print(enc, info)
+					}
+					if info.IsDir() && expr.maxDepth >= 0 && remote.Depth(root, p) >= expr.maxDepth {
+						return remote.SkipDir
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			if failed {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// splitArgs separates the paths from the tests, the first argument starting with
+// a dash begins the expression.
+func splitArgs(args []string) (paths, expr []string) {
+	for i, a := range args {
+		if strings.HasPrefix(a, "-") && a != "-" {
+			return args[:i], args[i:]
+		}
+	}
+	return args, nil
+}
+
+func parseExpression(args []string, now time.Time) (*expression, error) {
+	expr := &expression{maxDepth: -1}
+	for i := 0; i < len(args); i++ {
+		name := args[i]
+		if name == "-print0" {
+			expr.print0 = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, fmt.Errorf("missing argument to %s", name)
+		}
+		i++
+		value := args[i]
+		switch name {
+		case "-name":
+			if _, err := path.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q for -name", value)
+			}
+			expr.tests = append(expr.tests, func(info *remote.FileInfo) bool {
+				ok, _ := path.Match(value, info.Name)
+				return ok
+			})
+		case "-type":
+			typ, ok := map[string]string{
+				"f": remote.TypeFile, "d": remote.TypeDir, "l": remote.TypeSymlink,
+				"b": remote.TypeBlock, "c": remote.TypeChar, "p": remote.TypeFifo, "s": remote.TypeSocket,
+			}[value]
+			if !ok {
+				return nil, fmt.Errorf("invalid type %q for -type, expected f, d or l", value)
+			}
+			expr.tests = append(expr.tests, func(info *remote.FileInfo) bool { return info.Type == typ })
+		case "-size":
+			t, err := sizeTest(value)
+			if err != nil {
+				return nil, err
+			}
+			expr.tests = append(expr.tests, t)
+		case "-mtime":
+			t, err := mtimeTest(value, now)
+			if err != nil {
+				return nil, err
+			}
+			expr.tests = append(expr.tests, t)
+		case "-maxdepth":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid depth %q for -maxdepth", value)
+			}
+			expr.maxDepth = n
+		default:
+			return nil, fmt.Errorf("unknown test %s", name)
+		}
+	}
+	return expr, nil
+}
+
+// compare splits a numeric argument into its sign and value: +N means more than
+// N, -N less than N and N exactly N.
+func compare(s string) (sign byte, value string) {
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		return s[0], s[1:]
+	}
+	return 0, s
+}
+
+func sizeTest(s string) (test, error) {
+	sign, v := compare(s)
+	limit, err := helper.ParseSize(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid size %q for -size", s)
+	}
+	_, unit := helper.SizeUnit(v)
+	n := int64(math.Ceil(float64(limit) / float64(unit)))
+	switch sign {
+	case '+':
+		return func(info *remote.FileInfo) bool { return info.Size > limit }, nil
+	case '-':
+		return func(info *remote.FileInfo) bool { return info.Size < limit }, nil
+	}
+	// Like find, an exact size is compared in whole units rounded up
+	return func(info *remote.FileInfo) bool {
+		return int64(math.Ceil(float64(info.Size)/float64(unit))) == n
+	}, nil
+}
+
+func mtimeTest(s string, now time.Time) (test, error) {
+	sign, v := compare(s)
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid age %q for -mtime", s)
+	}
+	// Ages are counted in whole days, a file modified 36 hours ago is 1 day old
+	days := func(info *remote.FileInfo) int64 {
+		return int64(now.Sub(info.Mtime) / (24 * time.Hour))
+	}
+	switch sign {
+	case '+':
+		return func(info *remote.FileInfo) bool { return days(info) > n }, nil
+	case '-':
+		return func(info *remote.FileInfo) bool { return days(info) < n }, nil
+	}
+	return func(info *remote.FileInfo) bool { return days(info) == n }, nil
+}
+
+func (e *expression) match(info *remote.FileInfo) bool {
+	for _, t := range e.tests {
+		if !t(info) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *expression) print(enc *json.Encoder, info *remote.FileInfo) {
+	switch {
+	case enc != nil:
+		enc.Encode(info)
+	case e.print0:
+		fmt.Printf("%s\x00", info.Path)
+	default:
+		fmt.Println(info.Path)
+	}
+}
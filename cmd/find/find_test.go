@@ -0,0 +1,124 @@
+package find
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kha7iq/ncp/internal/remote"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		args        []string
+		paths, expr []string
+	}{
+		{args: nil},
+		{args: []string{"/data"}, paths: []string{"/data"}},
+		{args: []string{"/a", "/b", "-name", "x"}, paths: []string{"/a", "/b"}, expr: []string{"-name", "x"}},
+		{args: []string{"-type", "f"}, paths: []string{}, expr: []string{"-type", "f"}},
+		// A lone dash is a path, like in find
+		{args: []string{"-", "-print0"}, paths: []string{"-"}, expr: []string{"-print0"}},
+	}
+	for _, tt := range tests {
+		paths, expr := splitArgs(tt.args)
+		if len(paths) == 0 && len(tt.paths) == 0 {
+			paths, tt.paths = nil, nil
+		}
+		if !reflect.DeepEqual(paths, tt.paths) || !reflect.DeepEqual(expr, tt.expr) {
+			t.Errorf("splitArgs(%q) = %q, %q, want %q, %q", tt.args, paths, expr, tt.paths, tt.expr)
+		}
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	file := func(name string, size int64, age time.Duration) *remote.FileInfo {
+		return &remote.FileInfo{Name: name, Path: "/data/" + name, Type: remote.TypeFile, Size: size, Mtime: now.Add(-age)}
+	}
+	day := 24 * time.Hour
+	var (
+		log    = file("app.log", 200<<20, 40*day)
+		small  = file("small.log", 1000, 36*time.Hour)
+		csv    = file("data.csv", 1<<20, 0)
+		folder = &remote.FileInfo{Name: "logs", Path: "/data/logs", Type: remote.TypeDir, Mtime: now}
+		link   = &remote.FileInfo{Name: "current", Path: "/data/current", Type: remote.TypeSymlink, Mtime: now}
+		all    = []*remote.FileInfo{log, small, csv, folder, link}
+	)
+	tests := []struct {
+		args  []string
+		match []*remote.FileInfo
+	}{
+		{args: nil, match: all},
+		{args: []string{"-name", "*.log"}, match: []*remote.FileInfo{log, small}},
+		{args: []string{"-name", "data.???"}, match: []*remote.FileInfo{csv}},
+		{args: []string{"-type", "d"}, match: []*remote.FileInfo{folder}},
+		{args: []string{"-type", "l"}, match: []*remote.FileInfo{link}},
+		{args: []string{"-type", "f", "-size", "+100M"}, match: []*remote.FileInfo{log}},
+		{args: []string{"-type", "f", "-size", "-1k"}, match: []*remote.FileInfo{small}},
+		// An exact size is compared in whole units rounded up, like find
+		{args: []string{"-size", "1M"}, match: []*remote.FileInfo{small, csv}},
+		{args: []string{"-size", "200M"}, match: []*remote.FileInfo{log}},
+		{args: []string{"-size", "1000"}, match: []*remote.FileInfo{small}},
+		{args: []string{"-mtime", "+30"}, match: []*remote.FileInfo{log}},
+		// 36 hours ago is one whole day
+		{args: []string{"-mtime", "1"}, match: []*remote.FileInfo{small}},
+		{args: []string{"-type", "f", "-mtime", "-1"}, match: []*remote.FileInfo{csv}},
+		{args: []string{"-name", "*.log", "-mtime", "-2"}, match: []*remote.FileInfo{small}},
+	}
+	for _, tt := range tests {
+		expr, err := parseExpression(tt.args, now)
+		if err != nil {
+			t.Errorf("parseExpression(%q): %v", tt.args, err)
+			continue
+		}
+		var got []*remote.FileInfo
+		for _, info := range all {
+			if expr.match(info) {
+				got = append(got, info)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.match) {
+			t.Errorf("parseExpression(%q) matches %v, want %v", tt.args, names(got), names(tt.match))
+		}
+	}
+}
+
+func TestParseExpressionOptions(t *testing.T) {
+	expr, err := parseExpression([]string{"-maxdepth", "2", "-print0"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expr.maxDepth != 2 || !expr.print0 || len(expr.tests) != 0 {
+		t.Errorf("parsed maxdepth %d, print0 %v and %d tests", expr.maxDepth, expr.print0, len(expr.tests))
+	}
+	if expr, _ := parseExpression(nil, time.Now()); expr.maxDepth != -1 {
+		t.Errorf("maxdepth defaults to %d, want -1", expr.maxDepth)
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"-name"},
+		{"-name", "["},
+		{"-type", "x"},
+		{"-size", "lots"},
+		{"-size", "10X"},
+		{"-mtime", "yesterday"},
+		{"-mtime", "+-1"},
+		{"-maxdepth", "-1"},
+		{"-newer", "file"},
+	} {
+		if _, err := parseExpression(args, time.Now()); err == nil {
+			t.Errorf("parseExpression(%q) succeeded, want an error", args)
+		}
+	}
+}
+
+func names(infos []*remote.FileInfo) []string {
+	var s []string
+	for _, info := range infos {
+		s = append(s, info.Name)
+	}
+	return s
+}
@@ -0,0 +1,76 @@
+package fsinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+// ShowFSInfo function provides functionaltiy to show the limits the NFS server reports for an export.
+func ShowFSInfo() *cli.Command {
+	return &cli.Command{
+		Name:      "fsinfo",
+		Usage:     "The 'fsinfo' command shows the transfer sizes, maximum file size and name limits of an export.",
+		UsageText: "ncp fsinfo --host 192.168.0.80 /data",
+		Flags:     remote.Flags(),
+		Action: func(ctx *cli.Context) error {
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			p := remote.Clean(ctx.Args().First())
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, p)
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			limits, err := fsys.Limits(p)
+			if err != nil {
+				return err
+			}
+			if ctx.String("output") == "json" {
+				return json.NewEncoder(os.Stdout).Encode(struct {
+					Path    string `json:"path"`
+					Version string `json:"nfs_version"`
+					*remote.Limits
+				}{p, fsys.Version(), limits})
+			}
+			printLimits(p, fsys.Version(), limits)
+			return nil
+		},
+	}
+}
+
+func printLimits(p, version string, l *remote.Limits) {
+	size := func(n uint64) string {
+		if n == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%d (%s)", n, helper.FormatBytes(int64(n)))
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Path:\t%s\n", p)
+	fmt.Fprintf(w, "NFS version:\t%s\n", version)
+	fmt.Fprintf(w, "Read max:\t%s\n", size(l.ReadMax))
+	fmt.Fprintf(w, "Read preferred:\t%s\n", size(l.ReadPref))
+	fmt.Fprintf(w, "Write max:\t%s\n", size(l.WriteMax))
+	fmt.Fprintf(w, "Write preferred:\t%s\n", size(l.WritePref))
+	fmt.Fprintf(w, "Readdir preferred:\t%s\n", size(l.DirPref))
+	fmt.Fprintf(w, "Max file size:\t%s\n", size(l.MaxFileSize))
+	fmt.Fprintf(w, "Name max:\t%d\n", l.NameMax)
+	fmt.Fprintf(w, "Link max:\t%d\n", l.LinkMax)
+	fmt.Fprintf(w, "No truncation:\t%t\n", l.NoTrunc)
+	fmt.Fprintf(w, "Chown restricted:\t%t\n", l.ChownRestricted)
+	fmt.Fprintf(w, "Case insensitive:\t%t\n", l.CaseInsensitive)
+	fmt.Fprintf(w, "Case preserving:\t%t\n", l.CasePreserving)
+	w.Flush()
+}
@@ -0,0 +1,115 @@
+package get
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kha7iq/ncp/cmd/nfs3/from"
+	"github.com/kha7iq/ncp/cmd/nfs4/v4from"
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type getConfg struct {
+	nfsPath string
+}
+
+// Get function provides functionaltiy to download files or folders from the NFS server over the NFS version the server offers.
+func Get() *cli.Command {
+	var gc getConfg
+	return &cli.Command{
+		Name:      "get",
+		Usage:     "The 'get' command copies files or folders from the NFS server to the current folder, or --dest, over NFS v4 or v3.",
+		UsageText: "ncp get --host 192.168.0.80 --nfspath data/src\n   ncp get --host 192.168.0.80 --nfspath data/src/ --dest /scratch/job42",
+		Flags: append(append(remote.Flags(),
+			&cli.StringFlag{
+				Destination: &gc.nfsPath,
+				Name:        "nfspath",
+				Aliases:     []string{"p", "path"},
+				Required:    true,
+				Usage:       "File or folder on the NFS server to copy, a trailing slash copies what the folder holds.",
+			},
+		), helper.LayoutFlags()...),
+		Action: func(ctx *cli.Context) error {
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			return Download(ctx, cfg, gc.nfsPath, helper.NewLayout(ctx, gc.nfsPath))
+		},
+	}
+}
+
+// Alias function provides functionaltiy to keep the older download commands, such as 'from' and 'v4from', as 'get' with the NFS version fixed.
+func Alias(name, version string) *cli.Command {
+	cmd := Get()
+	cmd.Name = name
+	cmd.Usage = fmt.Sprintf("The '%s' command is 'get --nfs-version %s', it copies files or folders from the NFS server to the local machine.", name, version)
+	cmd.UsageText = fmt.Sprintf("ncp %s --host 192.168.0.80 --nfspath data/src", name)
+	remote.PinVersion(cmd, version)
+	return cmd
+}
+
+// Download copies nfsPath, a file or a folder, from the server in cfg to the
+// local paths of layout with the transfer of the NFS version in cfg.
+func Download(ctx *cli.Context, cfg remote.Config, nfsPath string, layout helper.Layout) error {
+	if cfg.Version == "4" {
+		return v4from.Download(ctx, cfg, cfg.Abs(nfsPath), layout)
+	}
+	return from.Download(ctx, cfg, cfg.Abs(nfsPath), layout)
+}
+
+// DownloadFile writes file, read from fsys, to the local targetfile while hashing
+// it. When the job verifies, targetfile is read back to compare the sums. A
+// partial file is removed on failure unless the job keeps partial files.
+func DownloadFile(ctx context.Context, job *helper.Job, slot int, fsys remote.FS, file string, size int64, targetfile string) (err error) {
+	wr, err := os.Create(targetfile)
+	if err != nil {
+		return fmt.Errorf("error opening target file: %w", err)
+	}
+	defer func() {
+		wr.Close()
+		if err != nil && !job.KeepPartial {
+			os.Remove(targetfile)
+		}
+	}()
+
+	displayName := file
+	if job.Truncate {
+		displayName = helper.TruncateFileName(file)
+	}
+	progress := job.Progress.File(slot, file, size, displayName)
+	h := sha256.New()
+	out := io.MultiWriter(helper.LimitWriter(ctx, helper.ContextWriter(ctx, wr), job.Limiter), h, progress)
+	if _, err := fsys.ReadFile(file, 0, out); err != nil {
+		return fmt.Errorf("error reading %s: %w", file, err)
+	}
+	if err := wr.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", targetfile, err)
+	}
+	expectedSum := h.Sum(nil)
+	if !job.Verify {
+		progress.Finish(expectedSum)
+		return nil
+	}
+
+	rdr, err := os.Open(targetfile)
+	if err != nil {
+		return fmt.Errorf("error opening target file for verification: %w", err)
+	}
+	defer rdr.Close()
+	h = sha256.New()
+	if _, err := io.Copy(h, helper.LimitReader(ctx, helper.ContextReader(ctx, rdr), job.Limiter)); err != nil {
+		return fmt.Errorf("error reading target file for verification: %w", err)
+	}
+	if actualSum := h.Sum(nil); !bytes.Equal(actualSum, expectedSum) {
+		return fmt.Errorf("verification failed: actual SHA=%x expected SHA=%x", actualSum, expectedSum)
+	}
+	progress.Finish(expectedSum)
+	return nil
+}
@@ -0,0 +1,119 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/urfave/cli/v2"
+)
+
+type historyConfg struct {
+	limit  int
+	host   string
+	path   string
+	failed bool
+}
+
+// ShowHistory function provides functionaltiy to list the jobs recorded with --history.
+func ShowHistory() *cli.Command {
+	var hc historyConfg
+	return &cli.Command{
+		Name:      "history",
+		Usage:     "The 'history' command lists past jobs recorded with --history, their parameters and outcome.",
+		UsageText: "ncp history --host 192.168.0.80 --path data",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Destination: &hc.limit,
+				Name:        "limit",
+				Aliases:     []string{"n"},
+				Value:       20,
+				Usage:       "Number of most recent jobs to show, 0 shows all of them.",
+			},
+			&cli.StringFlag{
+				Destination: &hc.host,
+				Name:        "host",
+				Aliases:     []string{"t"},
+				Usage:       "Only show jobs for this NFS server, including uploads to several servers that it was one of.",
+			},
+			&cli.StringFlag{
+				Destination: &hc.path,
+				Name:        "path",
+				Aliases:     []string{"p"},
+				Usage:       "Only show jobs whose source or destination contains this path.",
+			},
+			&cli.BoolFlag{
+				Destination: &hc.failed,
+				Name:        "failed",
+				Usage:       "Only show jobs that did not succeed.",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			path, err := helper.HistoryPath(ctx)
+			if err != nil {
+				return err
+			}
+			entries, err := helper.ReadHistory(path)
+			if err != nil {
+				return fmt.Errorf("unable to read history %s: %w", path, err)
+			}
+
+			var matched []helper.HistoryEntry
+			for _, e := range entries {
+				if hc.host != "" && !hasHost(e.Host, hc.host) {
+					continue
+				}
+				if hc.path != "" && !strings.Contains(e.Source, hc.path) && !strings.Contains(e.Destination, hc.path) {
+					continue
+				}
+				if hc.failed && e.Status == "ok" {
+					continue
+				}
+				matched = append(matched, e)
+			}
+			if hc.limit > 0 && len(matched) > hc.limit {
+				matched = matched[len(matched)-hc.limit:]
+			}
+
+			if ctx.String("output") == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				for _, e := range matched {
+					if err := enc.Encode(e); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			printEntries(matched)
+			return nil
+		},
+	}
+}
+
+// printEntries writes the jobs as a table, oldest first.
+func printEntries(entries []helper.HistoryEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "START\tCOMMAND\tHOST\tSOURCE\tDESTINATION\tSTATUS\tFILES\tFAILED\tBYTES\tDURATION")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			e.Start.Local().Format("2006-01-02 15:04:05"), e.Command, e.Host, e.Source, e.Destination,
+			e.Status, e.Files, e.Failed, helper.FormatBytes(e.Bytes),
+			(time.Duration(e.DurationMS) * time.Millisecond).Round(time.Second))
+	}
+	w.Flush()
+}
+
+// hasHost reports whether host is one of the servers of a job, uploads to
+// several servers record them separated by commas.
+func hasHost(hosts, host string) bool {
+	for _, h := range strings.Split(hosts, ",") {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
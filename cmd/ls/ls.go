@@ -0,0 +1,181 @@
+package ls
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type lsConfg struct {
+	long      bool
+	recursive bool
+	all       bool
+	human     bool
+	inode     bool
+	sortBy    string
+	reverse   bool
+}
+
+// ListFiles function provides functionaltiy to list files and folders on the NFS server.
+func ListFiles() *cli.Command {
+	var lc lsConfg
+	return &cli.Command{
+		Name:      "ls",
+		Usage:     "The 'ls' command lists files and folders on the NFS server without mounting it.",
+		UsageText: "ncp ls --host 192.168.0.80 -l /data/src",
+		Flags: append(remote.Flags(),
+			&cli.BoolFlag{
+				Destination: &lc.long,
+				Name:        "long",
+				Aliases:     []string{"l"},
+				Usage:       "Use the long listing format with mode, links, owner, size and modification time.",
+			},
+			&cli.BoolFlag{
+				Destination: &lc.recursive,
+				Name:        "recursive",
+				Aliases:     []string{"R"},
+				Usage:       "List folders recursively.",
+			},
+			&cli.BoolFlag{
+				Destination: &lc.all,
+				Name:        "all",
+				Aliases:     []string{"a"},
+				Usage:       "Do not hide entries starting with a dot.",
+			},
+			&cli.BoolFlag{
+				Destination: &lc.human,
+				Name:        "human-readable",
+				Aliases:     []string{"hr"},
+				Usage:       "Print sizes like 1.2 MB.",
+			},
+			&cli.BoolFlag{
+				Destination: &lc.inode,
+				Name:        "inode",
+				Aliases:     []string{"i"},
+				Usage:       "Print the fileid of each entry.",
+			},
+			&cli.StringFlag{
+				Destination: &lc.sortBy,
+				Name:        "sort",
+				Value:       remote.SortName,
+				Usage:       "Sort by name, size, time or none.",
+			},
+			&cli.BoolFlag{
+				Destination: &lc.reverse,
+				Name:        "reverse",
+				Aliases:     []string{"r"},
+				Usage:       "Reverse the sort order.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			if !remote.ValidSort(lc.sortBy) {
+				return fmt.Errorf("invalid sort %q, expected name, size, time or none", lc.sortBy)
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			paths := ctx.Args().Slice()
+			if len(paths) == 0 {
+				paths = []string{"/"}
+			}
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, remote.CommonDir(paths))
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			l := &lister{lsConfg: lc, fsys: fsys, headers: len(paths) > 1 || lc.recursive}
+			if ctx.String("output") == "json" {
+				l.enc = json.NewEncoder(os.Stdout)
+			}
+			failed := false
+			for i, p := range paths {
+				if err := l.list(p, i == 0); err != nil {
+					fmt.Fprintf(os.Stderr, "ls: %s: %v\n", p, err)
+					failed = true
+				}
+			}
+			if failed {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+type lister struct {
+	lsConfg
+	fsys    remote.FS
+	enc     *json.Encoder
+	headers bool
+}
+
+// list prints path, a folder is printed with its contents.
+func (l *lister) list(p string, first bool) error {
+	info, err := l.fsys.Stat(p)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		l.print(info)
+		return nil
+	}
+	return l.listDir(info.Path, first)
+}
+
+func (l *lister) listDir(dir string, first bool) error {
+	entries, err := l.fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var shown []*remote.FileInfo
+	for _, e := range entries {
+		if l.all || !remote.Hidden(e.Name) {
+			shown = append(shown, e)
+		}
+	}
+	remote.Sort(shown, l.sortBy, l.reverse)
+
+	if l.headers && l.enc == nil {
+		if !first {
+			fmt.Println()
+		}
+		fmt.Printf("%s:\n", dir)
+	}
+	for _, e := range shown {
+		l.print(e)
+	}
+	if !l.recursive {
+		return nil
+	}
+	for _, e := range shown {
+		if e.IsDir() {
+			if err := l.listDir(path.Join(dir, e.Name), false); err != nil {
+				fmt.Fprintf(os.Stderr, "ls: %s: %v\n", path.Join(dir, e.Name), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *lister) print(info *remote.FileInfo) {
+	switch {
+	case l.enc != nil:
+		l.enc.Encode(info)
+	case l.long:
+		fmt.Println(remote.FormatLong(info, l.human, l.inode))
+	case l.inode:
+		fmt.Printf("%10d %s\n", info.FileID, info.Name)
+	default:
+		fmt.Println(info.Name)
+	}
+}
@@ -0,0 +1,91 @@
+package mkdir
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type mkdirConfg struct {
+	parents bool
+	mode    string
+	verbose bool
+}
+
+// MakeDir function provides functionaltiy to create folders on the NFS server.
+func MakeDir() *cli.Command {
+	var mc mkdirConfg
+	return &cli.Command{
+		Name:      "mkdir",
+		Usage:     "The 'mkdir' command creates folders on the NFS server.",
+		UsageText: "ncp mkdir --host 192.168.0.80 -p /data/src/new/folder",
+		Flags: append(remote.Flags(),
+			&cli.BoolFlag{
+				Destination: &mc.parents,
+				Name:        "parents",
+				Aliases:     []string{"p"},
+				Usage:       "Create missing parent folders and do not fail if the folder exists.",
+			},
+			&cli.StringFlag{
+				Destination: &mc.mode,
+				Name:        "mode",
+				Aliases:     []string{"m"},
+				Value:       "0755",
+				Usage:       "Permissions of the new folders in octal.",
+			},
+			&cli.BoolFlag{
+				Destination: &mc.verbose,
+				Name:        "verbose",
+				Aliases:     []string{"v"},
+				Usage:       "Print every folder created.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() == 0 {
+				return fmt.Errorf("missing folder to create")
+			}
+			perm, err := remote.ParseMode(mc.mode)
+			if err != nil {
+				return err
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			paths := ctx.Args().Slice()
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, remote.CommonDir(paths))
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			created := func(p string) {
+				if mc.verbose {
+					fmt.Printf("created folder %s\n", p)
+				}
+			}
+			failed := false
+			for _, p := range paths {
+				if mc.parents {
+					err = remote.MkdirAll(fsys, p, perm, created)
+				} else if err = fsys.Mkdir(p, perm); err == nil {
+					created(remote.Clean(p))
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "mkdir: %s: %v\n", p, err)
+					failed = true
+				}
+			}
+			if failed {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
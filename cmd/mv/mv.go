@@ -0,0 +1,119 @@
+package mv
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type mvConfg struct {
+	noClobber bool
+	dryRun    bool
+	verbose   bool
+}
+
+// Move function provides functionaltiy to move or rename files and folders on the NFS server.
+func Move() *cli.Command {
+	var mc mvConfg
+	return &cli.Command{
+		Name:      "mv",
+		Usage:     "The 'mv' command moves or renames files and folders on the NFS server.",
+		UsageText: "ncp mv --host 192.168.0.80 /data/src/old.txt /data/src/new.txt",
+		Flags: append(remote.Flags(),
+			&cli.BoolFlag{
+				Destination: &mc.noClobber,
+				Name:        "no-clobber",
+				Aliases:     []string{"n"},
+				Usage:       "Do not replace an existing file.",
+			},
+			&cli.BoolFlag{
+				Destination: &mc.dryRun,
+				Name:        "dry-run",
+				Usage:       "Print what would be moved without moving anything.",
+			},
+			&cli.BoolFlag{
+				Destination: &mc.verbose,
+				Name:        "verbose",
+				Aliases:     []string{"v"},
+				Usage:       "Print every file moved.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() < 2 {
+				return fmt.Errorf("expected a source and a destination")
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			paths := ctx.Args().Slice()
+			sources, dest := paths[:len(paths)-1], remote.Clean(paths[len(paths)-1])
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, remote.CommonDir(paths))
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			// Moving into an existing folder keeps the names, like mv does
+			info, err := fsys.Stat(dest)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			intoDir := err == nil && info.IsDir()
+			if len(sources) > 1 && !intoDir {
+				return fmt.Errorf("%s is not a folder", dest)
+			}
+
+			failed := false
+			for _, src := range sources {
+				src = remote.Clean(src)
+				target := dest
+				if intoDir {
+					target = path.Join(dest, path.Base(src))
+				}
+				if err := mc.move(fsys, src, target); err != nil {
+					fmt.Fprintf(os.Stderr, "mv: %s: %v\n", src, err)
+					failed = true
+				}
+			}
+			if failed {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+func (mc *mvConfg) move(fsys remote.FS, src, target string) error {
+	if src == target {
+		return errors.New("source and destination are the same")
+	}
+	if _, err := fsys.Stat(src); err != nil {
+		return err
+	}
+	if mc.noClobber {
+		if _, err := fsys.Stat(target); err == nil {
+			fmt.Fprintf(os.Stderr, "skipped %s, %s exists\n", src, target)
+			return nil
+		}
+	}
+	if mc.dryRun {
+		fmt.Printf("would move %s to %s\n", src, target)
+		return nil
+	}
+	if err := fsys.Rename(src, target); err != nil {
+		return err
+	}
+	if mc.verbose {
+		fmt.Printf("moved %s to %s\n", src, target)
+	}
+	return nil
+}
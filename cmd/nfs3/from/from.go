@@ -2,207 +2,254 @@ package from
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 
 	"github.com/go-nfs/nfsv3/nfs"
-	"github.com/go-nfs/nfsv3/nfs/rpc"
 	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
 	"github.com/urfave/cli/v2"
 )
 
 type nfsConfg struct {
 	nfsHost        string
 	nfsMountFolder string
+	export         string
+	uid, gid       uint32
+	// layout decides where the files are written locally
+	layout helper.Layout
 }
 
-// FromServer function provides functionaltiy to transfer files or folders from NFS server to local filesystem.
-func FromServerV3() *cli.Command {
-	var nc nfsConfg
-	return &cli.Command{
-		Name:      "from",
-		Usage:     "The 'from' command is used to copy files or folders from Remote NFS server to local machine.",
-		UsageText: "ncp from --host 192.168.0.80 --nfspath data/src",
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Destination: &nc.nfsHost,
-				Name:        "host",
-				Aliases:     []string{"t"},
-				Required:    true,
-				Usage:       "The IP address or DNS of the NFS server specifies the IP or hostname that can be used to access the NFS server.",
-			},
-			&cli.StringFlag{
-				Destination: &nc.nfsMountFolder,
-				Name:        "nfspath",
-				Required:    true,
-				Aliases:     []string{"p"},
-				Usage:       "The NFS path denotes the destination directory on the NFS server where files/folders will be copied from.",
-			},
-		},
-		Action: func(ctx *cli.Context) error {
-			truncate := ctx.Bool("turncate")
-			u := ctx.Int("uid")
-			g := ctx.Int("gid")
-			uid, gid := helper.CheckUID(u, g)
-
-			rootDir := filepath.Dir(nc.nfsMountFolder)
-			basePath := filepath.Base(nc.nfsMountFolder)
-
-			mount, err := nfs.DialMount(nc.nfsHost, false)
-			if err != nil {
-				log.Fatalf("unable to dial MOUNT service: %v", err)
-			}
-			defer mount.Close()
+// Download copies nfsPath, a file or a folder, from the server in cfg into the
+// local folder of layout over NFS v3. It does the work of 'get', and of its
+// 'from' alias, when NFS v3 is used.
+func Download(ctx *cli.Context, cfg remote.Config, nfsPath string, layout helper.Layout) error {
+	nc := nfsConfg{nfsHost: cfg.Host, nfsMountFolder: nfsPath, export: cfg.Export, uid: cfg.UID, gid: cfg.GID, layout: layout}
+	return nc.download(ctx)
+}
 
-			hostNameLocal, _ := os.Hostname()
+func (nc *nfsConfg) download(ctx *cli.Context) error {
+	job, err := helper.NewJob(ctx)
+	if err != nil {
+		return err
+	}
+	job.Source, job.Destination = nc.nfsMountFolder, nc.layout.Dest
+	uid, gid := nc.uid, nc.gid
 
-			auth := rpc.NewAuthUnix(hostNameLocal, uid, gid)
+	jobCtx, cancel := helper.JobContext(ctx)
+	defer cancel()
+	job.Start()
 
-			nfs, err := mount.Mount(rootDir, auth.Auth())
-			if err != nil {
-				log.Fatalf("unable to mount volume: %v", err)
-			}
-			defer nfs.Close()
-
-			if err = mount.Unmount(); err != nil {
-				log.Fatalf("unable to unmount target: %v", err)
-			}
+	// Every worker gets its own mount so transfers do not share a connection,
+	// and spreads file data over --nconnect connections
+	cfg := remote.Config{Host: nc.nfsHost, Version: "3", UID: uid, GID: gid, Export: nc.export, NConnect: ctx.Int("nconnect"), Addrs: ctx.StringSlice("server-ip"), IOTimeout: ctx.Duration("io-timeout")}
+	target := remote.Clean(nc.nfsMountFolder)
+	targets := make([]remote.V3Conns, 0, job.Parallel)
+	conns, export, err := remote.MountV3Conns(cfg, target)
+	if err != nil {
+		return job.Fail(jobCtx, fmt.Errorf("unable to mount volume: %w", err))
+	}
+	defer conns.Close()
+	targets = append(targets, conns)
+	nfs := conns[0]
+	// The other workers mount the export found for the first one
+	cfg.Export = export
+	for len(targets) < job.Parallel {
+		t, _, err := remote.MountV3Conns(cfg, target)
+		if err != nil {
+			return job.Fail(jobCtx, fmt.Errorf("unable to mount volume: %w", err))
+		}
+		defer t.Close()
+		targets = append(targets, t)
+	}
 
-			mount.Close()
-			if isDirectory(nfs, basePath) {
+	// basePath is the path inside the export, the layout works on server paths
+	basePath := remote.Rel(export, target)
+	layout := nc.layout
+	localPath := func(p string) (string, bool) {
+		return layout.Path(target, path.Join(export, p))
+	}
+	var files []string
+	var totalSize int64
+	if isDirectory(nfs, basePath) {
 
-				dirs, files, err := listFilesAndFolders(nfs, basePath)
-				if err != nil {
-					log.Fatalf("unable to get list of files and folders %v", err)
-				}
-				if len(dirs) == 0 {
-					dirs = append(dirs, basePath)
-				}
-				for _, v := range dirs {
-					if err = createDirIfNotExist(v); err != nil {
-						log.Fatalf("fail to create folder %V", err)
-					}
-				}
-				for _, sf := range files {
-					if err = transferFile(nfs, sf, sf, truncate); err != nil {
-						log.Fatalf("fail to copy files with error %V", err)
-					}
-				}
+		var dirs []string
+		dirs, files, totalSize, err = listFilesAndFolders(jobCtx, nfs, basePath, job.Excluded)
+		if err != nil {
+			return job.Fail(jobCtx, fmt.Errorf("unable to get list of files and folders: %w", err))
+		}
+		dirs = append(dirs, basePath)
+		for _, v := range dirs {
+			dir, ok := localPath(v)
+			if !ok {
+				continue
 			}
-			if !isDirectory(nfs, basePath) {
-				if err = transferFile(nfs, basePath, basePath, truncate); err != nil {
-					log.Fatalf("fail to transfer files %v", err)
-				}
+			created, err := createDirIfNotExist(dir)
+			if err != nil {
+				return job.Fail(jobCtx, fmt.Errorf("fail to create folder: %w", err))
+			}
+			if created {
+				job.DirCreated(dir)
+			}
+		}
+		// Files left without a name by --strip-components are skipped
+		kept := files[:0]
+		for _, f := range files {
+			if _, ok := localPath(f); ok {
+				kept = append(kept, f)
+			} else if attr, _, err := nfs.GetAttr(f); err == nil {
+				totalSize -= attr.Size()
 			}
-			return nil
-		},
+		}
+		files = kept
+	} else {
+		// A file has no contents to copy on its own
+		layout.Contents = false
+		attr, _, err := nfs.GetAttr(basePath)
+		if err != nil {
+			return job.Fail(jobCtx, fmt.Errorf("unable to get file attributes: %w", err))
+		}
+		files, totalSize = []string{basePath}, attr.Size()
+		local, ok := localPath(basePath)
+		if !ok {
+			return job.Fail(jobCtx, fmt.Errorf("--strip-components %d leaves no name for %s", layout.Strip, target))
+		}
+		if _, err := createDirIfNotExist(filepath.Dir(local)); err != nil {
+			return job.Fail(jobCtx, err)
+		}
 	}
+
+	completed, err := job.Transfer(jobCtx, files, totalSize, func(ctx context.Context, slot int, sf string) error {
+		local, _ := localPath(sf)
+		return transferFile(ctx, job, slot, targets[slot], sf, local)
+	})
+	if err != nil {
+		if jobCtx.Err() != nil {
+			helper.PrintInterrupted(err, completed, len(files))
+			return err
+		}
+		return fmt.Errorf("fail to copy files: %w", err)
+	}
+	return nil
 }
 
-// transferFile will take a source and target file path along with *nfs.Targe to transfer file
-func transferFile(nfs *nfs.Target, srcfile string, targetfile string, truncate bool) error {
+// transferFile will take a source and target file path along with the mounts of the worker to transfer file.
+// A partially written target is removed on failure unless the job keeps partial files.
+func transferFile(ctx context.Context, job *helper.Job, slot int, conns remote.V3Conns, srcfile string, targetfile string) (err error) {
 	var filePath string
-	sourceFile, err := nfs.Open(srcfile)
+	stat, _, err := conns[0].Lookup(srcfile)
 	if err != nil {
-		log.Fatalf("error opening source file: %s", err.Error())
-		return err
+		return fmt.Errorf("error opening source file: %w", err)
 	}
-	// Calculate the ShaSum
-	h := sha256.New()
-	t := io.TeeReader(sourceFile, h)
-	stat, _, _ := nfs.Lookup(srcfile)
 	size := stat.Size()
 
-	defer sourceFile.Close()
-
-	if !truncate {
+	if !job.Truncate {
 		filePath = srcfile
 	} else {
 		filePath = helper.TruncateFileName(srcfile)
 	}
 
-	progress := helper.ProgressBar(size, filePath, helper.CheckMark())
+	progress := job.Progress.File(slot, targetfile, size, filePath)
 
 	wr, err := os.Create(targetfile)
 	if err != nil {
-		log.Fatalf("error opening target file: %s", err.Error())
-		return err
+		return fmt.Errorf("error opening target file: %w", err)
 	}
 	defer wr.Close()
+	defer func() {
+		if err != nil && !job.KeepPartial {
+			wr.Close()
+			os.Remove(targetfile)
+		}
+	}()
 
-	// Copy files with progress size
-	wrBytes, err := io.CopyN(wr, io.TeeReader(t, progress), size)
+	// Copy files with progress size and calculate the ShaSum
+	h := sha256.New()
+	w := helper.LimitWriter(ctx, helper.ContextWriter(ctx, io.MultiWriter(wr, h, progress)), job.Limiter)
+	wrBytes, err := conns.ReadFile(srcfile, 0, w)
 	if err != nil {
-		log.Fatalf("error copying file: written bytes=%d, %s", wrBytes, err.Error())
-		return err
+		return fmt.Errorf("error copying file: written bytes=%d, %w", wrBytes, err)
 	}
 	expectedSum := h.Sum(nil)
+	if !job.Verify {
+		progress.Finish(expectedSum)
+		return nil
+	}
 
 	// Get the file we wrote and calculate the sum
-	rdr, err := nfs.Open(targetfile)
+	rdr, err := os.Open(targetfile)
 	if err != nil {
-		log.Fatalf("error opening target file for verification: %v", err)
-		return err
+		return fmt.Errorf("error opening target file for verification: %w", err)
 	}
 	defer rdr.Close()
 
 	h = sha256.New()
-	t = io.TeeReader(rdr, h)
+	t := io.TeeReader(helper.LimitReader(ctx, helper.ContextReader(ctx, rdr), job.Limiter), h)
 
 	_, err = io.Copy(io.Discard, t) // Discard the content since we only need the sum
 	if err != nil {
-		log.Fatalf("error reading target file for verification: %v", err)
-		return err
+		return fmt.Errorf("error reading target file for verification: %w", err)
 	}
 	actualSum := h.Sum(nil)
 
 	if !bytes.Equal(actualSum, expectedSum) {
-		log.Fatalf("[Verification Error] Actual SHA=%x Expected SHA=%s", actualSum, expectedSum)
+		return fmt.Errorf("verification failed: actual SHA=%x expected SHA=%x", actualSum, expectedSum)
 	}
-	progress.Finish()
+	progress.Finish(actualSum)
 	return nil
 }
 
 // createDirIfNotExist will check if folder does not exist and automatically creates it.
-func createDirIfNotExist(path string) error {
+// It reports whether the folder was created.
+func createDirIfNotExist(path string) (bool, error) {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		if err = os.MkdirAll(path, os.ModePerm); err != nil {
-			return err
+			return false, err
 		}
-		return err
+		return true, nil
 	}
-	return nil
+	return false, nil
 }
 
 // listFileAndFolders take a directory path and returns a slice containng files and another containing folders
-func listFilesAndFolders(v *nfs.Target, dir string) ([]string, []string, error) {
+// along with the total size of the files, leaving out the files and folders whose name is excluded
+func listFilesAndFolders(ctx context.Context, v *nfs.Target, dir string, exclude func(name string) bool) ([]string, []string, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, 0, err
+	}
 	outDirs, err := v.ReadDirPlus(dir)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, err
 	}
 	var dirs []string
 	var files []string
+	var size int64
 
 	for _, outDir := range outDirs {
-		if outDir.Name() != "." && outDir.Name() != ".." {
+		if outDir.Name() != "." && outDir.Name() != ".." && !exclude(outDir.Name()) {
 			if outDir.IsDir() {
-				subDirs, subFiles, err := listFilesAndFolders(v, dir+"/"+outDir.Name())
+				subDirs, subFiles, subSize, err := listFilesAndFolders(ctx, v, dir+"/"+outDir.Name(), exclude)
 				if err != nil {
-					return nil, nil, err
+					return nil, nil, 0, err
 				}
 				dirs = append(dirs, subDirs...)
 				files = append(files, subFiles...)
+				size += subSize
 				dirs = append(dirs, dir+"/"+outDir.Name())
 			} else {
 				files = append(files, dir+"/"+outDir.Name())
+				size += outDir.Size()
 			}
 		}
 	}
 
-	return dirs, files, nil
+	return dirs, files, size, nil
 }
 
 // isDirectory takes a path string and checks if the given path is a directory or not on NFS server
@@ -2,15 +2,16 @@ package to
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"fmt"
 	"io"
-	"log"
 	"os"
+	"path"
 	"path/filepath"
 
-	"github.com/go-nfs/nfsv3/nfs"
-	"github.com/go-nfs/nfsv3/nfs/rpc"
 	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
 	"github.com/urfave/cli/v2"
 )
 
@@ -18,94 +19,107 @@ type nfsConfg struct {
 	inputPath      string
 	nfsHost        string
 	nfsMountFolder string
+	export         string
+	uid, gid       uint32
 }
 
-// ToServer function provides functionaltiy to transfer files or folders from local filesystem to NFS server.
-func ToServerV3() *cli.Command {
-	var nc nfsConfg
-	return &cli.Command{
-		Name:      "to",
-		Usage:     "The 'to' command is used to copy files or folders from the local machine to NFS server.",
-		UsageText: "ncp to --host 192.168.0.80 --nfspath data --input src",
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Destination: &nc.inputPath,
-				Name:        "input",
-				Required:    true,
-				Aliases:     []string{"i"},
-				Usage:       "Input refers to the specific location of a folder or file that will be transferred.",
-			},
-
-			&cli.StringFlag{
-				Destination: &nc.nfsHost,
-				Name:        "host",
-				Aliases:     []string{"t"},
-				Required:    true,
-				Usage:       "IP address or DNS of the NFS server specifies the IP or hostname that can be used to access the NFS server.",
-			},
-			&cli.StringFlag{
-				Destination: &nc.nfsMountFolder,
-				Required:    true,
-				Name:        "nfspath",
-				Aliases:     []string{"p"},
-				Usage:       "NFS path denotes the destination directory on the NFS server where files will be copied to.",
-			},
-		},
-		Action: func(ctx *cli.Context) error {
-			truncate := ctx.Bool("turncate")
-			u := ctx.Int("uid")
-			g := ctx.Int("gid")
-			uid, gid := helper.CheckUID(u, g)
-
-			basePath := filepath.Dir(nc.inputPath)
-			mount, err := nfs.DialMount(nc.nfsHost, false)
-			if err != nil {
-				log.Fatalf("unable to dial MOUNT service: %v", err)
-			}
-			defer mount.Close()
+// Upload copies input, a file or a folder, into the folder nfsPath of the server
+// in cfg over NFS v3. It does the work of 'put', and of its 'to' alias, when NFS v3 is used.
+func Upload(ctx *cli.Context, cfg remote.Config, nfsPath, input string) error {
+	nc := nfsConfg{inputPath: input, nfsHost: cfg.Host, nfsMountFolder: nfsPath, export: cfg.Export, uid: cfg.UID, gid: cfg.GID}
+	return nc.upload(ctx)
+}
 
-			hostNameLocal, _ := os.Hostname()
+func (nc *nfsConfg) upload(ctx *cli.Context) error {
+	job, err := helper.NewJob(ctx)
+	if err != nil {
+		return err
+	}
+	job.Source, job.Destination = nc.inputPath, nc.nfsMountFolder
+	job.Start()
+	uid, gid := nc.uid, nc.gid
 
-			auth := rpc.NewAuthUnix(hostNameLocal, uid, gid)
+	jobCtx, cancel := helper.JobContext(ctx)
+	defer cancel()
 
-			nfs, err := mount.Mount(nc.nfsMountFolder, auth.Auth())
-			if err != nil {
-				log.Fatalf("unable to mount volume: %v", err)
-			}
-			defer nfs.Close()
-			if err = mount.Unmount(); err != nil {
-				log.Fatalf("nable to unmount target: %v", err)
-			}
-			mount.Close()
+	basePath := filepath.Dir(nc.inputPath)
 
-			folders, files, err := getFoldersAndFiles(nc.inputPath, "")
-			if err != nil {
-				log.Fatalf("unable to get list of files and folders %v", err)
-			}
-			for _, v := range folders {
-				_, err = nfs.Mkdir(v, os.ModePerm)
-				// skip file exist error
-				if err == os.ErrExist {
-					err = nil
-				}
-				if err != nil {
-					return err // But return all other errors
-				}
-			}
-			for _, targetfile := range files {
-				sf := filepath.Join(basePath, targetfile)
-				// Copy file to destination
-				if err = transferFile(nfs, sf, targetfile, truncate); err != nil {
-					log.Fatalf("fail to transfer files %v", err)
-				}
-			}
-			return nil
-		},
+	// Every worker gets its own mount so transfers do not share a connection,
+	// and spreads file data over --nconnect connections
+	cfg := remote.Config{Host: nc.nfsHost, Version: "3", UID: uid, GID: gid, Export: nc.export, NConnect: ctx.Int("nconnect"), Addrs: ctx.StringSlice("server-ip"), IOTimeout: ctx.Duration("io-timeout")}
+	target := remote.Clean(nc.nfsMountFolder)
+	targets := make([]remote.V3Conns, 0, job.Parallel)
+	conns, export, err := remote.MountV3Conns(cfg, target)
+	if err != nil {
+		return job.Fail(jobCtx, fmt.Errorf("unable to mount volume: %w", err))
 	}
+	defer conns.Close()
+	targets = append(targets, conns)
+	nfs := conns[0]
+	// The other workers mount the export found for the first one
+	cfg.Export = export
+	for len(targets) < job.Parallel {
+		t, _, err := remote.MountV3Conns(cfg, target)
+		if err != nil {
+			return job.Fail(jobCtx, fmt.Errorf("unable to mount volume: %w", err))
+		}
+		defer t.Close()
+		targets = append(targets, t)
+	}
+
+	// Folders and files are created in dir, the destination inside the export
+	dir := remote.Rel(export, target)
+	if _, _, err := nfs.GetAttr(dir); err != nil {
+		return job.Fail(jobCtx, fmt.Errorf("%s: %w", target, err))
+	}
+
+	folders, files, err := getFoldersAndFiles(jobCtx, nc.inputPath, "", job.Excluded)
+	if err != nil {
+		return job.Fail(jobCtx, fmt.Errorf("unable to get list of files and folders: %w", err))
+	}
+	sourceFiles := make([]string, len(files))
+	for i, f := range files {
+		sourceFiles[i] = filepath.Join(basePath, f)
+	}
+	totalBytes := helper.LocalSize(sourceFiles)
+	if !ctx.Bool("no-space-check") {
+		cfg := remote.Config{Host: nc.nfsHost, Version: "3", UID: uid, GID: gid, IOTimeout: ctx.Duration("io-timeout")}
+		if err := remote.CheckSpace(jobCtx, cfg, nc.nfsMountFolder, totalBytes); err != nil {
+			return job.Fail(jobCtx, err)
+		}
+	}
+	for _, v := range folders {
+		_, err = nfs.Mkdir(path.Join(dir, filepath.ToSlash(v)), os.ModePerm)
+		// skip file exist error
+		if err == os.ErrExist {
+			continue
+		}
+		if err != nil {
+			return job.Fail(jobCtx, err) // But return all other errors
+		}
+		job.DirCreated(v)
+	}
+	completed, err := job.Transfer(jobCtx, files, totalBytes, func(ctx context.Context, slot int, targetfile string) error {
+		sf := filepath.Join(basePath, targetfile)
+		// Copy file to destination
+		return transferFile(ctx, job, slot, targets[slot], sf, path.Join(dir, filepath.ToSlash(targetfile)))
+	})
+	if err != nil {
+		if jobCtx.Err() != nil {
+			helper.PrintInterrupted(err, completed, len(files))
+			return err
+		}
+		return fmt.Errorf("fail to transfer files: %w", err)
+	}
+	return nil
 }
 
 // listFileAndFolders take a directory path and returns a slice containng files and another containing folders
-func getFoldersAndFiles(path string, basePath string) ([]string, []string, error) {
+// leaving out the files and folders whose name is excluded
+func getFoldersAndFiles(ctx context.Context, path string, basePath string, exclude func(name string) bool) ([]string, []string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
 	var folders []string
 	var files []string
 
@@ -134,17 +148,18 @@ func getFoldersAndFiles(path string, basePath string) ([]string, []string, error
 		return nil, nil, err
 	}
 	for _, contentPath := range contents {
+		if exclude(filepath.Base(contentPath)) {
+			continue
+		}
 		// Check if the content is a directory
 		isDir, err := isDirectory(contentPath)
 		if err != nil {
-			log.Fatalf("can not check dir/file attributes %v", err)
-			continue
+			return nil, nil, fmt.Errorf("can not check dir/file attributes: %w", err)
 		}
 		if isDir {
-			subfolderFolders, subfolderFiles, err := getFoldersAndFiles(contentPath, filepath.Join(basePath, folderName))
+			subfolderFolders, subfolderFiles, err := getFoldersAndFiles(ctx, contentPath, filepath.Join(basePath, folderName), exclude)
 			if err != nil {
-				log.Fatalf("unable to get list %v", err)
-				continue
+				return nil, nil, err
 			}
 
 			folders = append(folders, subfolderFolders...)
@@ -158,68 +173,66 @@ func getFoldersAndFiles(path string, basePath string) ([]string, []string, error
 	return folders, files, nil
 }
 
-// transferFile will take a source and target file path along with *nfs.Targe to transfer file
-func transferFile(nfs *nfs.Target, srcfile string, targetfile string, turnication bool) error {
+// transferFile will take a source and target file path along with the mounts of the worker to transfer file.
+// A partially written target is removed on failure unless the job keeps partial files.
+func transferFile(ctx context.Context, job *helper.Job, slot int, conns remote.V3Conns, srcfile string, targetfile string) (err error) {
 	var filePath string
 	sourceFile, err := os.Open(srcfile)
 	if err != nil {
-		log.Fatalf("error opening source file: %s", err.Error())
+		return fmt.Errorf("error opening source file: %w", err)
 	}
 
 	// Calculate the ShaSum
 	h := sha256.New()
-	t := io.TeeReader(sourceFile, h)
-	stat, _ := sourceFile.Stat()
+	t := io.TeeReader(helper.LimitReader(ctx, helper.ContextReader(ctx, sourceFile), job.Limiter), h)
+	stat, err := sourceFile.Stat()
+	if err != nil {
+		return fmt.Errorf("error reading source file attributes: %w", err)
+	}
 	size := stat.Size()
 
 	defer sourceFile.Close()
 
-	if !turnication {
+	if !job.Truncate {
 		filePath = srcfile
 	} else {
 		filePath = helper.TruncateFileName(srcfile)
 	}
 
-	progress := helper.ProgressBar(size, filePath, helper.CheckMark())
+	progress := job.Progress.File(slot, targetfile, size, filePath)
 
-	wr, err := nfs.OpenFile(targetfile, os.ModePerm)
-	if err != nil {
-		log.Fatalf("error opening target file: %s", err.Error())
-		return err
-	}
-	defer wr.Close()
+	defer func() {
+		if err != nil && !job.KeepPartial {
+			conns[0].Remove(targetfile)
+		}
+	}()
 
 	// Copy files with progress size
-	n, err := io.CopyN(wr, io.TeeReader(t, progress), size)
+	n, err := conns.WriteFile(targetfile, remote.FileMode, io.LimitReader(io.TeeReader(t, progress), size))
+	if err == nil && n < size {
+		err = io.EOF
+	}
 	if err != nil {
-		log.Fatalf("error copying: n=%d, %s", n, err.Error())
-		return err
+		return fmt.Errorf("error copying: n=%d, %w", n, err)
 	}
 	expectedSum := h.Sum(nil)
-
-	// Get the file we wrote and calculate the sum
-	rdr, err := nfs.Open(targetfile)
-	if err != nil {
-		log.Fatalf("error opening target file for verification: %v", err)
-		return err
+	if !job.Verify {
+		progress.Finish(expectedSum)
+		return nil
 	}
-	defer rdr.Close()
 
+	// Get the file we wrote and calculate the sum
 	h = sha256.New()
-	t = io.TeeReader(rdr, h)
-
-	_, err = io.Copy(io.Discard, t) // Discard the content since we only need the sum
-	if err != nil {
-		log.Fatalf("error reading target file for verification: %v", err)
-		return err
+	if _, err = conns.ReadFile(targetfile, 0, helper.LimitWriter(ctx, helper.ContextWriter(ctx, h), job.Limiter)); err != nil {
+		return fmt.Errorf("error reading target file for verification: %w", err)
 	}
 	actualSum := h.Sum(nil)
 
 	if !bytes.Equal(actualSum, expectedSum) {
-		log.Fatalf("[Verification Error] Actual SHA=%x Expected SHA=%s", actualSum, expectedSum)
+		return fmt.Errorf("verification failed: actual SHA=%x expected SHA=%x", actualSum, expectedSum)
 	}
 
-	progress.Finish()
+	progress.Finish(actualSum)
 	return nil
 }
 
@@ -2,27 +2,27 @@ package v4from
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 
-	"github.com/kha7iq/go-nfs-client/nfs4"
 	"github.com/kha7iq/ncp/internal/helper"
-	"github.com/schollz/progressbar/v3"
+	"github.com/kha7iq/ncp/internal/remote"
 	"github.com/urfave/cli/v2"
 )
 
 type nfsConfg struct {
-	nfsHost        string
 	nfsMountFolder string
-	nfsServerPort  string
+	cfg            remote.Config
+	// layout decides where the files are written locally
+	layout helper.Layout
 }
 
 type progressWriter struct {
 	writer io.Writer
-	bar    *progressbar.ProgressBar
+	bar    *helper.FileProgress
 }
 
 func (pw *progressWriter) Write(p []byte) (n int, err error) {
@@ -31,99 +31,116 @@ func (pw *progressWriter) Write(p []byte) (n int, err error) {
 	return n, err
 }
 
-// FromServer function provides functionaltiy to transfer files or folders from NFS server to local filesystem.
-func FromServerV4() *cli.Command {
-	var nc nfsConfg
-	return &cli.Command{
-		Name:      "v4from",
-		Usage:     "The 'v4from' command is used to copy files or folders from Remote NFS v4 server to local machine.",
-		UsageText: "ncp v4from --host 192.168.0.80 --nfspath data/src",
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Destination: &nc.nfsHost,
-				Name:        "host",
-				Aliases:     []string{"t"},
-				Required:    true,
-				Usage:       "The IP address or DNS of the NFS server specifies the IP or hostname that can be used to access the NFS server.",
-			},
-			&cli.StringFlag{
-				Destination: &nc.nfsMountFolder,
-				Name:        "nfspath",
-				Required:    true,
-				Aliases:     []string{"p"},
-				Usage:       "The NFS path denotes the destination directory on the NFS server where files/folders will be copied from.",
-			},
-			&cli.StringFlag{
-				Destination: &nc.nfsServerPort,
-				Name:        "port",
-				Aliases:     []string{"pr"},
-				Usage:       "NFS server port, if other then default.",
-				Value:       "2049",
-			},
-		},
-		Action: func(ctx *cli.Context) error {
-			truncate := ctx.Bool("turncate")
-			u := ctx.Int("uid")
-			g := ctx.Int("gid")
-			uid, gid := helper.CheckUID(u, g)
-			ctxx := context.Background()
-			hostNameLocal, _ := os.Hostname()
-			basePath := filepath.Base(nc.nfsMountFolder)
-
-			nfs4, err := nfs4.NewNfsClient(ctxx, nc.nfsHost+":"+nc.nfsServerPort, nfs4.AuthParams{
-				MachineName: hostNameLocal,
-				Uid:         uid,
-				Gid:         gid,
-			})
+// Download copies nfsPath, a file or a folder, from the server in cfg into the
+// local folder of layout over NFS v4. It does the work of 'get', and of its
+// 'v4from' alias, when NFS v4 is used.
+func Download(ctx *cli.Context, cfg remote.Config, nfsPath string, layout helper.Layout) error {
+	// nfsPath is a server path already
+	cfg.Root, cfg.Export = "", ""
+	nc := nfsConfg{nfsMountFolder: nfsPath, cfg: cfg, layout: layout}
+	return nc.download(ctx)
+}
+
+func (nc *nfsConfg) download(ctx *cli.Context) error {
+	job, err := helper.NewJob(ctx)
+	if err != nil {
+		return err
+	}
+	job.Source, job.Destination = nc.nfsMountFolder, nc.layout.Dest
+	jobCtx, cancel := helper.JobContext(ctx)
+	defer cancel()
+	job.Start()
+	// Every worker gets its own connection, file data is spread over the
+	// --nconnect connections of the worker.
+	workers := make([]remote.FS, 0, job.Parallel)
+	for len(workers) < job.Parallel {
+		fsys, err := remote.Dial(jobCtx, nc.cfg, nc.nfsMountFolder)
+		if err != nil {
+			return job.Fail(jobCtx, err)
+		}
+		defer fsys.Close()
+		workers = append(workers, fsys)
+	}
+	fsys := workers[0]
+
+	layout := nc.layout
+	var files []string
+	var totalSize int64
+	if isDirectory(fsys, nc.nfsMountFolder) {
+
+		var folders []string
+		folders, files, totalSize, err = getFolderAndFileList(jobCtx, fsys, nc.nfsMountFolder, job.Excluded)
+		if err != nil {
+			return job.Fail(jobCtx, fmt.Errorf("unable to get list of files and folders: %w", err))
+		}
+		folders = append(folders, nc.nfsMountFolder)
+
+		for _, v := range folders {
+			dir, ok := layout.Path(nc.nfsMountFolder, v)
+			if !ok {
+				continue
+			}
+			created, err := createDirIfNotExist(dir)
 			if err != nil {
-				return err
+				return job.Fail(jobCtx, fmt.Errorf("fail to create folder: %w", err))
 			}
-			defer nfs4.Close()
-
-			if isDirectory(nfs4, nc.nfsMountFolder) {
-
-				folders, files, err := getFolderAndFileList(nfs4, nc.nfsMountFolder)
-				if err != nil {
-					log.Fatalf("unable to get list of files and folders %v", err)
-				}
-				if len(folders) == 0 {
-					folders = append(folders, nc.nfsMountFolder)
-				}
-
-				for _, v := range folders {
-					if err = createDirIfNotExist(v); err != nil {
-						log.Fatalf("fail to create folder %V", err)
-					}
-				}
-
-				for _, sf := range files {
-
-					if err = transferFile(nfs4, sf, sf, truncate); err != nil {
-						log.Fatalf("fail to copy files with error %V", err)
-					}
-				}
+			if created {
+				job.DirCreated(dir)
 			}
-			if !isDirectory(nfs4, nc.nfsMountFolder) {
-				if err = transferFile(nfs4, nc.nfsMountFolder, basePath, truncate); err != nil {
-					log.Fatalf("fail to transfer files %v", err)
-				}
+		}
+		// Files left without a name by --strip-components are skipped
+		kept := files[:0]
+		for _, f := range files {
+			if _, ok := layout.Path(nc.nfsMountFolder, f); ok {
+				kept = append(kept, f)
+			} else if st, err := fsys.Stat(f); err == nil {
+				totalSize -= st.Size
 			}
-			return nil
-		},
+		}
+		files = kept
+	} else {
+		// A file has no contents to copy on its own
+		layout.Contents = false
+		st, err := fsys.Stat(nc.nfsMountFolder)
+		if err != nil {
+			return job.Fail(jobCtx, fmt.Errorf("unable to get file attributes: %w", err))
+		}
+		files, totalSize = []string{nc.nfsMountFolder}, st.Size
+		local, ok := layout.Path(nc.nfsMountFolder, nc.nfsMountFolder)
+		if !ok {
+			return job.Fail(jobCtx, fmt.Errorf("--strip-components %d leaves no name for %s", layout.Strip, nc.nfsMountFolder))
+		}
+		if _, err := createDirIfNotExist(filepath.Dir(local)); err != nil {
+			return job.Fail(jobCtx, err)
+		}
+	}
+
+	completed, err := job.Transfer(jobCtx, files, totalSize, func(ctx context.Context, slot int, sf string) error {
+		local, _ := layout.Path(nc.nfsMountFolder, sf)
+		return transferFile(ctx, job, slot, workers[slot], sf, local)
+	})
+	if err != nil {
+		if jobCtx.Err() != nil {
+			helper.PrintInterrupted(err, completed, len(files))
+			return err
+		}
+		return fmt.Errorf("fail to copy files: %w", err)
 	}
+	return nil
 }
 
-// transferFile will take a source and target file path along with nfs4.NfsInterface to transfer file
-func transferFile(nfs4 nfs4.NfsInterface, srcfile string, targetfile string, truncate bool) error {
+// transferFile will take a source and target file path along with the connection of the worker to transfer file.
+// A partially written target is removed on failure unless the job keeps partial files.
+func transferFile(ctx context.Context, job *helper.Job, slot int, fsys remote.FS, srcfile string, targetfile string) (err error) {
 	var filePath string
 
-	st, err := nfs4.GetFileInfo(srcfile)
+	st, err := fsys.Stat(srcfile)
 	if err != nil {
 		return fmt.Errorf("failed to get remote file info: %w", err)
 	}
 	fileSize := st.Size
 
-	if !truncate {
+	if !job.Truncate {
 		filePath = srcfile
 	} else {
 		filePath = helper.TruncateFileName(srcfile)
@@ -131,73 +148,92 @@ func transferFile(nfs4 nfs4.NfsInterface, srcfile string, targetfile string, tru
 
 	wr, err := os.Create(targetfile)
 	if err != nil {
-		log.Fatalf("error opening target file: %s", err.Error())
-		return err
+		return fmt.Errorf("error opening target file: %w", err)
 	}
 	defer wr.Close()
+	defer func() {
+		if err != nil && !job.KeepPartial {
+			wr.Close()
+			os.Remove(targetfile)
+		}
+	}()
 
-	progress := helper.ProgressBar(int64(fileSize), filePath, helper.CheckMark())
+	progress := job.Progress.File(slot, targetfile, fileSize, filePath)
+
+	// Calculate the ShaSum while writing
+	h := sha256.New()
 
 	// Create a writer with a progress callback to update the progress bar
 	writer := &progressWriter{
-		writer: wr,
+		writer: io.MultiWriter(helper.LimitWriter(ctx, helper.ContextWriter(ctx, wr), job.Limiter), h),
 		bar:    progress,
 	}
 	// Copy files with progress size
-	_, err = nfs4.ReadFile(srcfile, 0, uint64(fileSize), writer)
+	_, err = fsys.ReadFile(srcfile, 0, writer)
 	if err != nil {
 		return fmt.Errorf("failed to read remote file: %w", err)
 	}
 
-	progress.Finish()
+	progress.Finish(h.Sum(nil))
 	return nil
 }
 
 // createDirIfNotExist will check if folder does not exist and automatically creates it.
-func createDirIfNotExist(path string) error {
+// It reports whether the folder was created.
+func createDirIfNotExist(path string) (bool, error) {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		if err = os.MkdirAll(path, os.ModePerm); err != nil {
-			return err
+			return false, err
 		}
-		return err
+		return true, nil
 	}
-	return nil
+	return false, nil
 }
 
 // listFileAndFolders take a directory path and returns a slice containng files and another containing folders
-func getFolderAndFileList(nfs4 nfs4.NfsInterface, remotePath string) ([]string, []string, error) {
+// along with the total size of the files, leaving out the files and folders whose name is excluded
+func getFolderAndFileList(ctx context.Context, fsys remote.FS, remotePath string, exclude func(name string) bool) ([]string, []string, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, 0, err
+	}
 
-	entries, err := nfs4.GetFileList(remotePath)
+	entries, err := fsys.ReadDir(remotePath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to retrieve remote file list: %w", err)
+		return nil, nil, 0, fmt.Errorf("failed to retrieve remote file list: %w", err)
 	}
 
 	var folders []string
 	var files []string
+	var size int64
 
 	for _, entry := range entries {
-		if entry.IsDir {
+		if exclude(entry.Name) {
+			continue
+		}
+		if entry.IsDir() {
 			// Add folder to the list
-			subfolders, subfiles, err := getFolderAndFileList(nfs4, remotePath+"/"+entry.Name)
+			subfolders, subfiles, subSize, err := getFolderAndFileList(ctx, fsys, remotePath+"/"+entry.Name, exclude)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, 0, err
 			}
 
 			folders = append(folders, subfolders...)
 			files = append(files, subfiles...)
+			size += subSize
 			folders = append(folders, remotePath+"/"+entry.Name)
 		} else {
 			// Add file to the list
 			files = append(files, remotePath+"/"+entry.Name)
+			size += entry.Size
 		}
 	}
 
-	return folders, files, nil
+	return folders, files, size, nil
 }
 
 // isDir takes a path strings and check the attributes if givin path
 // is a dirctory or not
-func isDirectory(nfs4 nfs4.NfsInterface, remotePath string) bool {
-	fileInfo, _ := nfs4.GetFileInfo(remotePath)
-	return fileInfo.IsDir
+func isDirectory(fsys remote.FS, remotePath string) bool {
+	fileInfo, err := fsys.Stat(remotePath)
+	return err == nil && fileInfo.IsDir()
 }
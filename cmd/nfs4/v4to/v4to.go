@@ -2,28 +2,26 @@ package v4to
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 
-	"github.com/kha7iq/go-nfs-client/nfs4"
 	"github.com/kha7iq/ncp/internal/helper"
-	"github.com/schollz/progressbar/v3"
+	"github.com/kha7iq/ncp/internal/remote"
 	"github.com/urfave/cli/v2"
 )
 
 type nfsConfg struct {
 	inputPath      string
-	nfsHost        string
 	nfsMountFolder string
-	nfsServerPort  string
+	cfg            remote.Config
 }
 
 type progressReader struct {
 	reader io.Reader
-	bar    *progressbar.ProgressBar
+	bar    *helper.FileProgress
 }
 
 func (pr *progressReader) Read(p []byte) (n int, err error) {
@@ -32,108 +30,92 @@ func (pr *progressReader) Read(p []byte) (n int, err error) {
 	return n, err
 }
 
-// ToServer function provides functionaltiy to transfer files or folders from local filesystem to NFS server.
-func ToServerV4() *cli.Command {
-	var nc nfsConfg
-	return &cli.Command{
-		Name:      "v4to",
-		Usage:     "The 'v4to' command is used to copy files or folders from the local machine to NFS v4 server.",
-		UsageText: "ncp v4to --host 192.168.0.80 --nfspath data --input src",
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Destination: &nc.inputPath,
-				Name:        "input",
-				Required:    true,
-				Aliases:     []string{"i"},
-				Usage:       "Input refers to the specific location of a folder or file that will be transferred.",
-			},
-
-			&cli.StringFlag{
-				Destination: &nc.nfsHost,
-				Name:        "host",
-				Aliases:     []string{"t"},
-				Required:    true,
-				Usage:       "IP address or hostname that can be used to access the NFS server.",
-			},
-			&cli.StringFlag{
-				Destination: &nc.nfsMountFolder,
-				Required:    true,
-				Name:        "nfspath",
-				Aliases:     []string{"p"},
-				Usage:       "NFS path denotes the destination directory on the NFS server where files will be copied to.",
-			},
-			&cli.StringFlag{
-				Destination: &nc.nfsServerPort,
-				Name:        "port",
-				Aliases:     []string{"pr"},
-				Usage:       "NFS server port, if other then default.",
-				Value:       "2049",
-			},
-		},
-		Action: func(ctx *cli.Context) error {
-			truncate := ctx.Bool("turncate")
-			u := ctx.Int("uid")
-			g := ctx.Int("gid")
-			uid, gid := helper.CheckUID(u, g)
-			// context for nfs4 client
-			ctxx := context.Background()
-			hostNameLocal, _ := os.Hostname()
-
-			nfs4, err := nfs4.NewNfsClient(ctxx, nc.nfsHost+":"+nc.nfsServerPort, nfs4.AuthParams{
-				MachineName: hostNameLocal,
-				Uid:         uid,
-				Gid:         gid,
-			})
-			if err != nil {
-				return err
-			}
-			defer nfs4.Close()
+// Upload copies input, a file or a folder, into the folder nfsPath of the server
+// in cfg over NFS v4. It does the work of 'put', and of its 'v4to' alias, when NFS v4 is used.
+func Upload(ctx *cli.Context, cfg remote.Config, nfsPath, input string) error {
+	// nfsPath is a server path already
+	cfg.Root, cfg.Export = "", ""
+	nc := nfsConfg{inputPath: input, nfsMountFolder: nfsPath, cfg: cfg}
+	return nc.upload(ctx)
+}
 
-			_, err = helper.IsPathValid(nc.inputPath)
-			if err != nil {
-				log.Fatalf("input path error: %v", err)
-			}
+func (nc *nfsConfg) upload(ctx *cli.Context) error {
+	job, err := helper.NewJob(ctx)
+	if err != nil {
+		return err
+	}
+	job.Source, job.Destination = nc.inputPath, nc.nfsMountFolder
+	cfg := nc.cfg
+	jobCtx, cancel := helper.JobContext(ctx)
+	defer cancel()
+	job.Start()
+	// Every worker gets its own connection, file data is spread over the
+	// --nconnect connections of the worker.
+	workers := make([]remote.FS, 0, job.Parallel)
+	for len(workers) < job.Parallel {
+		fsys, err := remote.Dial(jobCtx, cfg, nc.nfsMountFolder)
+		if err != nil {
+			return job.Fail(jobCtx, err)
+		}
+		defer fsys.Close()
+		workers = append(workers, fsys)
+	}
+	fsys := workers[0]
 
-			basePath := filepath.Dir(nc.inputPath)
-			folders, files, err := getFolderAndFileList(nc.inputPath, "")
-			if err != nil {
-				log.Fatalf("unable to get list of files and folders %v", err)
-			}
-			if isDirectory(nc.inputPath) {
-
-				for _, v := range folders {
-					targetDir := nc.nfsMountFolder + "/" + v
-					err = nfs4.MakePath(targetDir)
-					if err != nil {
-						return err // But return all other errors
-					}
-				}
-				for _, sourcFile := range files {
-					targetfile := nc.nfsMountFolder + "/" + sourcFile
-					sf := filepath.Join(basePath, sourcFile)
-					// Copy file to destination
-					if err = transferFile(nfs4, sf, targetfile, truncate); err != nil {
-						log.Fatalf("fail to transfer files %v", err)
-					}
-				}
-			} else {
-				nfs4.MakePath(nc.nfsMountFolder)
-				for _, sourcFile := range files {
-					targetfile := nc.nfsMountFolder + "/" + sourcFile
-					sf := filepath.Join(basePath, sourcFile)
-					// Copy file to destination
-					if err = transferFile(nfs4, sf, targetfile, truncate); err != nil {
-						log.Fatalf("fail to transfer files %v", err)
-					}
-				}
+	_, err = helper.IsPathValid(nc.inputPath)
+	if err != nil {
+		return job.Fail(jobCtx, fmt.Errorf("input path error: %w", err))
+	}
+
+	basePath := filepath.Dir(nc.inputPath)
+	folders, files, err := getFolderAndFileList(jobCtx, nc.inputPath, "", job.Excluded)
+	if err != nil {
+		return job.Fail(jobCtx, fmt.Errorf("unable to get list of files and folders: %w", err))
+	}
+	sourceFiles := make([]string, len(files))
+	for i, f := range files {
+		sourceFiles[i] = filepath.Join(basePath, f)
+	}
+	totalBytes := helper.LocalSize(sourceFiles)
+	if !ctx.Bool("no-space-check") {
+		if err := remote.CheckSpace(jobCtx, cfg, nc.nfsMountFolder, totalBytes); err != nil {
+			return job.Fail(jobCtx, err)
+		}
+	}
+	if isDirectory(nc.inputPath) {
+
+		for _, v := range folders {
+			targetDir := nc.nfsMountFolder + "/" + filepath.ToSlash(v)
+			if err := remote.MkdirAll(fsys, targetDir, os.ModePerm, job.DirCreated); err != nil {
+				return job.Fail(jobCtx, err)
 			}
-			return nil
-		},
+		}
+	} else if err := remote.MkdirAll(fsys, nc.nfsMountFolder, os.ModePerm, job.DirCreated); err != nil {
+		return job.Fail(jobCtx, err)
+	}
+
+	completed, err := job.Transfer(jobCtx, files, totalBytes, func(ctx context.Context, slot int, sourcFile string) error {
+		targetfile := nc.nfsMountFolder + "/" + sourcFile
+		sf := filepath.Join(basePath, sourcFile)
+		// Copy file to destination
+		return transferFile(ctx, job, slot, workers[slot], sf, targetfile)
+	})
+	if err != nil {
+		if jobCtx.Err() != nil {
+			helper.PrintInterrupted(err, completed, len(files))
+			return err
+		}
+		return fmt.Errorf("fail to transfer files: %w", err)
 	}
+	return nil
 }
 
 // listFileAndFolders take a directory path and returns a slice containng files and another containing folders
-func getFolderAndFileList(path string, basePath string) ([]string, []string, error) {
+// leaving out the files and folders whose name is excluded
+func getFolderAndFileList(ctx context.Context, path string, basePath string, exclude func(name string) bool) ([]string, []string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
 	var folders []string
 	var files []string
 
@@ -159,13 +141,15 @@ func getFolderAndFileList(path string, basePath string) ([]string, []string, err
 		return nil, nil, err
 	}
 	for _, contentPath := range contents {
+		if exclude(filepath.Base(contentPath)) {
+			continue
+		}
 		// Check if the content is a directory
 		isDir := isDirectory(contentPath)
 		if isDir {
-			subfolderFolders, subfolderFiles, err := getFolderAndFileList(contentPath, filepath.Join(basePath, folderName))
+			subfolderFolders, subfolderFiles, err := getFolderAndFileList(ctx, contentPath, filepath.Join(basePath, folderName), exclude)
 			if err != nil {
-				log.Fatalf("unable to get list %v", err)
-				continue
+				return nil, nil, err
 			}
 
 			folders = append(folders, subfolderFolders...)
@@ -179,12 +163,13 @@ func getFolderAndFileList(path string, basePath string) ([]string, []string, err
 	return folders, files, nil
 }
 
-// transferFile will take a source and target file path along with *nfs4.NfsClient to transfer file
-func transferFile(nfs4 *nfs4.NfsClient, srcfile string, targetfile string, turnication bool) error {
+// transferFile will take a source and target file path along with the connection of the worker to transfer file.
+// A partially written target is removed on failure unless the job keeps partial files.
+func transferFile(ctx context.Context, job *helper.Job, slot int, fsys remote.FS, srcfile string, targetfile string) (err error) {
 	var filePath string
 	sourceFile, err := os.Open(srcfile)
 	if err != nil {
-		log.Fatalf("error opening source file: %s", err.Error())
+		return fmt.Errorf("error opening source file: %w", err)
 	}
 	defer sourceFile.Close()
 
@@ -195,28 +180,37 @@ func transferFile(nfs4 *nfs4.NfsClient, srcfile string, targetfile string, turni
 	}
 	fileSize := fileInfo.Size()
 
-	if !turnication {
+	if !job.Truncate {
 		filePath = srcfile
 	} else {
 		filePath = helper.TruncateFileName(srcfile)
 	}
 	// Create a progress bar based on the file size
-	bar := helper.ProgressBar(fileSize, filePath, helper.CheckMark())
-	// bar := progressbar.DefaultBytes(fileSize, "Copying")
+	bar := job.Progress.File(slot, targetfile, fileSize, filePath)
+
+	// Calculate the ShaSum while reading
+	h := sha256.New()
 
 	// Create a progress reader that wraps the source file reader
 	reader := &progressReader{
-		reader: sourceFile,
+		reader: io.TeeReader(helper.LimitReader(ctx, helper.ContextReader(ctx, sourceFile), job.Limiter), h),
 		bar:    bar,
 	}
+	defer func() {
+		if err != nil && !job.KeepPartial {
+			fsys.Remove(targetfile)
+		}
+	}()
 
-	// Call the nfs4.WriteFile function with the correct arguments
-	_, err = nfs4.WriteFile(targetfile, true, 0, reader)
+	written, err := fsys.WriteFile(targetfile, remote.FileMode, reader)
 	if err != nil {
-		return fmt.Errorf("failed to create destination file: %w", err)
+		return fmt.Errorf("failed to write destination file: %w", err)
+	}
+	if written != fileSize {
+		return fmt.Errorf("short write to %s: wrote %d of %d bytes", targetfile, written, fileSize)
 	}
 
-	bar.Finish()
+	bar.Finish(h.Sum(nil))
 
 	return nil
 }
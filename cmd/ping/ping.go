@@ -0,0 +1,157 @@
+package ping
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/probe"
+	"github.com/urfave/cli/v2"
+)
+
+type pingConfg struct {
+	count    int
+	interval time.Duration
+	version  string
+	port     string
+}
+
+// Ping function provides functionaltiy to measure the round trip time to the NFS service of a server.
+func Ping() *cli.Command {
+	var pc pingConfg
+	return &cli.Command{
+		Name:      "ping",
+		Usage:     "The 'ping' command sends NFS NULL calls to a server and reports the round trip times.",
+		UsageText: "ncp ping -c 10 192.168.0.80",
+		ArgsUsage: "HOST",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Destination: &pc.count,
+				Name:        "count",
+				Aliases:     []string{"c"},
+				Value:       5,
+				Usage:       "Number of calls per NFS version, 0 keeps going until Ctrl-C.",
+			},
+			&cli.DurationFlag{
+				Destination: &pc.interval,
+				Name:        "interval",
+				Aliases:     []string{"i"},
+				Value:       time.Second,
+				Usage:       "Time between calls.",
+			},
+			&cli.StringFlag{
+				Destination: &pc.version,
+				Name:        "nfs-version",
+				Value:       "all",
+				Usage:       "NFS version to ping: 3, 4 or all.",
+			},
+			&cli.StringFlag{
+				Destination: &pc.port,
+				Name:        "port",
+				Aliases:     []string{"pr"},
+				Value:       "2049",
+				Usage:       "NFS server port, if other then default.",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 1 {
+				return fmt.Errorf("expected the host of the NFS server")
+			}
+			host := ctx.Args().First()
+			versions := []string{"3", "4"}
+			switch pc.version {
+			case "all":
+			case "3", "4":
+				versions = []string{pc.version}
+			default:
+				return fmt.Errorf("unsupported NFS version %q, expected 3, 4 or all", pc.version)
+			}
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			stats := pc.run(jobCtx, host, versions, ctx.Duration("io-timeout"))
+
+			if ctx.String("output") == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				for _, s := range stats {
+					enc.Encode(s)
+				}
+			} else {
+				fmt.Printf("\n--- %s NFS ping statistics ---\n", host)
+				for _, s := range stats {
+					fmt.Printf("v%s: %d calls, %d answered, %.0f%% lost", s.Version, s.Sent, s.Received, s.Loss())
+					if s.Received > 0 {
+						fmt.Printf(", rtt min/avg/max/stddev = %s/%s/%s/%s", ms(s.Min), ms(s.Avg()), ms(s.Max), ms(s.StdDev()))
+					}
+					fmt.Println()
+				}
+			}
+			for _, s := range stats {
+				if s.Received == 0 {
+					return cli.Exit("", 1)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// run pings every version in turn until count rounds are done or ctx ends. A
+// connection that fails is dialed again for the next round.
+func (pc *pingConfg) run(ctx context.Context, host string, versions []string, ioTimeout time.Duration) []*probe.Stats {
+	stats := make([]*probe.Stats, len(versions))
+	pingers := make([]probe.Pinger, len(versions))
+	for i, v := range versions {
+		stats[i] = &probe.Stats{Version: v}
+	}
+	defer func() {
+		for _, p := range pingers {
+			if p != nil {
+				p.Close()
+			}
+		}
+	}()
+
+	for seq := 1; pc.count <= 0 || seq <= pc.count; seq++ {
+		if seq > 1 {
+			select {
+			case <-ctx.Done():
+				return stats
+			case <-time.After(pc.interval):
+			}
+		}
+		for i, v := range versions {
+			if ctx.Err() != nil {
+				return stats
+			}
+			if pingers[i] == nil {
+				p, err := probe.DialNull(ctx, host, pc.port, v, ioTimeout)
+				if err != nil {
+					stats[i].Lost()
+					fmt.Fprintf(os.Stderr, "v%s seq=%d: %v\n", v, seq, err)
+					continue
+				}
+				pingers[i] = p
+			}
+			start := time.Now()
+			if err := pingers[i].Null(); err != nil {
+				stats[i].Lost()
+				fmt.Fprintf(os.Stderr, "v%s seq=%d: %v\n", v, seq, err)
+				pingers[i].Close()
+				pingers[i] = nil
+				continue
+			}
+			rtt := time.Since(start)
+			stats[i].Add(rtt)
+			fmt.Fprintf(os.Stderr, "v%s seq=%d time=%s\n", v, seq, ms(rtt))
+		}
+	}
+	return stats
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.3f ms", float64(d)/float64(time.Millisecond))
+}
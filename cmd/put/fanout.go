@@ -0,0 +1,411 @@
+package put
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+// Every destination of a file gets fanOutBuffers buffers of fanOutBufferSize
+// bytes, so a slow server only holds back the others once they are full.
+const (
+	fanOutBuffers    = 8
+	fanOutBufferSize = 1 << 20
+)
+
+// Target is a destination of a fan-out upload.
+type Target struct {
+	Config remote.Config
+	Path   string
+	// Dir is set when the sources go into the folder Path even when it does
+	// not exist yet.
+	Dir bool
+}
+
+// fanFile is a local file of a fan-out upload, "-" for stdin. rel is its path
+// inside the destination folder.
+type fanFile struct {
+	local string
+	rel   string
+	size  int64
+}
+
+// destination is a Target during a fan-out upload. A destination that fails is
+// dropped for the rest of the job while the others go on.
+type destination struct {
+	Target
+	name string
+	into bool
+	fsys []remote.FS
+
+	mu    sync.Mutex
+	err   error
+	files int
+	bytes int64
+}
+
+// FanOut uploads srcs, local files, folders or - for stdin, to every target at
+// once. Each file is read once and written to the targets concurrently, then
+// read back from each of them when the job verifies. The destination rules are
+// the ones of cp, folders go into a target under their own name. A failed
+// target does not stop the others, a summary per target is printed at the end.
+func FanOut(ctx *cli.Context, srcs []string, targets []Target) error {
+	job, err := helper.NewJob(ctx)
+	if err != nil {
+		return err
+	}
+	hosts := make([]string, len(targets))
+	dests := make([]*destination, len(targets))
+	for i, t := range targets {
+		hosts[i] = t.Config.Host
+		dests[i] = &destination{Target: t, name: t.Config.Host + ":" + remote.Clean(t.Path)}
+	}
+	job.Host, job.Source = strings.Join(hosts, ","), strings.Join(srcs, " ")
+	job.Destination = remote.Clean(targets[0].Path)
+
+	jobCtx, cancel := helper.JobContext(ctx)
+	defer cancel()
+	job.Start()
+	files, dirs, total, into, err := fanOutFiles(job, srcs)
+	if err != nil {
+		return job.Fail(jobCtx, err)
+	}
+	live := 0
+	for _, d := range dests {
+		defer d.close()
+		if err := d.open(ctx, jobCtx, job, into, files, dirs, total); err != nil {
+			if len(dests) == 1 {
+				return job.Fail(jobCtx, err)
+			}
+			d.fail(err)
+			fmt.Fprintf(os.Stderr, "%s: %s: %v\n", job.Command, d.name, err)
+			continue
+		}
+		live++
+	}
+	if live == 0 {
+		return job.Fail(jobCtx, fmt.Errorf("no destination could be opened"))
+	}
+
+	names := make([]string, len(files))
+	byName := make(map[string]fanFile, len(files))
+	for i, f := range files {
+		names[i], byName[f.rel] = f.rel, f
+	}
+	completed, err := job.Transfer(jobCtx, names, total, func(ctx context.Context, slot int, name string) error {
+		return fanOutFile(ctx, job, slot, byName[name], dests)
+	})
+	printDestinations(job, dests)
+	if err != nil {
+		if jobCtx.Err() != nil {
+			helper.PrintInterrupted(err, completed, len(files))
+		}
+		return err
+	}
+	for _, d := range dests {
+		if d.failed() != nil {
+			return cli.Exit("", 1)
+		}
+	}
+	return nil
+}
+
+// fanOutFiles lists the files of srcs with their size and the folders to
+// create. into is set when the sources have to go into the targets, which is
+// the case for several sources and for folders.
+func fanOutFiles(job *helper.Job, srcs []string) (files []fanFile, dirs []string, total int64, into bool, err error) {
+	into = len(srcs) > 1
+	for _, src := range srcs {
+		if src == "-" {
+			if len(srcs) > 1 {
+				return nil, nil, 0, false, fmt.Errorf("stdin can not be uploaded along with other sources")
+			}
+			// Data piped in has no size, the progress shows a spinner for it
+			return []fanFile{{local: "-", rel: "stdin", size: -1}}, nil, -1, false, nil
+		}
+		info, err := os.Stat(src)
+		if err != nil {
+			return nil, nil, 0, false, err
+		}
+		if !info.IsDir() {
+			files = append(files, fanFile{local: src, rel: filepath.Base(src), size: info.Size()})
+			total += info.Size()
+			continue
+		}
+		into = true
+		root := filepath.Clean(src)
+		err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if p != root && job.Excluded(info.Name()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// Files behind a symbolic link are copied, like the other uploads do
+			if info.Mode()&os.ModeSymlink != 0 {
+				if target, err := os.Stat(p); err == nil && target.Mode().IsRegular() {
+					info = target
+				}
+			}
+			rel, _ := filepath.Rel(root, p)
+			rel = path.Join(filepath.Base(root), filepath.ToSlash(rel))
+			switch {
+			case info.IsDir():
+				dirs = append(dirs, rel)
+			case info.Mode().IsRegular():
+				files = append(files, fanFile{local: p, rel: rel, size: info.Size()})
+				total += info.Size()
+			default:
+				fmt.Fprintf(os.Stderr, "%s: skipping %s, it is not a regular file\n", job.Command, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, 0, false, err
+		}
+	}
+	return files, dirs, total, into, nil
+}
+
+// open connects every worker to d and creates the folders of the upload on it.
+func (d *destination) open(ctx *cli.Context, jobCtx context.Context, job *helper.Job, into bool, files []fanFile, dirs []string, total int64) error {
+	// Every worker gets its own connection, the NFS v4 client is not safe for
+	// concurrent use
+	for len(d.fsys) < job.Parallel {
+		fsys, err := remote.Dial(jobCtx, d.Config, d.Path)
+		if err != nil {
+			return err
+		}
+		d.fsys = append(d.fsys, fsys)
+	}
+	fsys := d.fsys[0]
+	info, err := fsys.Stat(d.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	exists := err == nil
+	d.into = into || d.Dir || (exists && info.IsDir())
+	switch {
+	case exists && !info.IsDir() && d.into:
+		return fmt.Errorf("%s is not a folder", d.Path)
+	case d.into && len(files) == 1 && files[0].local == "-":
+		return fmt.Errorf("%s is a folder, stdin needs a file name", d.Path)
+	}
+
+	dir := d.Path
+	if !d.into {
+		dir = path.Dir(d.Path)
+	}
+	if err := remote.MkdirAll(fsys, dir, 0o755, job.DirCreated); err != nil {
+		return err
+	}
+	for _, rel := range dirs {
+		if err := remote.MkdirAll(fsys, path.Join(d.Path, rel), 0o755, job.DirCreated); err != nil {
+			return err
+		}
+	}
+	if total > 0 && !ctx.Bool("no-space-check") {
+		return remote.CheckSpace(jobCtx, d.Config, dir, total)
+	}
+	return nil
+}
+
+func (d *destination) close() {
+	for _, fsys := range d.fsys {
+		fsys.Close()
+	}
+}
+
+// target returns the path of f on d.
+func (d *destination) target(f fanFile) string {
+	if d.into {
+		return path.Join(d.Path, f.rel)
+	}
+	return d.Path
+}
+
+func (d *destination) failed() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+func (d *destination) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// failFile drops d after f failed on it. The partial file is removed unless
+// the job keeps partial files.
+func (d *destination) failFile(job *helper.Job, slot int, f fanFile, err error) {
+	d.fail(err)
+	fmt.Fprintf(os.Stderr, "%s: %s: %v, no more files are written to it\n", job.Command, d.name, err)
+	if !job.KeepPartial {
+		d.fsys[slot].Remove(d.target(f))
+	}
+}
+
+func (d *destination) done(n int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.files++
+	d.bytes += n
+}
+
+// fanOutFile reads f once and writes it to every destination still in the job,
+// each through its own pipe so they write at the same time. It fails only when
+// f could not be read or no destination took it.
+func fanOutFile(ctx context.Context, job *helper.Job, slot int, f fanFile, dests []*destination) error {
+	var live []*destination
+	for _, d := range dests {
+		if d.failed() == nil {
+			live = append(live, d)
+		}
+	}
+	if len(live) == 0 {
+		return helper.ErrAllFailed
+	}
+
+	var src io.Reader = os.Stdin
+	displayName := "stdin"
+	if f.local != "-" {
+		file, err := os.Open(f.local)
+		if err != nil {
+			return fmt.Errorf("error opening source file: %w", err)
+		}
+		defer file.Close()
+		src, displayName = file, f.local
+	}
+	if job.Truncate {
+		displayName = helper.TruncateFileName(displayName)
+	}
+	progress := job.Progress.File(slot, f.rel, f.size, displayName)
+
+	writers := make([]io.Writer, len(live))
+	pipes := make([]*helper.PipeWriter, len(live))
+	written := make([]int64, len(live))
+	writeErrs := make([]error, len(live))
+	var wg sync.WaitGroup
+	for i, d := range live {
+		pr, pw := helper.Pipe(fanOutBuffers, fanOutBufferSize)
+		writers[i], pipes[i] = pw, pw
+		wg.Add(1)
+		go func(i int, d *destination) {
+			defer wg.Done()
+			written[i], writeErrs[i] = d.fsys[slot].WriteFile(d.target(f), remote.FileMode, pr)
+			// Stops the writes to this destination when it failed
+			pr.Close()
+		}(i, d)
+	}
+	fan := helper.NewFanOut(writers...)
+	h := sha256.New()
+	_, copyErr := io.Copy(io.MultiWriter(fan, h, progress), helper.LimitReader(ctx, helper.ContextReader(ctx, src), job.Limiter))
+	readErr := copyErr
+	if errors.Is(copyErr, helper.ErrAllFailed) {
+		readErr = nil
+	}
+	for _, pw := range pipes {
+		pw.CloseWithError(readErr)
+	}
+	wg.Wait()
+	if readErr != nil {
+		// The source failed, not the destinations
+		for _, d := range live {
+			if !job.KeepPartial {
+				d.fsys[slot].Remove(d.target(f))
+			}
+		}
+		return fmt.Errorf("error reading %s: %w", displayName, readErr)
+	}
+
+	expectedSum := h.Sum(nil)
+	ok := make([]bool, len(live))
+	for i, d := range live {
+		wg.Add(1)
+		go func(i int, d *destination) {
+			defer wg.Done()
+			target := d.target(f)
+			switch {
+			case writeErrs[i] != nil:
+				d.failFile(job, slot, f, fmt.Errorf("error writing %s: %w", target, writeErrs[i]))
+				return
+			case fan.Err(i) != nil:
+				d.failFile(job, slot, f, fmt.Errorf("error writing %s: the server stopped reading", target))
+				return
+			}
+			if job.Verify {
+				h := sha256.New()
+				if _, err := d.fsys[slot].ReadFile(target, 0, helper.LimitWriter(ctx, helper.ContextWriter(ctx, h), job.Limiter)); err != nil {
+					d.failFile(job, slot, f, fmt.Errorf("error reading %s for verification: %w", target, err))
+					return
+				}
+				if actualSum := h.Sum(nil); !bytes.Equal(actualSum, expectedSum) {
+					d.failFile(job, slot, f, fmt.Errorf("verification of %s failed: actual SHA=%x expected SHA=%x", target, actualSum, expectedSum))
+					return
+				}
+			}
+			d.done(written[i])
+			ok[i] = true
+		}(i, d)
+	}
+	wg.Wait()
+	for _, o := range ok {
+		if o {
+			progress.Finish(expectedSum)
+			return nil
+		}
+	}
+	// The job reports the error of a lone destination itself
+	if len(dests) == 1 {
+		return dests[0].failed()
+	}
+	return helper.ErrAllFailed
+}
+
+// printDestinations writes the outcome of every destination below the summary
+// of the job. A single destination has the outcome of the job.
+func printDestinations(job *helper.Job, dests []*destination) {
+	if job.Output.Progress == helper.ProgressNone || len(dests) == 1 {
+		return
+	}
+	width := 0
+	for _, d := range dests {
+		if len(d.name) > width {
+			width = len(d.name)
+		}
+	}
+	w := job.Output.Writer
+	fmt.Fprintf(w, "  Destinations:\n")
+	for _, d := range dests {
+		status, detail := "ok", ""
+		if err := d.failed(); err != nil {
+			status, detail = "failed", ": "+err.Error()
+		}
+		if job.Output.Color {
+			if status == "ok" {
+				status = "\033[32m" + status + "\033[0m"
+			} else {
+				status = "\033[31m" + status + "\033[0m"
+			}
+		}
+		fmt.Fprintf(w, "    %-*s %s, %d files, %s%s\n", width, d.name, status, d.files, helper.FormatBytes(d.bytes), detail)
+	}
+}
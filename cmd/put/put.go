@@ -0,0 +1,209 @@
+package put
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/kha7iq/ncp/cmd/nfs3/to"
+	"github.com/kha7iq/ncp/cmd/nfs4/v4to"
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type putConfg struct {
+	nfsPath string
+	input   string
+}
+
+// Put function provides functionaltiy to upload files, folders or stdin to the NFS server over the NFS version the server offers, or to several servers at once.
+func Put() *cli.Command {
+	var pc putConfg
+	return &cli.Command{
+		Name:  "put",
+		Usage: "The 'put' command uploads files or folders with --input, or stdin, to the NFS server over NFS v4 or v3.",
+		UsageText: "ncp put --host 192.168.0.80 --nfspath data --input src\n" +
+			"   pg_dump db | ncp put --host 192.168.0.80 --nfspath backups/db.sql -\n" +
+			"   ncp put --host filer-eu --host filer-us --host filer-ap --nfspath releases --input dist",
+		ArgsUsage: "[- | file]",
+		Flags: append(remote.FanOutFlags(),
+			&cli.StringFlag{
+				Destination: &pc.nfsPath,
+				Name:        "nfspath",
+				Aliases:     []string{"p", "path"},
+				Required:    true,
+				Usage:       "Destination folder of --input on the NFS server, or the path of the file for stdin and a single file argument.",
+			},
+			&cli.StringFlag{
+				Destination: &pc.input,
+				Name:        "input",
+				Aliases:     []string{"i"},
+				Usage:       "File or folder copied, with its sub folders, into --nfspath.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			if pc.input != "" && ctx.NArg() != 0 {
+				return fmt.Errorf("use either --input or a file argument")
+			}
+			if pc.input == "" && ctx.NArg() != 1 {
+				return fmt.Errorf("expected --input, - for stdin or a file to upload")
+			}
+			cfgs, err := remote.NewConfigs(ctx)
+			if err != nil {
+				return err
+			}
+			if len(cfgs) > 1 {
+				src := pc.input
+				if src == "" {
+					src = ctx.Args().First()
+				}
+				targets := make([]Target, len(cfgs))
+				for i, cfg := range cfgs {
+					targets[i] = Target{Config: cfg, Path: pc.nfsPath, Dir: pc.input != ""}
+				}
+				return FanOut(ctx, []string{src}, targets)
+			}
+			cfg := cfgs[0]
+			if pc.input != "" {
+				return Upload(ctx, cfg, pc.nfsPath, pc.input)
+			}
+			return Stream(ctx, cfg, ctx.Args().First(), pc.nfsPath)
+		},
+	}
+}
+
+// Alias function provides functionaltiy to keep the older upload commands, such as 'to' and 'v4to', as 'put' with the NFS version fixed.
+func Alias(name, version string) *cli.Command {
+	cmd := Put()
+	cmd.Name = name
+	cmd.Usage = fmt.Sprintf("The '%s' command is 'put --nfs-version %s', it uploads files or folders to the NFS server.", name, version)
+	cmd.UsageText = fmt.Sprintf("ncp %s --host 192.168.0.80 --nfspath data --input src", name)
+	remote.PinVersion(cmd, version)
+	return cmd
+}
+
+// Upload copies input, a file or a folder, into the folder nfsPath on the server
+// in cfg with the transfer of the NFS version in cfg.
+func Upload(ctx *cli.Context, cfg remote.Config, nfsPath, input string) error {
+	if cfg.Version == "4" {
+		return v4to.Upload(ctx, cfg, cfg.Abs(nfsPath), input)
+	}
+	return to.Upload(ctx, cfg, cfg.Abs(nfsPath), input)
+}
+
+// Stream uploads arg, a file or - for stdin, to nfsPath on the server in cfg.
+// When nfsPath is an existing folder the file is uploaded into it, missing
+// parent folders are created.
+func Stream(ctx *cli.Context, cfg remote.Config, arg, nfsPath string) error {
+	job, err := helper.NewJob(ctx)
+	if err != nil {
+		return err
+	}
+
+	name := "stdin"
+	if arg != "-" {
+		name = arg
+	}
+	target := remote.Clean(nfsPath)
+	job.Source, job.Destination = name, target
+	jobCtx, cancel := helper.JobContext(ctx)
+	defer cancel()
+	job.Start()
+
+	// Data piped in has no size, the progress shows a spinner for it
+	var src io.Reader = os.Stdin
+	size := int64(-1)
+	if arg != "-" {
+		f, err := os.Open(arg)
+		if err != nil {
+			return job.Fail(jobCtx, err)
+		}
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil {
+			return job.Fail(jobCtx, err)
+		}
+		if stat.IsDir() {
+			return job.Fail(jobCtx, fmt.Errorf("%s is a folder, use --input for folders", arg))
+		}
+		src, size = f, stat.Size()
+	}
+
+	fsys, err := remote.Dial(jobCtx, cfg, path.Dir(target))
+	if err != nil {
+		return job.Fail(jobCtx, err)
+	}
+	defer fsys.Close()
+
+	info, err := fsys.Stat(target)
+	switch {
+	case err == nil && info.IsDir():
+		if name == "stdin" {
+			return job.Fail(jobCtx, fmt.Errorf("%s is a folder, stdin needs a file name", target))
+		}
+		target = path.Join(target, filepath.Base(name))
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return job.Fail(jobCtx, err)
+	case err != nil:
+		if err := remote.MkdirAll(fsys, path.Dir(target), 0o755, job.DirCreated); err != nil {
+			return job.Fail(jobCtx, err)
+		}
+	}
+	job.Destination = target
+	// The length of stdin is only known at the end
+	if size >= 0 && !ctx.Bool("no-space-check") {
+		if err := remote.CheckSpace(jobCtx, cfg, path.Dir(target), size); err != nil {
+			return job.Fail(jobCtx, err)
+		}
+	}
+
+	_, err = job.Transfer(jobCtx, []string{target}, size, func(ctx context.Context, slot int, file string) error {
+		return uploadStream(ctx, job, slot, fsys, src, name, size, file)
+	})
+	return err
+}
+
+// uploadStream writes r to targetfile while hashing it, then reads the file
+// back to verify the sum. A partial file is removed on failure unless the job
+// keeps partial files.
+func uploadStream(ctx context.Context, job *helper.Job, slot int, fsys remote.FS, r io.Reader, name string, size int64, targetfile string) (err error) {
+	displayName := name
+	if job.Truncate {
+		displayName = helper.TruncateFileName(name)
+	}
+	progress := job.Progress.File(slot, targetfile, size, displayName)
+
+	h := sha256.New()
+	t := io.TeeReader(io.TeeReader(helper.LimitReader(ctx, helper.ContextReader(ctx, r), job.Limiter), h), progress)
+	defer func() {
+		if err != nil && !job.KeepPartial {
+			fsys.Remove(targetfile)
+		}
+	}()
+	n, err := fsys.WriteFile(targetfile, remote.FileMode, t)
+	if err != nil {
+		return fmt.Errorf("error copying: n=%d, %w", n, err)
+	}
+	expectedSum := h.Sum(nil)
+	if !job.Verify {
+		progress.Finish(expectedSum)
+		return nil
+	}
+
+	h = sha256.New()
+	if _, err := fsys.ReadFile(targetfile, 0, helper.LimitWriter(ctx, helper.ContextWriter(ctx, h), job.Limiter)); err != nil {
+		return fmt.Errorf("error reading target file for verification: %w", err)
+	}
+	if actualSum := h.Sum(nil); !bytes.Equal(actualSum, expectedSum) {
+		return fmt.Errorf("verification failed: actual SHA=%x expected SHA=%x", actualSum, expectedSum)
+	}
+	progress.Finish(expectedSum)
+	return nil
+}
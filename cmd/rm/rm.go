@@ -0,0 +1,145 @@
+package rm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type rmConfg struct {
+	recursive bool
+	force     bool
+	dryRun    bool
+	verbose   bool
+}
+
+// Remove function provides functionaltiy to delete files and folders on the NFS server.
+func Remove() *cli.Command {
+	var rc rmConfg
+	return &cli.Command{
+		Name:      "rm",
+		Usage:     "The 'rm' command deletes files or folders on the NFS server.",
+		UsageText: "ncp rm --host 192.168.0.80 -r /data/src/old",
+		Flags: append(remote.Flags(),
+			&cli.BoolFlag{
+				Destination: &rc.recursive,
+				Name:        "recursive",
+				Aliases:     []string{"r"},
+				Usage:       "Delete folders and their contents.",
+			},
+			&cli.BoolFlag{
+				Destination: &rc.force,
+				Name:        "force",
+				Aliases:     []string{"f"},
+				Usage:       "Ignore missing files and never ask for confirmation.",
+			},
+			&cli.BoolFlag{
+				Destination: &rc.dryRun,
+				Name:        "dry-run",
+				Usage:       "Print what would be deleted without deleting anything.",
+			},
+			&cli.BoolFlag{
+				Destination: &rc.verbose,
+				Name:        "verbose",
+				Aliases:     []string{"v"},
+				Usage:       "Print every file and folder deleted.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() == 0 {
+				return fmt.Errorf("missing file to delete")
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			paths := ctx.Args().Slice()
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, remote.CommonDir(paths))
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			failed := false
+			for _, p := range paths {
+				if err := rc.remove(fsys, p); err != nil {
+					fmt.Fprintf(os.Stderr, "rm: %s: %v\n", p, err)
+					failed = true
+				}
+			}
+			if failed {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// remove deletes p, a folder is only deleted with its contents once the user
+// confirmed it.
+func (rc *rmConfg) remove(fsys remote.FS, p string) error {
+	if remote.Clean(p) == "/" {
+		return errors.New("refusing to delete the root")
+	}
+	info, err := fsys.Stat(p)
+	if err != nil {
+		if rc.force && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if !info.IsDir() {
+		return rc.apply(fsys, []*remote.FileInfo{info})
+	}
+	if !rc.recursive {
+		return errors.New("is a folder, use -r to delete it with its contents")
+	}
+
+	infos, err := remote.List(fsys, info.Path)
+	if err != nil {
+		return err
+	}
+	if rc.dryRun || rc.force {
+		return rc.apply(fsys, infos)
+	}
+	dirs := 0
+	for _, i := range infos {
+		if i.IsDir() {
+			dirs++
+		}
+	}
+	ok, err := helper.Confirm(fmt.Sprintf("Delete %s with %d files and %d folders?", info.Path, len(infos)-dirs, dirs-1))
+	if errors.Is(err, helper.ErrNotConfirmed) {
+		return fmt.Errorf("%w, use -f to delete without asking", err)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Fprintf(os.Stderr, "skipped %s\n", info.Path)
+		return nil
+	}
+	return rc.apply(fsys, infos)
+}
+
+// apply deletes infos, or only prints them on a dry run.
+func (rc *rmConfg) apply(fsys remote.FS, infos []*remote.FileInfo) error {
+	if rc.dryRun {
+		for i := len(infos) - 1; i >= 0; i-- {
+			fmt.Printf("would delete %s\n", infos[i].Path)
+		}
+		return nil
+	}
+	return remote.RemoveList(fsys, infos, func(info *remote.FileInfo) {
+		if rc.verbose {
+			fmt.Printf("deleted %s\n", info.Path)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package rpcinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/kha7iq/ncp/internal/probe"
+	"github.com/urfave/cli/v2"
+)
+
+// ShowPrograms function provides functionaltiy to list the RPC programs of a server like rpcinfo -p.
+func ShowPrograms() *cli.Command {
+	return &cli.Command{
+		Name:      "rpcinfo",
+		Usage:     "The 'rpcinfo' command lists the RPC programs and versions registered with the portmapper of a server.",
+		UsageText: "ncp rpcinfo 192.168.0.80",
+		ArgsUsage: "HOST",
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 1 {
+				return fmt.Errorf("expected the host of the NFS server")
+			}
+			programs, err := probe.Programs(ctx.Args().First(), ctx.Duration("io-timeout"))
+			if err != nil {
+				return err
+			}
+			if ctx.String("output") == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				for _, p := range programs {
+					enc.Encode(p)
+				}
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PROGRAM\tVERS\tPROTO\tPORT\tSERVICE")
+			for _, p := range programs {
+				fmt.Fprintf(w, "%d\t%d\t%s\t%d\t%s\n", p.Program, p.Version, p.Protocol, p.Port, p.Name)
+			}
+			w.Flush()
+			return nil
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package stat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+// StatFiles function provides functionaltiy to show the attributes of files on the NFS server.
+func StatFiles() *cli.Command {
+	return &cli.Command{
+		Name:      "stat",
+		Usage:     "The 'stat' command shows the attributes of files or folders on the NFS server.",
+		UsageText: "ncp stat --host 192.168.0.80 /data/src/file.txt",
+		Flags:     remote.Flags(),
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() == 0 {
+				return fmt.Errorf("missing path to stat")
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			paths := ctx.Args().Slice()
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, remote.CommonDir(paths))
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			var enc *json.Encoder
+			if ctx.String("output") == "json" {
+				enc = json.NewEncoder(os.Stdout)
+			}
+			failed := false
+			for _, p := range paths {
+				info, err := fsys.Stat(p)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "stat: %s: %v\n", p, err)
+					failed = true
+					continue
+				}
+				if enc != nil {
+					enc.Encode(info)
+					continue
+				}
+				printInfo(info)
+			}
+			if failed {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// printInfo prints the attributes in the layout of stat(1).
+func printInfo(info *remote.FileInfo) {
+	fmt.Printf("  File: %s\n", info.Path)
+	fmt.Printf("  Type: %-12s Size: %-12d Used: %d\n", info.Type, info.Size, info.Used)
+	fmt.Printf("  Mode: %04o (%s)\n", remote.UnixMode(info.Mode), info.Mode)
+	fmt.Printf(" Owner: %-12s Group: %s\n", info.Owner, info.Group)
+	fmt.Printf(" Links: %-12d FileID: %d\n", info.Nlink, info.FileID)
+	fmt.Printf("Access: %s\n", formatTime(info.Atime))
+	fmt.Printf("Modify: %s\n", formatTime(info.Mtime))
+	fmt.Printf("Change: %s\n", formatTime(info.Ctime))
+}
+
+func formatTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04:05.000000000 -0700")
+}
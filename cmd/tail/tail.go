@@ -0,0 +1,192 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type tailConfg struct {
+	nfsPath  string
+	lines    int
+	follow   bool
+	interval time.Duration
+}
+
+// Tail function provides functionaltiy to print the end of a file on the NFS server and follow it.
+func Tail() *cli.Command {
+	var tc tailConfg
+	return &cli.Command{
+		Name:      "tail",
+		Usage:     "The 'tail' command prints the last lines of a file on the NFS server and can follow it as it grows.",
+		UsageText: "ncp tail --host 192.168.0.80 --nfspath logs/app.log -n 50 -f",
+		Flags: append(remote.Flags(),
+			&cli.StringFlag{
+				Destination: &tc.nfsPath,
+				Name:        "nfspath",
+				Aliases:     []string{"p"},
+				Required:    true,
+				Usage:       "Path of the file on the NFS server.",
+			},
+			&cli.IntFlag{
+				Destination: &tc.lines,
+				Name:        "lines",
+				Aliases:     []string{"n"},
+				Value:       10,
+				Usage:       "Number of lines to print.",
+			},
+			&cli.BoolFlag{
+				Destination: &tc.follow,
+				Name:        "follow",
+				Aliases:     []string{"f"},
+				Usage:       "Keep printing data appended to the file, across truncation and rotation.",
+			},
+			&cli.DurationFlag{
+				Destination: &tc.interval,
+				Name:        "sleep-interval",
+				Aliases:     []string{"s"},
+				Value:       time.Second,
+				Usage:       "How often the size of the file is checked with -f.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			if tc.lines < 0 {
+				return fmt.Errorf("invalid number of lines %d", tc.lines)
+			}
+			if tc.interval <= 0 {
+				return fmt.Errorf("invalid sleep interval %s", tc.interval)
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			p := remote.Clean(tc.nfsPath)
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, p)
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			info, err := fsys.Stat(p)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return fmt.Errorf("%s is a folder", p)
+			}
+			data, offset, err := lastLines(fsys, p, info.Size, tc.lines)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stdout.Write(data); err != nil {
+				return err
+			}
+			if !tc.follow {
+				return nil
+			}
+			return tc.followFile(jobCtx, fsys, p, info.FileID, offset, os.Stdout)
+		},
+	}
+}
+
+// lastLines returns the last n lines of the file p of the given size, and the
+// offset the returned data ends at. It reads a growing window from the end so
+// a large file is not read in full.
+func lastLines(fsys remote.FS, p string, size int64, n int) ([]byte, int64, error) {
+	if n == 0 {
+		return nil, size, nil
+	}
+	for window := int64(8 * 1024); ; window *= 4 {
+		start := size - window
+		if start < 0 {
+			start = 0
+		}
+		var buf bytes.Buffer
+		if _, err := fsys.ReadFile(p, start, &buf); err != nil {
+			return nil, 0, err
+		}
+		data := buf.Bytes()
+		end := start + int64(len(data))
+		if i := lineStart(data, n); i >= 0 {
+			return data[i:], end, nil
+		}
+		if start == 0 {
+			return data, end, nil
+		}
+	}
+}
+
+// lineStart returns the index where the last n lines of data begin, or -1 when
+// data holds fewer lines. A newline at the very end does not start a new line.
+func lineStart(data []byte, n int) int {
+	i := len(data)
+	if i > 0 && data[i-1] == '\n' {
+		i--
+	}
+	for ; n > 0; n-- {
+		i = bytes.LastIndexByte(data[:i], '\n')
+		if i < 0 {
+			return -1
+		}
+	}
+	return i + 1
+}
+
+// followFile polls the attributes of p and copies appended data to w until ctx
+// is done. Like tail -F it starts over when the file is truncated or replaced
+// by a new file, and waits while it is missing.
+func (tc *tailConfg) followFile(ctx context.Context, fsys remote.FS, p string, fileID uint64, offset int64, w io.Writer) error {
+	ticker := time.NewTicker(tc.interval)
+	defer ticker.Stop()
+	missing := false
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ctx.Err()
+			}
+			return nil
+		case <-ticker.C:
+		}
+
+		info, err := fsys.Stat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			if !missing {
+				fmt.Fprintf(os.Stderr, "ncp tail: %s has become inaccessible\n", p)
+				missing = true
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.FileID != fileID || missing:
+			fmt.Fprintf(os.Stderr, "ncp tail: %s has been replaced; following new file\n", p)
+			fileID, offset = info.FileID, 0
+		case info.Size < offset:
+			fmt.Fprintf(os.Stderr, "ncp tail: %s: file truncated\n", p)
+			offset = 0
+		}
+		missing = false
+		if info.Size == offset {
+			continue
+		}
+		n, err := fsys.ReadFile(p, offset, helper.ContextWriter(ctx, w))
+		offset += n
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package touch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type touchConfg struct {
+	noCreate bool
+	access   bool
+	modify   bool
+	date     string
+}
+
+// dateLayouts are the formats accepted by --date.
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// Touch function provides functionaltiy to create files or update their times on the NFS server.
+func Touch() *cli.Command {
+	var tc touchConfg
+	return &cli.Command{
+		Name:      "touch",
+		Usage:     "The 'touch' command creates empty files or updates their access and modification times on the NFS server.",
+		UsageText: "ncp touch --host 192.168.0.80 /data/src/.done",
+		Flags: append(remote.Flags(),
+			&cli.BoolFlag{
+				Destination: &tc.noCreate,
+				Name:        "no-create",
+				Aliases:     []string{"c"},
+				Usage:       "Do not create missing files.",
+			},
+			&cli.BoolFlag{
+				Destination: &tc.access,
+				Name:        "access",
+				Aliases:     []string{"a"},
+				Usage:       "Change only the access time.",
+			},
+			&cli.BoolFlag{
+				Destination: &tc.modify,
+				Name:        "modify",
+				Aliases:     []string{"m"},
+				Usage:       "Change only the modification time.",
+			},
+			&cli.StringFlag{
+				Destination: &tc.date,
+				Name:        "date",
+				Aliases:     []string{"d"},
+				Usage:       "Use this time instead of the current time of the server, e.g. 2024-01-02 15:04:05.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() == 0 {
+				return fmt.Errorf("missing file to touch")
+			}
+			change, err := tc.change()
+			if err != nil {
+				return err
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			paths := ctx.Args().Slice()
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, remote.CommonDir(paths))
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			failed := false
+			for _, p := range paths {
+				if err := tc.touch(fsys, p, change); err != nil {
+					fmt.Fprintf(os.Stderr, "touch: %s: %v\n", p, err)
+					failed = true
+				}
+			}
+			if failed {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// change returns the times to set, a zero time lets the server use its clock.
+func (tc *touchConfg) change() (remote.Change, error) {
+	var t time.Time
+	if tc.date != "" {
+		var err error
+		if t, err = parseDate(tc.date); err != nil {
+			return remote.Change{}, err
+		}
+	}
+	var change remote.Change
+	if tc.access || !tc.modify {
+		change.Atime = &t
+	}
+	if tc.modify || !tc.access {
+		change.Mtime = &t
+	}
+	return change, nil
+}
+
+func (tc *touchConfg) touch(fsys remote.FS, p string, change remote.Change) error {
+	_, err := fsys.Stat(p)
+	if err == nil {
+		return fsys.SetAttr(p, change)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if tc.noCreate {
+		return nil
+	}
+	if err := fsys.Create(p, remote.FileMode); err != nil {
+		return err
+	}
+	if tc.date == "" {
+		// A new file already carries the current time
+		return nil
+	}
+	return fsys.SetAttr(p, change)
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected e.g. 2024-01-02 15:04:05", s)
+}
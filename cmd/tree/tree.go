@@ -0,0 +1,176 @@
+package tree
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type treeConfg struct {
+	level    int
+	all      bool
+	dirsOnly bool
+	size     bool
+	sortBy   string
+	reverse  bool
+}
+
+// node is a file in the tree, folders carry their contents.
+type node struct {
+	*remote.FileInfo
+	Children []*node
+}
+
+// MarshalJSON adds the contents of a folder to its attributes.
+func (n *node) MarshalJSON() ([]byte, error) {
+	info, err := json.Marshal(n.FileInfo)
+	if err != nil || !n.IsDir() {
+		return info, err
+	}
+	children, err := json.Marshal(n.Children)
+	if err != nil {
+		return nil, err
+	}
+	if n.Children == nil {
+		children = []byte("[]")
+	}
+	return append(append(info[:len(info)-1], `,"children":`...), append(children, '}')...), nil
+}
+
+// ShowTree function provides functionaltiy to print the folder hierarchy on the NFS server.
+func ShowTree() *cli.Command {
+	var tc treeConfg
+	return &cli.Command{
+		Name:      "tree",
+		Usage:     "The 'tree' command prints the contents of a folder on the NFS server as a tree.",
+		UsageText: "ncp tree --host 192.168.0.80 -L 2 /data",
+		Flags: append(remote.Flags(),
+			&cli.IntFlag{
+				Destination: &tc.level,
+				Name:        "level",
+				Aliases:     []string{"L"},
+				Usage:       "Descend at most this many levels, 0 means no limit.",
+			},
+			&cli.BoolFlag{
+				Destination: &tc.all,
+				Name:        "all",
+				Aliases:     []string{"a"},
+				Usage:       "Do not hide entries starting with a dot.",
+			},
+			&cli.BoolFlag{
+				Destination: &tc.dirsOnly,
+				Name:        "dirs-only",
+				Aliases:     []string{"d"},
+				Usage:       "Only show folders.",
+			},
+			&cli.BoolFlag{
+				Destination: &tc.size,
+				Name:        "size",
+				Aliases:     []string{"s"},
+				Usage:       "Print the size of each file.",
+			},
+			&cli.StringFlag{
+				Destination: &tc.sortBy,
+				Name:        "sort",
+				Value:       remote.SortName,
+				Usage:       "Sort by name, size, time or none.",
+			},
+			&cli.BoolFlag{
+				Destination: &tc.reverse,
+				Name:        "reverse",
+				Aliases:     []string{"r"},
+				Usage:       "Reverse the sort order.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			if !remote.ValidSort(tc.sortBy) {
+				return fmt.Errorf("invalid sort %q, expected name, size, time or none", tc.sortBy)
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			root := ctx.Args().First()
+			if root == "" {
+				root = "/"
+			}
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, root)
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			info, err := fsys.Stat(root)
+			if err != nil {
+				return err
+			}
+			top := &node{FileInfo: info}
+			var dirs, files int
+			tc.build(fsys, top, 1, &dirs, &files)
+
+			if ctx.String("output") == "json" {
+				return json.NewEncoder(os.Stdout).Encode(top)
+			}
+			fmt.Println(top.Path)
+			tc.print(top, "")
+			fmt.Printf("\n%d %s, %d %s\n", dirs, plural(dirs, "directory", "directories"), files, plural(files, "file", "files"))
+			return nil
+		},
+	}
+}
+
+// build reads the contents of n down to the configured level and counts them.
+// Folders that can not be read are reported and shown empty.
+func (tc *treeConfg) build(fsys remote.FS, n *node, depth int, dirs, files *int) {
+	if !n.IsDir() || (tc.level > 0 && depth > tc.level) {
+		return
+	}
+	entries, err := fsys.ReadDir(n.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tree: %s: %v\n", n.Path, err)
+		return
+	}
+	remote.Sort(entries, tc.sortBy, tc.reverse)
+	for _, e := range entries {
+		if (!tc.all && remote.Hidden(e.Name)) || (tc.dirsOnly && !e.IsDir()) {
+			continue
+		}
+		child := &node{FileInfo: e}
+		if e.IsDir() {
+			*dirs++
+			tc.build(fsys, child, depth+1, dirs, files)
+		} else {
+			*files++
+		}
+		n.Children = append(n.Children, child)
+	}
+}
+
+func (tc *treeConfg) print(n *node, prefix string) {
+	for i, child := range n.Children {
+		branch, indent := "├── ", "│   "
+		if i == len(n.Children)-1 {
+			branch, indent = "└── ", "    "
+		}
+		name := child.Name
+		if tc.size {
+			name = fmt.Sprintf("[%9s]  %s", helper.FormatBytes(child.Size), name)
+		}
+		fmt.Printf("%s%s%s\n", prefix, branch, name)
+		tc.print(child, prefix+indent)
+	}
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
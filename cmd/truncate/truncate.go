@@ -0,0 +1,93 @@
+package truncate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+type truncateConfg struct {
+	size     string
+	noCreate bool
+}
+
+// Truncate function provides functionaltiy to shrink or extend files on the NFS server.
+func Truncate() *cli.Command {
+	var tc truncateConfg
+	return &cli.Command{
+		Name:      "truncate",
+		Usage:     "The 'truncate' command shrinks or extends files on the NFS server to a given size.",
+		UsageText: "ncp truncate --host 192.168.0.80 --size 0 /data/src/app.log",
+		Flags: append(remote.Flags(),
+			&cli.StringFlag{
+				Destination: &tc.size,
+				Name:        "size",
+				Aliases:     []string{"s"},
+				Required:    true,
+				Usage:       "New size in bytes, K, M, G and T are powers of 1024 in any case, such as 512K or 10mb.",
+			},
+			&cli.BoolFlag{
+				Destination: &tc.noCreate,
+				Name:        "no-create",
+				Aliases:     []string{"c"},
+				Usage:       "Do not create missing files.",
+			},
+		),
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() == 0 {
+				return fmt.Errorf("missing file to truncate")
+			}
+			size, err := helper.ParseSize(tc.size)
+			if err != nil {
+				return err
+			}
+			cfg, err := remote.NewConfig(ctx)
+			if err != nil {
+				return err
+			}
+			paths := ctx.Args().Slice()
+
+			jobCtx, cancel := helper.JobContext(ctx)
+			defer cancel()
+			fsys, err := remote.Dial(jobCtx, cfg, remote.CommonDir(paths))
+			if err != nil {
+				return err
+			}
+			defer fsys.Close()
+
+			failed := false
+			for _, p := range paths {
+				if err := tc.truncate(fsys, p, uint64(size)); err != nil {
+					fmt.Fprintf(os.Stderr, "truncate: %s: %v\n", p, err)
+					failed = true
+				}
+			}
+			if failed {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+func (tc *truncateConfg) truncate(fsys remote.FS, p string, size uint64) error {
+	info, err := fsys.Stat(p)
+	switch {
+	case err == nil && info.Type != remote.TypeFile:
+		return errors.New("not a regular file")
+	case errors.Is(err, os.ErrNotExist):
+		if tc.noCreate {
+			return nil
+		}
+		if err := fsys.Create(p, remote.FileMode); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+	return fsys.SetAttr(p, remote.Change{Size: &size})
+}
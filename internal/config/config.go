@@ -0,0 +1,299 @@
+// Package config reads the ncp config file, whose named profiles hold the
+// connection and transfer settings of a server, and maps every flag to an NCP_*
+// environment variable.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// File is the content of the config file:
+//
+//	default: build-share
+//	profiles:
+//	  build-share:
+//	    host: 192.168.0.80
+//	    nfs-version: "4"
+//	    root: /exports/build
+//	    parallel: 4
+//	    exclude: ["*.tmp", node_modules]
+type File struct {
+	// Default is the profile used when --profile is not given.
+	Default  string             `yaml:"default"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// Profile maps flag names, without the dashes in front, to their values. A
+// list sets a flag that may be repeated. Only the flags in Settings may be set.
+type Profile map[string]interface{}
+
+// Path returns the path of the config file, --config when given and otherwise
+// ~/.config/ncp/config.yaml ($XDG_CONFIG_HOME/ncp when set).
+func Path(ctx *cli.Context) (string, error) {
+	if p := ctx.String("config"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find the config file: %w", err)
+	}
+	return filepath.Join(dir, "ncp", "config.yaml"), nil
+}
+
+// Load reads the config file at path.
+func Load(path string) (*File, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// Open loads the config file of the command. The default file is optional, a
+// file given with --config must exist.
+func Open(ctx *cli.Context) (*File, error) {
+	p, err := Path(ctx)
+	if err != nil {
+		// Without a home folder there is no default file
+		return &File{}, nil
+	}
+	f, err := Load(p)
+	if errors.Is(err, os.ErrNotExist) && ctx.String("config") == "" {
+		return &File{}, nil
+	}
+	return f, err
+}
+
+// Profile returns the profile called name.
+func (f *File) Profile(name string) (Profile, error) {
+	p, ok := f.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(f.Profiles))
+		for n := range f.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown profile %q, the config file has %s", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// Lookup returns the profile called name from the config file of the command.
+func Lookup(ctx *cli.Context, name string) (Profile, error) {
+	f, err := Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return f.Profile(name)
+}
+
+// String returns the value of the setting key, ok is false when it is not set.
+func (p Profile) String(key string) (value string, ok bool) {
+	values, err := p.values(key)
+	if err != nil || len(values) == 0 {
+		return "", false
+	}
+	return strings.Join(values, ","), true
+}
+
+func (p Profile) values(key string) ([]string, error) {
+	switch v := p[key].(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = fmt.Sprint(item)
+		}
+		return values, nil
+	case map[string]interface{}:
+		return nil, fmt.Errorf("setting %q must be a value or a list", key)
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
+
+// Settings are the flags a profile may set: how to reach the server and how to
+// transfer files. Flags that change what a command deletes or modifies, such as
+// --recursive, --force or --dry-run, can not be set from a profile.
+var Settings = []string{
+	"host", "port", "nfs-version", "export", "uid", "gid", "root", "server-ip",
+	"nconnect", "timeout", "io-timeout", "parallel", "bwlimit", "exclude", "verify",
+}
+
+// Apply sets the flags from the profile chosen with --profile, or from the
+// default profile of the config file. It runs before the command parses its
+// flags. Flags given on the command line or through their environment variable
+// keep their value.
+func Apply(ctx *cli.Context) error {
+	f, err := Open(ctx)
+	if err != nil {
+		return err
+	}
+	name := ctx.String("profile")
+	if name == "" {
+		if name = f.Default; name == "" {
+			return nil
+		}
+	}
+	p, err := f.Profile(name)
+	if err != nil {
+		return err
+	}
+
+	global, known := flagNames(ctx.App)
+	// The command flags are parsed after this, the profile gives them their
+	// default value
+	var cmd *cli.Command
+	if ctx.Args().Present() {
+		cmd = ctx.App.Command(ctx.Args().First())
+	}
+	keys := make([]string, 0, len(p))
+	for key := range p {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !known[key] {
+			return fmt.Errorf("profile %q: unknown setting %q, settings are named like the flags", name, key)
+		}
+		if !contains(Settings, key) {
+			return fmt.Errorf("profile %q: %q can not be set in a profile, only %s can", name, key, strings.Join(Settings, ", "))
+		}
+		values, err := p.values(key)
+		if err != nil {
+			return fmt.Errorf("profile %q: %w", name, err)
+		}
+		if global[key] {
+			if ctx.IsSet(key) {
+				continue
+			}
+			for _, v := range values {
+				if err := ctx.Set(key, v); err != nil {
+					return fmt.Errorf("profile %q: %s: %w", name, key, err)
+				}
+			}
+			continue
+		}
+		if cmd == nil {
+			continue
+		}
+		for _, fl := range cmd.Flags {
+			if fl.Names()[0] != key {
+				continue
+			}
+			if err := setDefault(fl, values); err != nil {
+				return fmt.Errorf("profile %q: %s: %w", name, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setDefault makes values the default of f, which is then no longer required.
+func setDefault(f cli.Flag, values []string) error {
+	value := strings.Join(values, ",")
+	switch f := f.(type) {
+	case *cli.StringFlag:
+		f.Value, f.Required = value, false
+	case *cli.StringSliceFlag:
+		f.Value, f.Required = cli.NewStringSlice(values...), false
+	case *cli.IntFlag:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		f.Value, f.Required = v, false
+	case *cli.BoolFlag:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.Value, f.Required = v, false
+	case *cli.DurationFlag:
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		f.Value, f.Required = v, false
+	default:
+		return fmt.Errorf("flag type %T is not supported", f)
+	}
+	return nil
+}
+
+// flagNames returns the names of the global flags and of every flag of app.
+func flagNames(app *cli.App) (global, all map[string]bool) {
+	global, all = map[string]bool{}, map[string]bool{}
+	for _, f := range app.Flags {
+		global[f.Names()[0]], all[f.Names()[0]] = true, true
+	}
+	for _, c := range app.Commands {
+		for _, f := range c.Flags {
+			all[f.Names()[0]] = true
+		}
+	}
+	return global, all
+}
+
+// EnvVar returns the environment variable of the flag name, NCP_ followed by
+// the name in upper case with dashes turned into underscores.
+func EnvVar(name string) string {
+	return "NCP_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// AddEnvVars maps every flag of app and of its commands to its NCP_* environment
+// variable, next to the variables a flag already has.
+func AddEnvVars(app *cli.App) {
+	addEnvVars(app.Flags)
+	for _, c := range app.Commands {
+		addEnvVars(c.Flags)
+	}
+}
+
+func addEnvVars(flags []cli.Flag) {
+	for _, f := range flags {
+		var envVars *[]string
+		switch f := f.(type) {
+		case *cli.StringFlag:
+			envVars = &f.EnvVars
+		case *cli.StringSliceFlag:
+			envVars = &f.EnvVars
+		case *cli.BoolFlag:
+			envVars = &f.EnvVars
+		case *cli.IntFlag:
+			envVars = &f.EnvVars
+		case *cli.DurationFlag:
+			envVars = &f.EnvVars
+		default:
+			continue
+		}
+		name := EnvVar(f.Names()[0])
+		if !contains(*envVars, name) {
+			*envVars = append(*envVars, name)
+		}
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
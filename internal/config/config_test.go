@@ -0,0 +1,220 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestEnvVar(t *testing.T) {
+	tests := map[string]string{
+		"host":         "NCP_HOST",
+		"nfs-version":  "NCP_NFS_VERSION",
+		"keep-partial": "NCP_KEEP_PARTIAL",
+		"P":            "NCP_P",
+	}
+	for name, want := range tests {
+		if got := EnvVar(name); got != want {
+			t.Errorf("EnvVar(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestProfileString(t *testing.T) {
+	p := Profile{
+		"host":     "filer",
+		"parallel": 4,
+		"exclude":  []interface{}{"*.tmp", "node_modules"},
+		"nested":   map[string]interface{}{"a": 1},
+	}
+	tests := []struct {
+		key   string
+		value string
+		ok    bool
+	}{
+		{key: "host", value: "filer", ok: true},
+		{key: "parallel", value: "4", ok: true},
+		{key: "exclude", value: "*.tmp,node_modules", ok: true},
+		{key: "nested"},
+		{key: "missing"},
+	}
+	for _, tt := range tests {
+		value, ok := p.String(tt.key)
+		if value != tt.value || ok != tt.ok {
+			t.Errorf("String(%q) = %q, %v, want %q, %v", tt.key, value, ok, tt.value, tt.ok)
+		}
+	}
+}
+
+func TestAddEnvVars(t *testing.T) {
+	host := &cli.StringFlag{Name: "host", EnvVars: []string{"NCP_HOST"}}
+	port := &cli.StringFlag{Name: "port", Aliases: []string{"pr"}}
+	app := &cli.App{
+		Flags:    []cli.Flag{&cli.IntFlag{Name: "parallel", Aliases: []string{"P"}}},
+		Commands: []*cli.Command{{Name: "get", Flags: []cli.Flag{host, port}}},
+	}
+	AddEnvVars(app)
+	if got := app.Flags[0].(*cli.IntFlag).EnvVars; !reflect.DeepEqual(got, []string{"NCP_PARALLEL"}) {
+		t.Errorf("parallel reads %q", got)
+	}
+	// A variable a flag already has is not added twice
+	if !reflect.DeepEqual(host.EnvVars, []string{"NCP_HOST"}) {
+		t.Errorf("host reads %q", host.EnvVars)
+	}
+	if !reflect.DeepEqual(port.EnvVars, []string{"NCP_PORT"}) {
+		t.Errorf("port reads %q", port.EnvVars)
+	}
+}
+
+const testConfig = `default: build
+profiles:
+  build:
+    parallel: 4
+    host: filer-build
+  archive:
+    parallel: 2
+    host: filer-archive
+    exclude: ["*.tmp", node_modules]
+  broken:
+    colour: blue
+  careless:
+    host: filer-build
+    recursive: true
+`
+
+// run runs app with args after writing the test config file, and returns the
+// values the get command saw.
+func run(t *testing.T, args ...string) (parallel int, host string, exclude []string, err error) {
+	t.Helper()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte(testConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "config", Value: file},
+			&cli.StringFlag{Name: "profile"},
+			&cli.IntFlag{Name: "parallel", Value: 1},
+			&cli.StringSliceFlag{Name: "exclude"},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "get",
+				Flags: []cli.Flag{&cli.StringFlag{Name: "host", Required: true}},
+				Action: func(ctx *cli.Context) error {
+					parallel, host, exclude = ctx.Int("parallel"), ctx.String("host"), ctx.StringSlice("exclude")
+					return nil
+				},
+			},
+			{
+				Name:   "rm",
+				Flags:  []cli.Flag{&cli.StringFlag{Name: "host"}, &cli.BoolFlag{Name: "recursive"}},
+				Action: func(ctx *cli.Context) error { return nil },
+			},
+		},
+		Before: Apply,
+	}
+	AddEnvVars(app)
+	err = app.Run(append([]string{"ncp"}, args...))
+	return parallel, host, exclude, err
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		parallel int
+		host     string
+		exclude  []string
+		err      bool
+	}{
+		{name: "default profile", args: []string{"get"}, parallel: 4, host: "filer-build"},
+		{
+			name: "chosen profile", args: []string{"--profile", "archive", "get"},
+			parallel: 2, host: "filer-archive", exclude: []string{"*.tmp", "node_modules"},
+		},
+		{name: "flags win", args: []string{"--parallel", "8", "get", "--host", "other"}, parallel: 8, host: "other"},
+		{
+			name: "variables win", args: []string{"get"}, env: map[string]string{"NCP_HOST": "from-env", "NCP_PARALLEL": "3"},
+			parallel: 3, host: "from-env",
+		},
+		{name: "unknown profile", args: []string{"--profile", "missing", "get"}, err: true},
+		{name: "unknown setting", args: []string{"--profile", "broken", "get"}, err: true},
+		{name: "destructive setting", args: []string{"--profile", "careless", "rm"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"NCP_HOST", "NCP_PARALLEL"} {
+				t.Setenv(key, tt.env[key])
+				if tt.env[key] == "" {
+					os.Unsetenv(key)
+				}
+			}
+			parallel, host, exclude, err := run(t, tt.args...)
+			if tt.err {
+				if err == nil {
+					t.Error("succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parallel != tt.parallel || host != tt.host || !reflect.DeepEqual(exclude, tt.exclude) {
+				t.Errorf("got parallel %d, host %q, exclude %q, want %d, %q, %q", parallel, host, exclude, tt.parallel, tt.host, tt.exclude)
+			}
+			// The profile is passed to the flags, not through the environment
+			if v, ok := os.LookupEnv("NCP_HOST"); ok && v != tt.env["NCP_HOST"] {
+				t.Errorf("NCP_HOST was set to %q", v)
+			}
+		})
+	}
+}
+
+func TestSettings(t *testing.T) {
+	for _, key := range []string{"recursive", "force", "dry-run", "all", "parents", "no-clobber"} {
+		if contains(Settings, key) {
+			t.Errorf("profiles may set %q", key)
+		}
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	str := &cli.StringFlag{Name: "host", Required: true}
+	slice := &cli.StringSliceFlag{Name: "server-ip"}
+	num := &cli.IntFlag{Name: "parallel"}
+	dur := &cli.DurationFlag{Name: "timeout"}
+	tests := []struct {
+		flag   cli.Flag
+		values []string
+		err    bool
+	}{
+		{flag: str, values: []string{"filer"}},
+		{flag: slice, values: []string{"10.0.0.2", "10.0.0.3"}},
+		{flag: num, values: []string{"4"}},
+		{flag: num, values: []string{"four"}, err: true},
+		{flag: dur, values: []string{"90s"}},
+		{flag: dur, values: []string{"90"}, err: true},
+		{flag: &cli.Float64Flag{Name: "ratio"}, values: []string{"1"}, err: true},
+	}
+	for _, tt := range tests {
+		if err := setDefault(tt.flag, tt.values); (err != nil) != tt.err {
+			t.Errorf("setDefault(%s, %q) = %v", tt.flag.Names()[0], tt.values, err)
+		}
+	}
+	if str.Value != "filer" || str.Required {
+		t.Errorf("host is %q, required %v", str.Value, str.Required)
+	}
+	if got := slice.Value.Value(); !reflect.DeepEqual(got, []string{"10.0.0.2", "10.0.0.3"}) {
+		t.Errorf("server-ip is %q", got)
+	}
+	if num.Value != 4 || dur.Value != 90*time.Second {
+		t.Errorf("parallel is %d, timeout %v", num.Value, dur.Value)
+	}
+}
@@ -0,0 +1,30 @@
+package helper
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrNotConfirmed is returned by Confirm when there is no terminal to ask on.
+var ErrNotConfirmed = errors.New("confirmation needed but stdin is not a terminal")
+
+// Confirm asks a yes or no question on stderr and reads the answer from stdin.
+// Scripts have no terminal to answer on, so they get ErrNotConfirmed and have
+// to state their intent with a flag instead.
+func Confirm(question string) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, ErrNotConfirmed
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,133 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-nfs/nfsv3/nfs/rpc"
+	"github.com/urfave/cli/v2"
+)
+
+// JobContext returns a context for a whole transfer job. It is cancelled when the
+// global --timeout expires or when the process receives SIGINT/SIGTERM. After the
+// first signal the default handling is restored, so a second Ctrl-C kills ncp at once.
+func JobContext(ctx *cli.Context) (context.Context, context.CancelFunc) {
+	jobCtx, stop := signal.NotifyContext(ctx.Context, os.Interrupt, syscall.SIGTERM)
+	cancel := stop
+	if timeout := ctx.Duration("timeout"); timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		jobCtx, cancelTimeout = context.WithTimeout(jobCtx, timeout)
+		cancel = func() {
+			cancelTimeout()
+			stop()
+		}
+	}
+	go func() {
+		<-jobCtx.Done()
+		stop()
+	}()
+	return jobCtx, cancel
+}
+
+// ContextReader wraps r so that reads fail with the context error once ctx is done.
+// Transfers are made of many bounded RPCs, so checking between them is enough to
+// stop a job promptly.
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// ContextWriter wraps w so that writes fail with the context error once ctx is done.
+func ContextWriter(ctx context.Context, w io.Writer) io.Writer {
+	return &contextWriter{ctx: ctx, w: w}
+}
+
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw *contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// deadlineConn sets a fresh deadline before every read and write so a single
+// RPC can never block for longer than timeout.
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *deadlineConn) Read(p []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *deadlineConn) Write(p []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(p)
+}
+
+// DialTimeout connects to a TCP server, every read and write on the returned
+// connection is bounded by ioTimeout.
+func DialTimeout(ctx context.Context, server string, ioTimeout time.Duration) (net.Conn, error) {
+	d := net.Dialer{Timeout: ioTimeout}
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	if ioTimeout > 0 {
+		conn = &deadlineConn{Conn: conn, timeout: ioTimeout}
+	}
+	return conn, nil
+}
+
+// v3Dial serializes the dials of WithV3Timeout.
+var v3Dial sync.Mutex
+
+// WithV3Timeout runs dial, which connects with the NFS v3 client, so that every
+// read and write on the connections it opens is bounded by ioTimeout. The client
+// reads its timeout from a package variable when a connection is dialed, so the
+// dials are serialized and the variable is restored afterwards.
+func WithV3Timeout(ioTimeout time.Duration, dial func() error) error {
+	v3Dial.Lock()
+	defer v3Dial.Unlock()
+	saved := rpc.DefaultReadTimeout
+	defer func() { rpc.DefaultReadTimeout = saved }()
+	rpc.DefaultReadTimeout = ioTimeout
+	return dial()
+}
+
+// PrintInterrupted tells the user why a job stopped early and which files made it.
+func PrintInterrupted(err error, completed []string, total int) {
+	fmt.Fprintf(os.Stderr, "\ntransfer stopped: %v\n", err)
+	fmt.Fprintf(os.Stderr, "%d of %d files completed\n", len(completed), total)
+	for _, f := range completed {
+		fmt.Fprintf(os.Stderr, "  %s\n", f)
+	}
+}
@@ -0,0 +1,52 @@
+package helper
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-nfs/nfsv3/nfs/rpc"
+)
+
+func TestWithV3Timeout(t *testing.T) {
+	// A server that accepts connections and never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	before := rpc.DefaultReadTimeout
+	var client *rpc.Client
+	err = WithV3Timeout(100*time.Millisecond, func() (err error) {
+		client, err = rpc.DialTCP("tcp", nil, l.Addr().String())
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if rpc.DefaultReadTimeout != before {
+		t.Errorf("DefaultReadTimeout = %v after the dial, want %v", rpc.DefaultReadTimeout, before)
+	}
+
+	start := time.Now()
+	_, err = client.Call(&rpc.Header{Rpcvers: 2, Cred: rpc.AuthNull, Verf: rpc.AuthNull})
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Call = %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Call returned after %v, want about 100ms", elapsed)
+	}
+}
@@ -0,0 +1,210 @@
+package helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// EventSchemaVersion is the version of the NDJSON event schema written by
+// --output=json. It is bumped on every incompatible change to the events below.
+const EventSchemaVersion = 2
+
+// Event types written to the event stream.
+const (
+	EventJobStart   = "job_start"
+	EventDiscovered = "discovered"
+	EventDirCreated = "dir_created"
+	EventFileStart  = "file_start"
+	EventProgress   = "progress"
+	EventFileDone   = "file_done"
+	EventError      = "error"
+	EventSummary    = "summary"
+)
+
+// eventHeader is common to every event.
+type eventHeader struct {
+	Version int       `json:"version"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+}
+
+// JobStartEvent is written when a job starts, before it connects to the server.
+type JobStartEvent struct {
+	Command     string `json:"command"`
+	Host        string `json:"host"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Parallel    int    `json:"parallel"`
+}
+
+// DiscoveredEvent is written once the files of a job have been found, before
+// the first one is copied.
+type DiscoveredEvent struct {
+	TotalFiles int   `json:"total_files"`
+	TotalBytes int64 `json:"total_bytes"`
+}
+
+// DirCreatedEvent is written for every directory created at the destination.
+type DirCreatedEvent struct {
+	Path string `json:"path"`
+}
+
+// FileStartEvent is written when a worker starts copying a file.
+type FileStartEvent struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// ProgressEvent is written every second while a job is running.
+type ProgressEvent struct {
+	Bytes          int64   `json:"bytes"`
+	TotalBytes     int64   `json:"total_bytes"`
+	Files          int     `json:"files"`
+	TotalFiles     int     `json:"total_files"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+}
+
+// FileDoneEvent is written when a file has been copied and verified.
+type FileDoneEvent struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+	DurationMS int64  `json:"duration_ms"`
+	// Unverified is set when the job verifies but the file could not be, the
+	// SHA-256 sum is then empty.
+	Unverified bool `json:"unverified,omitempty"`
+}
+
+// ErrorEvent is written when copying a file or the whole job fails.
+type ErrorEvent struct {
+	Path  string `json:"path,omitempty"`
+	Error string `json:"error"`
+}
+
+// SummaryEvent is the last event of a job, Status is "ok", "failed" or "cancelled".
+type SummaryEvent struct {
+	Status                string         `json:"status"`
+	Files                 int            `json:"files"`
+	Dirs                  int            `json:"dirs"`
+	Skipped               int            `json:"skipped"`
+	Failed                int            `json:"failed"`
+	Unverified            int            `json:"unverified"`
+	Bytes                 int64          `json:"bytes"`
+	DurationMS            int64          `json:"duration_ms"`
+	AverageBytesPerSecond float64        `json:"average_bytes_per_second"`
+	PeakBytesPerSecond    float64        `json:"peak_bytes_per_second"`
+	Slowest               []FileDuration `json:"slowest"`
+}
+
+// FileDuration is one of the slowest files of a job in a summary event.
+type FileDuration struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Events writes newline-delimited JSON events. A nil *Events discards every
+// event, so callers never need to check whether the stream is enabled.
+type Events struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewEvents returns the event stream selected by --output, or nil for text output.
+func NewEvents(ctx *cli.Context) (*Events, error) {
+	switch format := ctx.String("output"); format {
+	case "", "text":
+		return nil, nil
+	case "json":
+		return newEvents(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("invalid output format %q, expected text or json", format)
+	}
+}
+
+func newEvents(w io.Writer) *Events {
+	return &Events{enc: json.NewEncoder(w)}
+}
+
+func (e *Events) emit(v interface{}) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.Encode(v)
+}
+
+func header(eventType string) eventHeader {
+	return eventHeader{Version: EventSchemaVersion, Type: eventType, Time: time.Now().UTC()}
+}
+
+// JobStart writes a job_start event.
+func (e *Events) JobStart(ev JobStartEvent) {
+	e.emit(struct {
+		eventHeader
+		JobStartEvent
+	}{header(EventJobStart), ev})
+}
+
+// Discovered writes a discovered event.
+func (e *Events) Discovered(ev DiscoveredEvent) {
+	e.emit(struct {
+		eventHeader
+		DiscoveredEvent
+	}{header(EventDiscovered), ev})
+}
+
+// DirCreated writes a dir_created event.
+func (e *Events) DirCreated(path string) {
+	e.emit(struct {
+		eventHeader
+		DirCreatedEvent
+	}{header(EventDirCreated), DirCreatedEvent{Path: path}})
+}
+
+// FileStart writes a file_start event.
+func (e *Events) FileStart(ev FileStartEvent) {
+	e.emit(struct {
+		eventHeader
+		FileStartEvent
+	}{header(EventFileStart), ev})
+}
+
+// Progress writes a progress event.
+func (e *Events) Progress(ev ProgressEvent) {
+	e.emit(struct {
+		eventHeader
+		ProgressEvent
+	}{header(EventProgress), ev})
+}
+
+// FileDone writes a file_done event.
+func (e *Events) FileDone(ev FileDoneEvent) {
+	e.emit(struct {
+		eventHeader
+		FileDoneEvent
+	}{header(EventFileDone), ev})
+}
+
+// Error writes an error event.
+func (e *Events) Error(path string, err error) {
+	e.emit(struct {
+		eventHeader
+		ErrorEvent
+	}{header(EventError), ErrorEvent{Path: path, Error: err.Error()}})
+}
+
+// Summary writes the final summary event.
+func (e *Events) Summary(ev SummaryEvent) {
+	e.emit(struct {
+		eventHeader
+		SummaryEvent
+	}{header(EventSummary), ev})
+}
@@ -0,0 +1,44 @@
+package helper
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrAllFailed is returned by a FanOut once every one of its writers failed.
+var ErrAllFailed = errors.New("every destination failed")
+
+// FanOut writes the same data to several writers. Unlike io.MultiWriter a
+// writer that fails is dropped and the others go on, writing only fails when
+// none is left.
+type FanOut struct {
+	writers []io.Writer
+	errs    []error
+	live    int
+}
+
+// NewFanOut returns a FanOut writing to writers.
+func NewFanOut(writers ...io.Writer) *FanOut {
+	return &FanOut{writers: writers, errs: make([]error, len(writers)), live: len(writers)}
+}
+
+func (f *FanOut) Write(b []byte) (int, error) {
+	for i, w := range f.writers {
+		if f.errs[i] != nil {
+			continue
+		}
+		if _, err := w.Write(b); err != nil {
+			f.errs[i] = err
+			f.live--
+		}
+	}
+	if f.live == 0 {
+		return 0, ErrAllFailed
+	}
+	return len(b), nil
+}
+
+// Err returns the error that dropped writer i, nil while it is still written to.
+func (f *FanOut) Err(i int) error {
+	return f.errs[i]
+}
@@ -0,0 +1,28 @@
+package helper
+
+import (
+	"fmt"
+	"path"
+)
+
+// ParseExclude checks the --exclude patterns, they use the syntax of path.Match.
+func ParseExclude(patterns []string) ([]string, error) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", p, err)
+		}
+	}
+	return patterns, nil
+}
+
+// Excluded reports whether name, the name of a file or folder found inside a
+// transferred folder, matches one of the exclude patterns. The walkers do not
+// descend into excluded folders.
+func (j *Job) Excluded(name string) bool {
+	for _, pattern := range j.Exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -28,19 +28,25 @@ func TruncateFileName(srcFilePath string) string {
 	return lastTwoParts
 }
 
-// ProgressBar function will return *progressbar.ProgressBar with given inputs
-func ProgressBar(size int64, truncatedFilePath string, onCompletionFunc func()) *progressbar.ProgressBar {
+// ProgressBar function will return *progressbar.ProgressBar with given inputs,
+// color codes are only used when color is true
+func ProgressBar(size int64, truncatedFilePath string, color bool, onCompletionFunc func()) *progressbar.ProgressBar {
 	// Customize the progress bar theme
 	theme := progressbar.Theme{
-		Saucer:        "\x1b[38;5;215m▖[reset][cyan]",
+		Saucer:        "▖",
 		SaucerPadding: " ",
 	}
+	description := "Copying" + " " + truncatedFilePath
+	if color {
+		theme.Saucer = "\x1b[38;5;215m▖[reset][cyan]"
+		description = "Copying" + " " + "[green]" + truncatedFilePath + "[reset]"
+	}
 
 	progress := progressbar.NewOptions64(
 		size,
-		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionEnableColorCodes(color),
 		progressbar.OptionSetTheme(theme),
-		progressbar.OptionSetDescription("Copying"+" "+"[green]"+truncatedFilePath+"[reset]"),
+		progressbar.OptionSetDescription(description),
 		progressbar.OptionSetWidth(20),
 		progressbar.OptionShowBytes(true),
 		progressbar.OptionOnCompletion(onCompletionFunc),
@@ -67,10 +73,18 @@ func CheckUID(u int, g int) (uid, gid uint32) {
 }
 
 // CheckMark will only print the check mark for progress bar
-func CheckMark() func() {
+func CheckMark(color bool) func() {
 	return func() {
-		fmt.Printf("%s ✔ %s\n", "\033[32m", "\033[0m")
+		fmt.Fprintf(os.Stderr, "%s\n", CheckMarkString(color))
+	}
+}
+
+// CheckMarkString returns the check mark printed after a finished bar
+func CheckMarkString(color bool) string {
+	if !color {
+		return " ✔ "
 	}
+	return fmt.Sprintf("%s ✔ %s", "\033[32m", "\033[0m")
 }
 
 // IsPathValid checks if a file or directory exists at the given path.
@@ -0,0 +1,96 @@
+package helper
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// HistoryEntry is one job recorded in the history file.
+type HistoryEntry struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Command     string    `json:"command"`
+	Host        string    `json:"host"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Parallel    int       `json:"parallel"`
+	Status      string    `json:"status"`
+	Files       int       `json:"files"`
+	Dirs        int       `json:"dirs"`
+	Skipped     int       `json:"skipped"`
+	Failed      int       `json:"failed"`
+	Unverified  int       `json:"unverified,omitempty"`
+	Bytes       int64     `json:"bytes"`
+	DurationMS  int64     `json:"duration_ms"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// HistoryPath returns the history file selected by --history-file, which defaults
+// to ncp/history.jsonl in $XDG_DATA_HOME or ~/.local/share.
+func HistoryPath(ctx *cli.Context) (string, error) {
+	if path := ctx.String("history-file"); path != "" {
+		return path, nil
+	}
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to find the history file: %w", err)
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "ncp", "history.jsonl"), nil
+}
+
+// AppendHistory adds entry to the end of the history file at path, one JSON
+// object per line. Existing entries are never rewritten.
+func AppendHistory(path string, entry HistoryEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadHistory returns every entry of the history file at path, oldest first.
+// A missing file is an empty history and lines that can not be parsed are skipped.
+func ReadHistory(path string) ([]HistoryEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
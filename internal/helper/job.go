@@ -0,0 +1,226 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Job holds the global settings and the state shared by every file of a single
+// transfer run.
+type Job struct {
+	Command     string
+	Host        string
+	Source      string
+	Destination string
+	Truncate    bool
+	KeepPartial bool
+	// Verify is set when written files are read back to compare their sums.
+	Verify bool
+	// Exclude are the patterns of the files skipped inside transferred folders.
+	Exclude  []string
+	Parallel int
+	Limiter  *Limiter
+	Output   Output
+	Events   *Events
+	Progress *Progress
+	// History is the file the job is recorded in, empty when --history is off.
+	History string
+
+	start time.Time
+	dirs  int32
+}
+
+// NewJob builds a Job from the global flags.
+func NewJob(ctx *cli.Context) (*Job, error) {
+	limiter, err := ParseBandwidth(ctx.String("bwlimit"))
+	if err != nil {
+		return nil, err
+	}
+	output, err := NewOutput(ctx)
+	if err != nil {
+		return nil, err
+	}
+	events, err := NewEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var history string
+	if ctx.Bool("history") {
+		if history, err = HistoryPath(ctx); err != nil {
+			return nil, err
+		}
+	}
+	exclude, err := ParseExclude(ctx.StringSlice("exclude"))
+	if err != nil {
+		return nil, err
+	}
+	verify := ctx.String("verify")
+	if verify != "" && verify != "sha256" && verify != "none" {
+		return nil, fmt.Errorf("unsupported verification %q, expected sha256 or none", verify)
+	}
+	parallel := ctx.Int("parallel")
+	if parallel < 1 {
+		parallel = 1
+	}
+	// Uploads may repeat --host
+	host := ctx.String("host")
+	if hosts := ctx.StringSlice("host"); len(hosts) > 0 {
+		host = strings.Join(hosts, ",")
+	}
+	// Uploads read --input and write to --nfspath, downloads read --nfspath
+	source, destination := ctx.String("input"), ctx.String("nfspath")
+	if source == "" {
+		source, destination = destination, "."
+	}
+	return &Job{
+		Command:     ctx.Command.Name,
+		Host:        host,
+		Source:      source,
+		Destination: destination,
+		Truncate:    ctx.Bool("turncate"),
+		KeepPartial: ctx.Bool("keep-partial"),
+		Verify:      verify != "none",
+		Exclude:     exclude,
+		Parallel:    parallel,
+		Limiter:     limiter,
+		Output:      output,
+		Events:      events,
+		History:     history,
+		start:       time.Now(),
+	}, nil
+}
+
+// Start writes the job_start event. Commands call it once the source and the
+// destination of the job are set, before connecting to the server.
+func (j *Job) Start() {
+	j.Events.JobStart(JobStartEvent{
+		Command:     j.Command,
+		Host:        j.Host,
+		Source:      j.Source,
+		Destination: j.Destination,
+		Parallel:    j.Parallel,
+	})
+}
+
+// Fail reports a job that stopped before its files were transferred, while
+// connecting to the server, finding the files or checking the free space. It
+// writes the error and the summary, records the job in the history and returns
+// err.
+func (j *Job) Fail(ctx context.Context, err error) error {
+	status := "failed"
+	if ctx.Err() != nil {
+		status = "cancelled"
+	}
+	j.Events.Error("", err)
+	report := Report{
+		Status:   status,
+		Dirs:     int(atomic.LoadInt32(&j.dirs)),
+		Duration: time.Since(j.start),
+	}
+	j.Events.Summary(report.Event())
+	j.record(report, err)
+	return err
+}
+
+// Transfer runs fn for every file with the job's workers while showing the overall
+// progress of the totalBytes found during discovery. When all files are done it reports
+// the outcome and records it in the history. It returns the files that completed.
+func (j *Job) Transfer(ctx context.Context, files []string, totalBytes int64, fn func(ctx context.Context, slot int, file string) error) ([]string, error) {
+	j.Events.Discovered(DiscoveredEvent{TotalFiles: len(files), TotalBytes: totalBytes})
+	j.Progress = NewProgress(totalBytes, len(files), j.Parallel, j.Output, j.Events)
+
+	var failed int32
+	completed, err := ForEach(ctx, j.Parallel, files, func(workerCtx context.Context, slot int, file string) error {
+		err := fn(workerCtx, slot, file)
+		// Files stopped because another worker failed are not failures of their own
+		if err != nil && !(errors.Is(err, context.Canceled) && ctx.Err() == nil) {
+			j.Events.Error(file, err)
+			atomic.AddInt32(&failed, 1)
+		}
+		return err
+	})
+	j.Progress.Stop()
+
+	status := "ok"
+	if ctx.Err() != nil {
+		status = "cancelled"
+	} else if err != nil {
+		status = "failed"
+	}
+	report := Report{
+		Status:     status,
+		Files:      len(completed),
+		Dirs:       int(atomic.LoadInt32(&j.dirs)),
+		Skipped:    len(files) - len(completed) - int(failed),
+		Failed:     int(failed),
+		Unverified: j.Progress.Unverified(),
+		Bytes:      j.Progress.Bytes(),
+		Duration:   time.Since(j.start),
+		PeakRate:   j.Progress.PeakRate(),
+		Slowest:    j.Progress.Slowest(slowestFiles),
+	}
+	if seconds := report.Duration.Seconds(); seconds > 0 {
+		report.AverageRate = float64(report.Bytes) / seconds
+	}
+	j.Events.Summary(report.Event())
+	if j.Output.Progress != ProgressNone {
+		report.Print(j.Output.Writer, j.Output.Color)
+	}
+	j.record(report, err)
+	return completed, err
+}
+
+// record appends the outcome of the job to the history file. A history that can
+// not be written is reported but does not fail the job.
+func (j *Job) record(report Report, jobErr error) {
+	if j.History == "" {
+		return
+	}
+	entry := HistoryEntry{
+		Start:       j.start,
+		End:         j.start.Add(report.Duration),
+		Command:     j.Command,
+		Host:        j.Host,
+		Source:      j.Source,
+		Destination: j.Destination,
+		Parallel:    j.Parallel,
+		Status:      report.Status,
+		Files:       report.Files,
+		Dirs:        report.Dirs,
+		Skipped:     report.Skipped,
+		Failed:      report.Failed,
+		Unverified:  report.Unverified,
+		Bytes:       report.Bytes,
+		DurationMS:  report.Duration.Milliseconds(),
+	}
+	if jobErr != nil {
+		entry.Error = jobErr.Error()
+	}
+	if err := AppendHistory(j.History, entry); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to record job in history %s: %v\n", j.History, err)
+	}
+}
+
+// DirCreated records a directory created at the destination.
+func (j *Job) DirCreated(path string) {
+	atomic.AddInt32(&j.dirs, 1)
+	j.Events.DirCreated(path)
+}
+
+// LocalSize returns the combined size of the given local files.
+func LocalSize(files []string) int64 {
+	var size int64
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
@@ -0,0 +1,144 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// events decodes the NDJSON events written to b.
+func events(t *testing.T, b *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var evs []map[string]interface{}
+	sc := bufio.NewScanner(b)
+	for sc.Scan() {
+		var ev map[string]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("%q: %v", sc.Text(), err)
+		}
+		evs = append(evs, ev)
+	}
+	return evs
+}
+
+func TestJobFail(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		status string
+	}{
+		{name: "mount failed", ctx: context.Background(), status: "failed"},
+		{name: "interrupted", ctx: canceled, status: "cancelled"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		history := filepath.Join(t.TempDir(), "history.jsonl")
+		job := &Job{
+			Command: "put", Host: "filer", Source: "dist", Destination: "/srv",
+			Parallel: 2, Events: newEvents(&out), History: history, start: time.Now(),
+		}
+		job.Start()
+		job.DirCreated("/srv/dist")
+		mountErr := errors.New("unable to mount volume")
+		if err := job.Fail(tt.ctx, mountErr); err != mountErr {
+			t.Errorf("%s: Fail returned %v", tt.name, err)
+		}
+
+		evs := events(t, &out)
+		var types []string
+		for _, ev := range evs {
+			types = append(types, ev["type"].(string))
+		}
+		want := []string{EventJobStart, EventDirCreated, EventError, EventSummary}
+		if len(types) != len(want) {
+			t.Fatalf("%s: wrote %v, want %v", tt.name, types, want)
+		}
+		for i := range want {
+			if types[i] != want[i] {
+				t.Fatalf("%s: wrote %v, want %v", tt.name, types, want)
+			}
+		}
+		if evs[0]["source"] != "dist" || evs[0]["parallel"] != 2.0 {
+			t.Errorf("%s: job_start %v", tt.name, evs[0])
+		}
+		if evs[2]["error"] != mountErr.Error() {
+			t.Errorf("%s: error event %v", tt.name, evs[2])
+		}
+		if evs[3]["status"] != tt.status || evs[3]["files"] != 0.0 || evs[3]["dirs"] != 1.0 {
+			t.Errorf("%s: summary %v", tt.name, evs[3])
+		}
+
+		b, err := os.ReadFile(history)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(b, &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Status != tt.status || entry.Error != mountErr.Error() || entry.Command != "put" {
+			t.Errorf("%s: recorded %+v", tt.name, entry)
+		}
+	}
+}
+
+func TestJobTransferUnverified(t *testing.T) {
+	var out bytes.Buffer
+	history := filepath.Join(t.TempDir(), "history.jsonl")
+	job := &Job{
+		Command: "cp", Source: "/srv/a", Destination: "/srv/b", Parallel: 1, Verify: true,
+		Output: Output{Writer: io.Discard, Progress: ProgressNone}, Events: newEvents(&out),
+		History: history, start: time.Now(),
+	}
+	_, err := job.Transfer(context.Background(), []string{"copied", "server side"}, 0, func(ctx context.Context, slot int, file string) error {
+		progress := job.Progress.File(slot, file, 0, file)
+		if file == "server side" {
+			return progress.FinishUnverified()
+		}
+		return progress.Finish([]byte{0xab})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := map[string]map[string]interface{}{}
+	var summary map[string]interface{}
+	for _, ev := range events(t, &out) {
+		switch ev["type"] {
+		case EventFileDone:
+			done[ev["path"].(string)] = ev
+		case EventSummary:
+			summary = ev
+		}
+	}
+	if ev := done["copied"]; ev["sha256"] != "ab" || ev["unverified"] != nil {
+		t.Errorf("verified file_done %v", ev)
+	}
+	if ev := done["server side"]; ev["sha256"] != "" || ev["unverified"] != true {
+		t.Errorf("unverified file_done %v", ev)
+	}
+	if summary["files"] != 2.0 || summary["unverified"] != 1.0 {
+		t.Errorf("summary %v", summary)
+	}
+
+	b, err := os.ReadFile(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry HistoryEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Files != 2 || entry.Unverified != 1 {
+		t.Errorf("recorded %+v", entry)
+	}
+}
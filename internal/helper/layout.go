@@ -0,0 +1,78 @@
+package helper
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Layout decides where the files of a download are written on the local machine.
+type Layout struct {
+	// Dest is the local folder the files go in.
+	Dest string
+	// Contents puts what a folder holds in Dest, instead of the folder itself.
+	Contents bool
+	// Strip is the number of leading path elements removed, like tar.
+	Strip int
+}
+
+// LayoutFlags are the flags of the download commands that set a Layout.
+func LayoutFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "dest",
+			Aliases: []string{"d", "output-dir", "o"},
+			Usage:   "Local folder the files are written to, created when missing.",
+			Value:   ".",
+		},
+		&cli.BoolFlag{
+			Name:  "contents",
+			Usage: "Copy what the folder holds rather than the folder itself, like a trailing slash on the path.",
+		},
+		&cli.IntFlag{
+			Name:  "strip-components",
+			Usage: "Remove this many leading folders from the local paths, files left without a name are skipped.",
+		},
+	}
+}
+
+// NewLayout reads the layout flags. A trailing slash on nfsPath asks for the
+// contents of the folder, like rsync.
+func NewLayout(ctx *cli.Context, nfsPath string) Layout {
+	strip := ctx.Int("strip-components")
+	if strip < 0 {
+		strip = 0
+	}
+	return Layout{
+		Dest:     ctx.String("dest"),
+		Contents: ctx.Bool("contents") || (len(nfsPath) > 1 && strings.HasSuffix(nfsPath, "/")),
+		Strip:    strip,
+	}
+}
+
+// Path returns the local path of the remote path p found in root, the file or
+// folder being downloaded. ok is false when stripping leaves no name.
+func (l Layout) Path(root, p string) (local string, ok bool) {
+	root = strings.TrimSuffix(root, "/")
+	rel := strings.TrimPrefix(p, root)
+	if !l.Contents {
+		rel = path.Join(path.Base(root), rel)
+	}
+	var elems []string
+	for _, e := range strings.Split(rel, "/") {
+		if e != "" && e != "." {
+			elems = append(elems, e)
+		}
+	}
+	if l.Strip > 0 && len(elems) <= l.Strip {
+		return "", false
+	}
+	elems = elems[l.Strip:]
+	dest := l.Dest
+	if dest == "" {
+		dest = "."
+	}
+	return filepath.Join(dest, filepath.Join(elems...)), true
+}
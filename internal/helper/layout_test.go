@@ -0,0 +1,37 @@
+package helper
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLayoutPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout Layout
+		root   string
+		path   string
+		want   string
+		ok     bool
+	}{
+		{name: "folder", layout: Layout{Dest: "out"}, root: "/srv/data", path: "/srv/data/a/b.txt", want: "out/data/a/b.txt", ok: true},
+		{name: "folder itself", layout: Layout{Dest: "out"}, root: "/srv/data", path: "/srv/data", want: "out/data", ok: true},
+		{name: "trailing slash", layout: Layout{Dest: "out"}, root: "/srv/data/", path: "/srv/data/b.txt", want: "out/data/b.txt", ok: true},
+		{name: "single file", layout: Layout{Dest: "out"}, root: "/srv/data/b.txt", path: "/srv/data/b.txt", want: "out/b.txt", ok: true},
+		{name: "contents", layout: Layout{Dest: "out", Contents: true}, root: "/srv/data", path: "/srv/data/a/b.txt", want: "out/a/b.txt", ok: true},
+		{name: "contents root", layout: Layout{Dest: "out", Contents: true}, root: "/srv/data", path: "/srv/data", want: "out", ok: true},
+		{name: "empty dest", layout: Layout{}, root: "/srv/data", path: "/srv/data/b.txt", want: "data/b.txt", ok: true},
+		{name: "strip one", layout: Layout{Dest: "out", Strip: 1}, root: "/srv/data", path: "/srv/data/a/b.txt", want: "out/a/b.txt", ok: true},
+		{name: "strip two", layout: Layout{Dest: "out", Strip: 2}, root: "/srv/data", path: "/srv/data/a/b.txt", want: "out/b.txt", ok: true},
+		{name: "strip everything", layout: Layout{Dest: "out", Strip: 3}, root: "/srv/data", path: "/srv/data/a/b.txt"},
+		{name: "strip the folder", layout: Layout{Dest: "out", Strip: 1}, root: "/srv/data", path: "/srv/data"},
+		{name: "strip contents", layout: Layout{Dest: "out", Contents: true, Strip: 1}, root: "/srv/data", path: "/srv/data/a/b.txt", want: "out/b.txt", ok: true},
+		{name: "export root contents", layout: Layout{Dest: "out", Contents: true}, root: "/", path: "/a/b.txt", want: "out/a/b.txt", ok: true},
+	}
+	for _, tt := range tests {
+		got, ok := tt.layout.Path(tt.root, tt.path)
+		if ok != tt.ok || got != filepath.FromSlash(tt.want) {
+			t.Errorf("%s: Path(%q, %q) = %q, %v, want %q, %v", tt.name, tt.root, tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
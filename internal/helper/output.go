@@ -0,0 +1,48 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+// Progress modes accepted by --progress.
+const (
+	ProgressBarMode = "bar"
+	ProgressPlain   = "plain"
+	ProgressNone    = "none"
+)
+
+// Output describes where and how progress is reported. Progress always goes to
+// stderr so stdout stays free for machine readable output.
+type Output struct {
+	Writer   io.Writer
+	Progress string
+	Color    bool
+}
+
+// NewOutput picks the progress mode from --progress, falling back to bars on a
+// terminal and plain status lines otherwise. Colors are disabled when NO_COLOR is
+// set or stderr is not a terminal.
+func NewOutput(ctx *cli.Context) (Output, error) {
+	tty := term.IsTerminal(int(os.Stderr.Fd()))
+	out := Output{
+		Writer:   os.Stderr,
+		Progress: ctx.String("progress"),
+		Color:    tty && os.Getenv("NO_COLOR") == "",
+	}
+	switch out.Progress {
+	case "":
+		out.Progress = ProgressPlain
+		if tty {
+			out.Progress = ProgressBarMode
+		}
+	case ProgressBarMode, ProgressPlain, ProgressNone:
+	default:
+		return out, fmt.Errorf("invalid progress mode %q, expected bar, plain or none", out.Progress)
+	}
+	return out, nil
+}
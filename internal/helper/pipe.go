@@ -0,0 +1,118 @@
+package helper
+
+import (
+	"io"
+	"sync"
+)
+
+// Pipe returns an in-memory pipe whose writer may run ahead of the reader by up
+// to buffers buffers of size bytes. Unlike io.Pipe a slow side does not stall the
+// other on every chunk, while the memory used stays bounded.
+func Pipe(buffers, size int) (*PipeReader, *PipeWriter) {
+	p := &pipe{
+		full: make(chan []byte, buffers),
+		free: make(chan []byte, buffers),
+		done: make(chan struct{}),
+	}
+	for i := 0; i < buffers; i++ {
+		p.free <- make([]byte, 0, size)
+	}
+	return &PipeReader{p: p}, &PipeWriter{p: p}
+}
+
+type pipe struct {
+	full chan []byte
+	free chan []byte
+	// done is closed when the reader goes away
+	done chan struct{}
+	once sync.Once
+	// werr is set before full is closed
+	werr error
+}
+
+// PipeWriter is the write half of a Pipe.
+type PipeWriter struct {
+	p   *pipe
+	buf []byte
+}
+
+// Write copies b into the buffers of the pipe, waiting for a free one when all
+// are full. It fails with io.ErrClosedPipe once the reader is closed.
+func (w *PipeWriter) Write(b []byte) (int, error) {
+	n := 0
+	for len(b) > 0 {
+		if w.buf == nil {
+			select {
+			case w.buf = <-w.p.free:
+				w.buf = w.buf[:0]
+			case <-w.p.done:
+				return n, io.ErrClosedPipe
+			}
+		}
+		c := copy(w.buf[len(w.buf):cap(w.buf)], b)
+		w.buf = w.buf[:len(w.buf)+c]
+		b, n = b[c:], n+c
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *PipeWriter) flush() error {
+	select {
+	case w.p.full <- w.buf:
+		w.buf = nil
+		return nil
+	case <-w.p.done:
+		return io.ErrClosedPipe
+	}
+}
+
+// CloseWithError hands the data written so far to the reader, which then gets
+// err, or io.EOF when err is nil. It must be called once.
+func (w *PipeWriter) CloseWithError(err error) error {
+	if err == nil {
+		err = io.EOF
+		if len(w.buf) > 0 {
+			w.flush()
+		}
+	}
+	w.p.werr = err
+	close(w.p.full)
+	return nil
+}
+
+// PipeReader is the read half of a Pipe.
+type PipeReader struct {
+	p   *pipe
+	cur []byte
+	buf []byte
+}
+
+// Read reads the data written to the pipe, in order.
+func (r *PipeReader) Read(b []byte) (int, error) {
+	for len(r.cur) == 0 {
+		if r.buf != nil {
+			// There are as many slots in free as buffers, this never blocks
+			r.p.free <- r.buf
+			r.buf = nil
+		}
+		buf, ok := <-r.p.full
+		if !ok {
+			return 0, r.p.werr
+		}
+		r.buf, r.cur = buf, buf
+	}
+	n := copy(b, r.cur)
+	r.cur = r.cur[n:]
+	return n, nil
+}
+
+// Close makes the writes still to come fail with io.ErrClosedPipe.
+func (r *PipeReader) Close() error {
+	r.p.once.Do(func() { close(r.p.done) })
+	return nil
+}
@@ -0,0 +1,88 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+	data := make([]byte, 100_000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	tests := []struct {
+		name    string
+		buffers int
+		size    int
+		chunk   int
+	}{
+		{name: "one small buffer", buffers: 1, size: 1, chunk: 333},
+		{name: "chunks larger than buffers", buffers: 2, size: 1000, chunk: 4096},
+		{name: "chunks smaller than buffers", buffers: 4, size: 4096, chunk: 100},
+		{name: "one write", buffers: 3, size: 64 << 10, chunk: len(data)},
+	}
+	for _, tt := range tests {
+		r, w := Pipe(tt.buffers, tt.size)
+		go func(chunk int) {
+			for b := data; len(b) > 0; {
+				n := chunk
+				if n > len(b) {
+					n = len(b)
+				}
+				if _, err := w.Write(b[:n]); err != nil {
+					w.CloseWithError(err)
+					return
+				}
+				b = b[n:]
+			}
+			w.CloseWithError(nil)
+		}(tt.chunk)
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: read %d bytes that differ from the %d written", tt.name, len(got), len(data))
+		}
+	}
+}
+
+func TestPipeCloseWithError(t *testing.T) {
+	broken := errors.New("source went away")
+	r, w := Pipe(2, 4)
+	go func() {
+		w.Write([]byte("abcdefgh"))
+		w.CloseWithError(broken)
+	}()
+	got, err := io.ReadAll(r)
+	if !errors.Is(err, broken) {
+		t.Errorf("got error %v, want %v", err, broken)
+	}
+	if string(got) != "abcdefgh" {
+		t.Errorf("read %q before the error, want %q", got, "abcdefgh")
+	}
+}
+
+func TestPipeReaderClose(t *testing.T) {
+	r, w := Pipe(1, 4)
+	done := make(chan error)
+	go func() {
+		// The first buffer fills the pipe, the second waits for the reader
+		_, err := w.Write([]byte("abcdefghijkl"))
+		done <- err
+	}()
+	b := make([]byte, 2)
+	if n, err := r.Read(b); n != 2 || err != nil {
+		t.Fatalf("Read = %d, %v", n, err)
+	}
+	r.Close()
+	if err := <-done; !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Write after Close = %v, want %v", err, io.ErrClosedPipe)
+	}
+	if _, err := w.Write([]byte("x")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("second Write after Close = %v, want %v", err, io.ErrClosedPipe)
+	}
+	r.Close()
+}
@@ -0,0 +1,355 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// plainInterval is how often the plain progress mode prints a status line.
+const plainInterval = 10 * time.Second
+
+// Progress renders the overall state of a job: one bar per worker followed by an
+// aggregate bar with the total bytes, files done, throughput and ETA. The totals
+// are known up front from the discovery phase, a negative totalBytes means the
+// size of a stream is not known. Depending on the output settings
+// it draws bars, prints periodic status lines or stays silent.
+type Progress struct {
+	mu         sync.Mutex
+	out        io.Writer
+	mode       string
+	color      bool
+	events     *Events
+	totalFiles int
+	totalBytes int64
+	doneFiles  int
+	unverified int
+	doneBytes  int64
+	start      time.Time
+	rate       float64
+	peak       float64
+	lastBytes  int64
+	lastTick   time.Time
+	finished   []FileTime
+	slots      []*FileProgress
+	lines      int
+	stop       chan struct{}
+	stopped    chan struct{}
+}
+
+// FileProgress tracks a single file, it is shown in the slot of the worker copying it.
+type FileProgress struct {
+	bytes int64 // first for 64-bit alignment of the atomic counter
+	p     *Progress
+	bar   *progressbar.ProgressBar
+	path  string
+	name  string
+	size  int64
+	slot  int
+	start time.Time
+	done  bool
+}
+
+// NewProgress creates the display for a job of totalFiles files and totalBytes bytes
+// copied by the given number of workers, and starts drawing it. Progress is also
+// reported to events, which may be nil.
+func NewProgress(totalBytes int64, totalFiles int, workers int, output Output, events *Events) *Progress {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &Progress{
+		out:        output.Writer,
+		mode:       output.Progress,
+		color:      output.Color,
+		events:     events,
+		totalFiles: totalFiles,
+		totalBytes: totalBytes,
+		start:      time.Now(),
+		lastTick:   time.Now(),
+		slots:      make([]*FileProgress, workers),
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	go p.loop()
+	return p
+}
+
+// File registers a new file being copied by the worker in slot, truncatedFilePath
+// is the name shown to the user. A negative size shows a spinner instead of a bar.
+func (p *Progress) File(slot int, path string, size int64, truncatedFilePath string) *FileProgress {
+	f := &FileProgress{p: p, slot: slot, path: path, name: truncatedFilePath, size: size, start: time.Now()}
+	p.events.FileStart(FileStartEvent{Path: path, Size: size})
+	if p.mode == ProgressBarMode {
+		f.bar = ProgressBar(size, truncatedFilePath, p.color, nil)
+		progressbar.OptionSetWriter(io.Discard)(f.bar)
+		f.bar.RenderBlank()
+	}
+	p.mu.Lock()
+	p.slots[slot%len(p.slots)] = f
+	p.mu.Unlock()
+	return f
+}
+
+// Add records n more bytes copied for this file.
+func (f *FileProgress) Add(n int) error {
+	atomic.AddInt64(&f.p.doneBytes, int64(n))
+	atomic.AddInt64(&f.bytes, int64(n))
+	if f.bar == nil {
+		return nil
+	}
+	return f.bar.Add(n)
+}
+
+// Write implements io.Writer so a FileProgress can be used with io.TeeReader.
+func (f *FileProgress) Write(b []byte) (int, error) {
+	f.Add(len(b))
+	return len(b), nil
+}
+
+// Finish marks the file as done with its SHA-256 sum and prints its final bar
+// with a check mark above the live bars, or a single line in plain mode.
+func (f *FileProgress) Finish(sum []byte) error {
+	return f.finish(sum, false)
+}
+
+// FinishUnverified marks the file as done without a sum, for a file copied in a
+// way that can not be verified although the job asked for it. The file is
+// flagged in its file_done event and counted in the summary.
+func (f *FileProgress) FinishUnverified() error {
+	return f.finish(nil, true)
+}
+
+func (f *FileProgress) finish(sum []byte, unverified bool) error {
+	p := f.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if f.done {
+		return nil
+	}
+	f.done = true
+	if f.size < 0 {
+		f.size = atomic.LoadInt64(&f.bytes)
+	}
+	elapsed := time.Since(f.start)
+	p.events.FileDone(FileDoneEvent{
+		Path:       f.path,
+		Size:       f.size,
+		SHA256:     fmt.Sprintf("%x", sum),
+		DurationMS: elapsed.Milliseconds(),
+		Unverified: unverified,
+	})
+	p.finished = append(p.finished, FileTime{Path: f.path, Size: f.size, Duration: elapsed})
+	p.doneFiles++
+	if unverified {
+		p.unverified++
+	}
+	if p.slots[f.slot%len(p.slots)] == f {
+		p.slots[f.slot%len(p.slots)] = nil
+	}
+	switch p.mode {
+	case ProgressBarMode:
+		f.bar.Finish()
+		p.clear()
+		fmt.Fprintf(p.out, "%s%s\n", strings.TrimLeft(f.bar.String(), "\r"), CheckMarkString(p.color))
+		p.draw()
+	case ProgressPlain:
+		fmt.Fprintf(p.out, "done %s (%s)\n", f.name, FormatBytes(f.size))
+	}
+	return nil
+}
+
+// Bytes returns the number of bytes copied so far.
+func (p *Progress) Bytes() int64 {
+	return atomic.LoadInt64(&p.doneBytes)
+}
+
+// Unverified returns the number of files finished without a sum although the
+// job verifies.
+func (p *Progress) Unverified() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.unverified
+}
+
+// PeakRate returns the highest throughput seen over one second, in bytes per second.
+func (p *Progress) PeakRate() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peak
+}
+
+// Slowest returns the n finished files that took the longest to copy.
+func (p *Progress) Slowest(n int) []FileTime {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slowest(p.finished, n)
+}
+
+// Stop draws the final state of the aggregate bar and stops the display.
+func (p *Progress) Stop() {
+	close(p.stop)
+	<-p.stopped
+}
+
+func (p *Progress) loop() {
+	defer close(p.stopped)
+	interval := 200 * time.Millisecond
+	if p.mode == ProgressPlain {
+		interval = plainInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// The throughput, its peak and the progress events use one second
+	// samples whatever the display mode is. The sampler is the only writer of
+	// the rate, the display only reads it.
+	sampler := time.NewTicker(time.Second)
+	defer sampler.Stop()
+	for {
+		select {
+		case now := <-sampler.C:
+			p.mu.Lock()
+			done := atomic.LoadInt64(&p.doneBytes)
+			p.sample(done, now)
+			if p.events != nil {
+				p.events.Progress(ProgressEvent{
+					Bytes:          done,
+					TotalBytes:     p.totalBytes,
+					Files:          p.doneFiles,
+					TotalFiles:     p.totalFiles,
+					BytesPerSecond: p.rate,
+				})
+			}
+			p.mu.Unlock()
+		case <-p.stop:
+			p.mu.Lock()
+			if p.peak == 0 {
+				// Jobs shorter than a sample peak at their average throughput
+				done := atomic.LoadInt64(&p.doneBytes)
+				p.peak = float64(done) / time.Since(p.start).Seconds()
+			}
+			p.refresh()
+			p.lines = 0
+			p.mu.Unlock()
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.refresh()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// refresh redraws the bars or prints a status line, depending on the mode.
+func (p *Progress) refresh() {
+	switch p.mode {
+	case ProgressBarMode:
+		p.clear()
+		p.draw()
+	case ProgressPlain:
+		done := atomic.LoadInt64(&p.doneBytes)
+		fmt.Fprintf(p.out, "copied %s / %s (%d%%) %s/s, %d/%d files, ETA %s\n",
+			FormatBytes(done), p.total(), p.percent(done),
+			FormatBytes(int64(p.rate)), p.doneFiles, p.totalFiles, p.eta(done))
+	}
+}
+
+// clear moves the cursor back over the live bars and erases them.
+func (p *Progress) clear() {
+	if p.lines == 0 {
+		return
+	}
+	fmt.Fprintf(p.out, "\r\033[%dA\033[J", p.lines)
+	p.lines = 0
+}
+
+// draw prints the bars of the active files and the aggregate bar.
+func (p *Progress) draw() {
+	var lines []string
+	for _, f := range p.slots {
+		if f != nil {
+			lines = append(lines, strings.TrimLeft(f.bar.String(), "\r"))
+		}
+	}
+	lines = append(lines, p.totalLine())
+	for _, l := range lines {
+		fmt.Fprintf(p.out, "%s\033[K\n", l)
+	}
+	p.lines = len(lines)
+}
+
+// totalLine renders the aggregate bar.
+func (p *Progress) totalLine() string {
+	done := atomic.LoadInt64(&p.doneBytes)
+	percent := p.percent(done)
+
+	const width = 20
+	filled := percent * width / 100
+	label, saucer := "Total", strings.Repeat("▖", filled)
+	if p.color {
+		label, saucer = "\033[36mTotal\033[0m", "\033[36m"+saucer+"\033[0m"
+	}
+	return fmt.Sprintf("%s %d/%d files %3d%% [%s%s] %s / %s, %s/s ETA %s",
+		label, p.doneFiles, p.totalFiles, percent, saucer, strings.Repeat(" ", width-filled),
+		FormatBytes(done), p.total(), FormatBytes(int64(p.rate)), p.eta(done))
+}
+
+// sample records the bytes done at now. The throughput is smoothed over the
+// recent samples so the ETA follows changes such as a bandwidth schedule.
+func (p *Progress) sample(done int64, now time.Time) {
+	current := float64(done-p.lastBytes) / now.Sub(p.lastTick).Seconds()
+	if current > p.peak {
+		p.peak = current
+	}
+	if p.rate == 0 {
+		p.rate = current
+	} else {
+		p.rate = 0.7*p.rate + 0.3*current
+	}
+	p.lastBytes, p.lastTick = done, now
+}
+
+// total returns the size of the job, or "?" for a stream of unknown length.
+func (p *Progress) total() string {
+	if p.totalBytes < 0 {
+		return "?"
+	}
+	return FormatBytes(p.totalBytes)
+}
+
+func (p *Progress) percent(done int64) int {
+	if p.totalBytes < 0 && p.doneFiles < p.totalFiles {
+		return 0
+	}
+	if p.totalBytes <= 0 || done >= p.totalBytes {
+		return 100
+	}
+	return int(done * 100 / p.totalBytes)
+}
+
+func (p *Progress) eta(done int64) string {
+	if p.rate <= 0 || p.totalBytes < 0 || done >= p.totalBytes {
+		return "-"
+	}
+	return (time.Duration(float64(p.totalBytes-done)/p.rate) * time.Second).Round(time.Second).String()
+}
+
+// FormatBytes returns n as a human readable size such as "1.2 GB". Units are
+// powers of 1024, the same as the sizes and rates given with ParseSize and
+// ParseRate and as the per file bars.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,64 @@
+package helper
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want string
+	}{
+		{in: 0, want: "0 B"},
+		{in: 1023, want: "1023 B"},
+		{in: 1024, want: "1.0 KB"},
+		{in: 1536, want: "1.5 KB"},
+		{in: 50 << 20, want: "50.0 MB"},
+		{in: 3 << 29, want: "1.5 GB"},
+		{in: 2 << 40, want: "2.0 TB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.in); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatBytesParseRate(t *testing.T) {
+	// A limit of 50M has to show as 50 MB/s, not as 52.4.
+	rate, err := ParseRate("50M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatBytes(rate); got != "50.0 MB" {
+		t.Errorf("FormatBytes(ParseRate(50M)) = %q, want 50.0 MB", got)
+	}
+}
+
+func TestProgressSample(t *testing.T) {
+	start := time.Now()
+	p := &Progress{out: io.Discard, mode: ProgressPlain, totalBytes: 100 << 20, lastTick: start}
+
+	p.sample(10<<20, start.Add(time.Second))
+	if p.rate != 10<<20 || p.peak != 10<<20 {
+		t.Fatalf("first sample: rate %v, peak %v, want %v", p.rate, p.peak, 10<<20)
+	}
+
+	// Drawing the display must not change the sampled rate.
+	p.doneBytes = 15 << 20
+	p.refresh()
+	p.totalLine()
+	if p.rate != 10<<20 {
+		t.Fatalf("rate after refresh = %v, want %v", p.rate, 10<<20)
+	}
+
+	p.sample(30<<20, start.Add(2*time.Second))
+	if want := 0.7*(10<<20) + 0.3*(20<<20); p.rate != want {
+		t.Errorf("smoothed rate = %v, want %v", p.rate, want)
+	}
+	if p.peak != 20<<20 {
+		t.Errorf("peak = %v, want %v", p.peak, 20<<20)
+	}
+}
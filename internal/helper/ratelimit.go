@@ -0,0 +1,218 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bwSlot is one entry of a bandwidth timetable, the rate applies from the
+// given minute of the day until the next slot starts.
+type bwSlot struct {
+	minute int
+	rate   int64
+}
+
+// Limiter is a token bucket shared by every reader and writer of a job, so the
+// configured bandwidth is a limit for the whole job and not for each worker.
+type Limiter struct {
+	mu       sync.Mutex
+	schedule []bwSlot
+	tokens   float64
+	last     time.Time
+}
+
+// ParseBandwidth parses a --bwlimit value. It is either a single rate such as
+// "50M" or a timetable such as "08:00,10M 18:00,off" where each entry sets the
+// rate from that time of day onwards. It returns nil when no limit is set.
+func ParseBandwidth(s string) (*Limiter, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	var schedule []bwSlot
+	if !strings.Contains(s, ",") {
+		rate, err := ParseRate(s)
+		if err != nil {
+			return nil, err
+		}
+		if rate == 0 {
+			return nil, nil
+		}
+		schedule = append(schedule, bwSlot{minute: 0, rate: rate})
+	} else {
+		for _, entry := range strings.Fields(s) {
+			clock, value, ok := strings.Cut(entry, ",")
+			if !ok {
+				return nil, fmt.Errorf("invalid bandwidth schedule entry %q, expected HH:MM,RATE", entry)
+			}
+			at, err := time.Parse("15:04", clock)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time %q in bandwidth schedule", clock)
+			}
+			rate, err := ParseRate(value)
+			if err != nil {
+				return nil, err
+			}
+			schedule = append(schedule, bwSlot{minute: at.Hour()*60 + at.Minute(), rate: rate})
+		}
+		sort.Slice(schedule, func(i, j int) bool { return schedule[i].minute < schedule[j].minute })
+	}
+	return &Limiter{schedule: schedule, last: time.Now()}, nil
+}
+
+// ParseRate converts a rate such as "512K", "50M" or "1.5G" into bytes per second.
+// Units are powers of 1024, "off" and "0" mean unlimited.
+func ParseRate(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	if v == "OFF" || v == "0" || v == "" {
+		return 0, nil
+	}
+	n, err := ParseSize(strings.TrimSuffix(v, "/S"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return n, nil
+}
+
+// ParseSize converts a size such as "4096", "512K", "10mb" or "1.5G" into bytes.
+// Units are powers of 1024 and may be in any case, with or without a trailing B.
+func ParseSize(s string) (int64, error) {
+	v, unit := SizeUnit(s)
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// SizeUnit splits a size such as "512K" into its number and the bytes in its
+// unit, 1 when it has none.
+func SizeUnit(s string) (string, int64) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	if len(v) > 1 && strings.HasSuffix(v, "B") {
+		v = v[:len(v)-1]
+	}
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(v, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(v, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(v, "G"):
+		unit = 1 << 30
+	case strings.HasSuffix(v, "T"):
+		unit = 1 << 40
+	}
+	if unit != 1 {
+		v = v[:len(v)-1]
+	}
+	return v, unit
+}
+
+// rateAt returns the limit in bytes per second at time t, 0 means unlimited.
+func (l *Limiter) rateAt(t time.Time) int64 {
+	minute := t.Hour()*60 + t.Minute()
+	// Before the first slot of the day the last slot of the previous day applies
+	rate := l.schedule[len(l.schedule)-1].rate
+	for _, slot := range l.schedule {
+		if slot.minute > minute {
+			break
+		}
+		rate = slot.rate
+	}
+	return rate
+}
+
+// WaitN blocks until n bytes may be transferred or ctx is done.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	for n > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		rate := l.rateAt(now)
+		if rate <= 0 {
+			l.last = now
+			l.mu.Unlock()
+			return nil
+		}
+		// Refill the bucket, allowing at most one second worth of burst
+		burst := float64(rate)
+		l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+		if l.tokens > burst {
+			l.tokens = burst
+		}
+		l.last = now
+
+		chunk := float64(n)
+		if chunk > burst {
+			chunk = burst
+		}
+		if l.tokens >= chunk {
+			l.tokens -= chunk
+			n -= int(chunk)
+			l.mu.Unlock()
+			continue
+		}
+		wait := time.Duration((chunk - l.tokens) / float64(rate) * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+// LimitReader throttles r with l, it returns r unchanged when l is nil.
+func LimitReader(ctx context.Context, r io.Reader, l *Limiter) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, r: r, l: l}
+}
+
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *Limiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if werr := lr.l.WaitN(lr.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// LimitWriter throttles w with l, it returns w unchanged when l is nil.
+func LimitWriter(ctx context.Context, w io.Writer, l *Limiter) io.Writer {
+	if l == nil {
+		return w
+	}
+	return &limitedWriter{ctx: ctx, w: w, l: l}
+}
+
+type limitedWriter struct {
+	ctx context.Context
+	w   io.Writer
+	l   *Limiter
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if err := lw.l.WaitN(lw.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	return lw.w.Write(p)
+}
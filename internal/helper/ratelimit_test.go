@@ -0,0 +1,204 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// limiter returns a Limiter of rate bytes per second at every time of day,
+// with an empty bucket.
+func limiter(rate int64) *Limiter {
+	return &Limiter{schedule: []bwSlot{{minute: 0, rate: rate}}, last: time.Now()}
+}
+
+func TestLimiterWaitN(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     int64
+		n        int
+		min, max time.Duration
+	}{
+		{name: "unlimited", rate: 0, n: 1 << 30, max: 50 * time.Millisecond},
+		{name: "nothing", rate: 1 << 20, n: 0, max: 50 * time.Millisecond},
+		{name: "quarter second", rate: 1 << 20, n: 256 << 10, min: 200 * time.Millisecond, max: 600 * time.Millisecond},
+		// More than one second worth is taken in bursts of at most one second
+		{name: "larger than a burst", rate: 256 << 10, n: 320 << 10, min: time.Second, max: 1800 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		l := limiter(tt.rate)
+		start := time.Now()
+		if err := l.WaitN(context.Background(), tt.n); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if took := time.Since(start); took < tt.min || took > tt.max {
+			t.Errorf("%s: took %v, want between %v and %v", tt.name, took, tt.min, tt.max)
+		}
+	}
+}
+
+func TestLimiterWaitNCanceled(t *testing.T) {
+	l := limiter(1 << 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := l.WaitN(ctx, 1<<20); err != context.DeadlineExceeded {
+		t.Errorf("WaitN = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("WaitN returned %v after the context was done", took)
+	}
+}
+
+func TestLimitReaderWriter(t *testing.T) {
+	data := bytes.Repeat([]byte("ncp"), 100<<10)
+	if r := LimitReader(context.Background(), bytes.NewReader(data), nil); r == nil {
+		t.Fatal("LimitReader without a limiter returned nil")
+	}
+
+	l := limiter(1 << 20)
+	var out bytes.Buffer
+	start := time.Now()
+	w := LimitWriter(context.Background(), &out, l)
+	n, err := io.Copy(w, LimitReader(context.Background(), bytes.NewReader(data), l))
+	if err != nil || n != int64(len(data)) || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("copied %d bytes, %v", n, err)
+	}
+	// The reader and the writer share the limiter, so both sides are counted
+	want := time.Duration(float64(2*len(data)) / float64(1<<20) * float64(time.Second))
+	if took := time.Since(start); took < want*3/4 {
+		t.Errorf("copy took %v, want at least %v", took, want*3/4)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  bool
+	}{
+		{in: "0", want: 0},
+		{in: "4096", want: 4096},
+		{in: "10B", want: 10},
+		{in: "512K", want: 512 << 10},
+		{in: "512k", want: 512 << 10},
+		{in: "10mb", want: 10 << 20},
+		{in: "10MB", want: 10 << 20},
+		{in: "1.5G", want: 3 << 29},
+		{in: "2T", want: 2 << 40},
+		{in: " 1m ", want: 1 << 20},
+		{in: "", err: true},
+		{in: "B", err: true},
+		{in: "-1K", err: true},
+		{in: "ten", err: true},
+		{in: "5X", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseSize(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  bool
+	}{
+		{in: "off", want: 0},
+		{in: "0", want: 0},
+		{in: "", want: 0},
+		{in: "50M", want: 50 << 20},
+		{in: "50mb/s", want: 50 << 20},
+		{in: "512KB/S", want: 512 << 10},
+		{in: "fast", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseRate(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseBandwidth(t *testing.T) {
+	at := func(clock string) time.Time {
+		tm, err := time.Parse("15:04", clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		in    string
+		nil   bool
+		err   bool
+		rates map[string]int64
+	}{
+		{in: "", nil: true},
+		{in: "off", nil: true},
+		{in: "0", nil: true},
+		{in: "50M", rates: map[string]int64{"00:00": 50 << 20, "12:00": 50 << 20, "23:59": 50 << 20}},
+		{
+			in: "08:00,10M 18:00,off",
+			rates: map[string]int64{
+				"07:59": 0, "08:00": 10 << 20, "12:30": 10 << 20, "17:59": 10 << 20, "18:00": 0, "23:59": 0,
+			},
+		},
+		{
+			// Entries may come in any order, before the first one the last
+			// entry of the previous day applies
+			in: "18:00,1G 06:00,512k",
+			rates: map[string]int64{
+				"00:00": 1 << 30, "05:59": 1 << 30, "06:00": 512 << 10, "17:59": 512 << 10, "18:00": 1 << 30,
+			},
+		},
+		{in: "08:00 10M", err: true},
+		{in: "25:00,10M 18:00,off", err: true},
+		{in: "08:00,fast 18:00,off", err: true},
+		{in: "fast", err: true},
+	}
+	for _, tt := range tests {
+		l, err := ParseBandwidth(tt.in)
+		switch {
+		case tt.err:
+			if err == nil {
+				t.Errorf("ParseBandwidth(%q) succeeded, want an error", tt.in)
+			}
+			continue
+		case err != nil:
+			t.Errorf("ParseBandwidth(%q): %v", tt.in, err)
+			continue
+		case tt.nil:
+			if l != nil {
+				t.Errorf("ParseBandwidth(%q) = %v, want no limit", tt.in, l.schedule)
+			}
+			continue
+		case l == nil:
+			t.Errorf("ParseBandwidth(%q) = nil, want a limit", tt.in)
+			continue
+		}
+		for clock, want := range tt.rates {
+			if got := l.rateAt(at(clock)); got != want {
+				t.Errorf("ParseBandwidth(%q) at %s = %d, want %d", tt.in, clock, got, want)
+			}
+		}
+	}
+}
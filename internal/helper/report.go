@@ -0,0 +1,94 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// slowestFiles is the number of slowest files listed in a report.
+const slowestFiles = 5
+
+// FileTime is the time it took to copy a single file.
+type FileTime struct {
+	Path     string
+	Size     int64
+	Duration time.Duration
+}
+
+// Report is the outcome of a job, it is printed when the job ends and kept in
+// the history.
+type Report struct {
+	Status      string
+	Files       int
+	Dirs        int
+	Skipped     int
+	Failed      int
+	Unverified  int
+	Bytes       int64
+	Duration    time.Duration
+	AverageRate float64
+	PeakRate    float64
+	Slowest     []FileTime
+}
+
+// Event returns the report as a summary event.
+func (r Report) Event() SummaryEvent {
+	ev := SummaryEvent{
+		Status:                r.Status,
+		Files:                 r.Files,
+		Dirs:                  r.Dirs,
+		Skipped:               r.Skipped,
+		Failed:                r.Failed,
+		Unverified:            r.Unverified,
+		Bytes:                 r.Bytes,
+		DurationMS:            r.Duration.Milliseconds(),
+		AverageBytesPerSecond: r.AverageRate,
+		PeakBytesPerSecond:    r.PeakRate,
+	}
+	for _, f := range r.Slowest {
+		ev.Slowest = append(ev.Slowest, FileDuration{Path: f.Path, Size: f.Size, DurationMS: f.Duration.Milliseconds()})
+	}
+	return ev
+}
+
+// Print writes the report in a human readable form.
+func (r Report) Print(w io.Writer, color bool) {
+	status := r.Status
+	if color {
+		switch r.Status {
+		case "ok":
+			status = "\033[32m" + status + "\033[0m"
+		default:
+			status = "\033[31m" + status + "\033[0m"
+		}
+	}
+	fmt.Fprintf(w, "\nSummary: %s\n", status)
+	fmt.Fprintf(w, "  Files:      %d copied, %d skipped, %d failed\n", r.Files, r.Skipped, r.Failed)
+	if r.Unverified > 0 {
+		fmt.Fprintf(w, "  Unverified: %d files copied without reading them back\n", r.Unverified)
+	}
+	fmt.Fprintf(w, "  Dirs:       %d created\n", r.Dirs)
+	fmt.Fprintf(w, "  Bytes:      %s in %s\n", FormatBytes(r.Bytes), r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "  Throughput: %s/s average, %s/s peak\n", FormatBytes(int64(r.AverageRate)), FormatBytes(int64(r.PeakRate)))
+	for i, f := range r.Slowest {
+		label := ""
+		if i == 0 {
+			label = "Slowest:"
+		}
+		fmt.Fprintf(w, "  %-11s %s %s (%s)\n", label, f.Path, f.Duration.Round(time.Millisecond), FormatBytes(f.Size))
+	}
+}
+
+// slowest returns the n files that took the longest to copy, slowest first.
+func slowest(files []FileTime, n int) []FileTime {
+	sorted := append([]FileTime(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Duration > sorted[j].Duration
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
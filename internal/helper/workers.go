@@ -0,0 +1,63 @@
+package helper
+
+import (
+	"context"
+	"sync"
+)
+
+// ForEach calls fn for every item using the given number of workers. Each worker
+// has a fixed slot number so it can use its own connection and progress bar.
+// No new items are handed out after the first error, which is returned together
+// with the items that completed.
+func ForEach(ctx context.Context, workers int, items []string, fn func(ctx context.Context, slot int, item string) error) ([]string, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		completed []string
+		firstErr  error
+	)
+	queue := make(chan string)
+	for slot := 0; slot < workers; slot++ {
+		wg.Add(1)
+		go func(slot int) {
+			defer wg.Done()
+			for item := range queue {
+				if err := fn(ctx, slot, item); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					cancel()
+					continue
+				}
+				mu.Lock()
+				completed = append(completed, item)
+				mu.Unlock()
+			}
+		}(slot)
+	}
+
+dispatch:
+	for _, item := range items {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case queue <- item:
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	// Dispatch also stops when the parent context is done while every worker is idle
+	if firstErr == nil && len(completed) < len(items) {
+		firstErr = ctx.Err()
+	}
+	return completed, firstErr
+}
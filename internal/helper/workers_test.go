@@ -0,0 +1,120 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func items(n int) []string {
+	s := make([]string, n)
+	for i := range s {
+		s[i] = strconv.Itoa(i)
+	}
+	return s
+}
+
+func TestForEach(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		items   int
+	}{
+		{name: "no items", workers: 4},
+		{name: "one worker", workers: 1, items: 10},
+		{name: "zero workers run as one", workers: 0, items: 3},
+		{name: "more workers than items", workers: 8, items: 3},
+		{name: "several", workers: 4, items: 50},
+	}
+	for _, tt := range tests {
+		var (
+			mu      sync.Mutex
+			seen    []string
+			running int32
+			most    int32
+		)
+		completed, err := ForEach(context.Background(), tt.workers, items(tt.items), func(ctx context.Context, slot int, item string) error {
+			want := tt.workers
+			if want < 1 {
+				want = 1
+			}
+			if slot < 0 || slot >= want {
+				t.Errorf("%s: slot %d out of range", tt.name, slot)
+			}
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			mu.Lock()
+			if n > most {
+				most = n
+			}
+			seen = append(seen, item)
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if len(completed) != tt.items || len(seen) != tt.items {
+			t.Errorf("%s: completed %d and ran %d items, want %d", tt.name, len(completed), len(seen), tt.items)
+		}
+		sort.Strings(seen)
+		want := items(tt.items)
+		sort.Strings(want)
+		for i := range seen {
+			if seen[i] != want[i] {
+				t.Errorf("%s: ran %v, want every item once", tt.name, seen)
+				break
+			}
+		}
+		if tt.workers > 0 && int(most) > tt.workers {
+			t.Errorf("%s: %d items ran at once, want at most %d", tt.name, most, tt.workers)
+		}
+	}
+}
+
+func TestForEachError(t *testing.T) {
+	failing := errors.New("disk full")
+	var ran int32
+	completed, err := ForEach(context.Background(), 2, items(100), func(ctx context.Context, slot int, item string) error {
+		atomic.AddInt32(&ran, 1)
+		if item == "3" {
+			return failing
+		}
+		return nil
+	})
+	if !errors.Is(err, failing) {
+		t.Errorf("ForEach = %v, want %v", err, failing)
+	}
+	for _, item := range completed {
+		if item == "3" {
+			t.Error("the failed item is listed as completed")
+		}
+	}
+	// Handing out items stops soon after the error, a worker that is ready at
+	// the same moment may still get one
+	if ran == 100 {
+		t.Error("every item ran after the error at the fourth")
+	}
+}
+
+func TestForEachCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	completed, err := ForEach(ctx, 2, items(100), func(ctx context.Context, slot int, item string) error {
+		if item == "1" {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ForEach = %v, want %v", err, context.Canceled)
+	}
+	if len(completed) == 100 {
+		t.Error("every item ran after the context was canceled")
+	}
+}
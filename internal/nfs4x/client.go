@@ -0,0 +1,255 @@
+// Package nfs4x implements the NFSv4 operations that go-nfs-client does not
+// expose, such as the full file attributes, SETATTR and RENAME. It speaks plain
+// NFSv4.0 COMPOUND requests over its own connection. Metadata only needs
+// stateless operations, Files holds the client ID that opening files needs.
+// NFSv4.1 and later, and the NFSv4.2 COPY and CLONE operations, need a Session.
+package nfs4x
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	nfsProgram    = 100003
+	nfsVersion    = 4
+	procNull      = 0
+	procCompound  = 1
+	authNone      = 0
+	authSys       = 1
+	lastFragment  = 1 << 31
+	maxReplyBytes = 64 << 20
+)
+
+// Auth holds the AUTH_SYS credentials sent with every call.
+type Auth struct {
+	MachineName string
+	UID, GID    uint32
+}
+
+// Client sends COMPOUND requests over a single connection. It is safe for
+// concurrent use, calls are serialized.
+type Client struct {
+	mu   sync.Mutex
+	conn net.Conn
+	xid  uint32
+	cred []byte
+
+	session *Session
+}
+
+// NewClient returns a client using conn, which must be connected to the NFS port
+// of the server.
+func NewClient(conn net.Conn, auth Auth) *Client {
+	var e Encoder
+	e.Uint32(0) // stamp
+	name := auth.MachineName
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	e.String(name)
+	e.Uint32(auth.UID)
+	e.Uint32(auth.GID)
+	e.Uint32(0) // no supplementary groups
+	return &Client{conn: conn, cred: e.Bytes(), xid: 1}
+}
+
+// UseSession sends every later Compound of c through s, so c speaks the minor
+// version of s. Servers that turned NFSv4.0 off need it.
+func (c *Client) UseSession(s *Session) {
+	c.session = s
+}
+
+// Close ends the session given to UseSession, if any, and closes the connection.
+func (c *Client) Close() error {
+	if c.session != nil {
+		c.session.Close()
+	}
+	return c.conn.Close()
+}
+
+// Null calls the NULL procedure, which does nothing but prove the server answers.
+func (c *Client) Null() error {
+	_, err := c.call(procNull, nil)
+	return err
+}
+
+// Compound runs ops as one COMPOUND request. Each op decodes its own result. The
+// server stops at the first op that fails, whose status is returned as an *Error.
+func (c *Client) Compound(ops ...Op) error {
+	if c.session != nil {
+		return c.session.Compound(ops...)
+	}
+	return c.compound(0, ops)
+}
+
+// MinorVersion sends an empty COMPOUND of the given minor version. A server
+// that does not support it fails with ErrMinorVers, see RFC 5661 section 2.7.
+func (c *Client) MinorVersion(minor uint32) error {
+	return c.compound(minor, nil)
+}
+
+func (c *Client) compound(minor uint32, ops []Op) error {
+	var e Encoder
+	e.String("ncp") // tag
+	e.Uint32(minor)
+	e.Uint32(uint32(len(ops)))
+	for _, op := range ops {
+		e.Uint32(op.code)
+		if op.encode != nil {
+			op.encode(&e)
+		}
+	}
+	reply, err := c.call(procCompound, e.Bytes())
+	if err != nil {
+		return err
+	}
+
+	d := NewDecoder(reply)
+	status := d.Uint32()
+	d.Opaque() // tag
+	n := d.Uint32()
+	if err := d.Err(); err != nil {
+		return err
+	}
+	for i := uint32(0); i < n && int(i) < len(ops); i++ {
+		code := d.Uint32()
+		opStatus := d.Uint32()
+		if err := d.Err(); err != nil {
+			return err
+		}
+		if code != ops[i].code {
+			return fmt.Errorf("nfs4x: reply for op %d, expected %d", code, ops[i].code)
+		}
+		if opStatus != 0 {
+			return &Error{Op: ops[i].code, Status: opStatus}
+		}
+		if ops[i].decode != nil {
+			if err := ops[i].decode(d); err != nil {
+				return err
+			}
+		}
+		if err := d.Err(); err != nil {
+			return err
+		}
+	}
+	if status != 0 {
+		return &Error{Status: status}
+	}
+	return nil
+}
+
+// call sends an RPC call for proc with the already encoded arguments and returns
+// the encoded results of an accepted and successful reply.
+func (c *Client) call(proc uint32, args []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	xid := c.xid
+	c.xid++
+
+	var e Encoder
+	e.Uint32(xid)
+	e.Uint32(0) // CALL
+	e.Uint32(2) // RPC version
+	e.Uint32(nfsProgram)
+	e.Uint32(nfsVersion)
+	e.Uint32(proc)
+	e.Uint32(authSys)
+	e.Opaque(c.cred)
+	e.Uint32(authNone)
+	e.Opaque(nil)
+	msg := append(e.Bytes(), args...)
+
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, lastFragment|uint32(len(msg)))
+	if _, err := c.conn.Write(append(header, msg...)); err != nil {
+		return nil, err
+	}
+
+	for {
+		reply, err := c.readRecord()
+		if err != nil {
+			return nil, err
+		}
+		d := NewDecoder(reply)
+		if d.Uint32() != xid {
+			// A late reply to a call that timed out, skip it
+			continue
+		}
+		return decodeReply(d)
+	}
+}
+
+// readRecord reads one record marked RPC message.
+func (c *Client) readRecord() ([]byte, error) {
+	var msg []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(c.conn, header[:]); err != nil {
+			return nil, err
+		}
+		v := binary.BigEndian.Uint32(header[:])
+		size := int(v &^ lastFragment)
+		if len(msg)+size > maxReplyBytes {
+			return nil, errors.New("nfs4x: reply too large")
+		}
+		frag := make([]byte, size)
+		if _, err := io.ReadFull(c.conn, frag); err != nil {
+			return nil, err
+		}
+		msg = append(msg, frag...)
+		if v&lastFragment != 0 {
+			return msg, nil
+		}
+	}
+}
+
+func decodeReply(d *Decoder) ([]byte, error) {
+	if d.Uint32() != 1 {
+		return nil, errors.New("nfs4x: RPC message is not a reply")
+	}
+	switch d.Uint32() {
+	case 0: // MSG_ACCEPTED
+		d.Uint32() // verifier flavor
+		d.Opaque() // verifier body
+		if stat := d.Uint32(); stat != 0 {
+			if err := d.Err(); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("RPC error: %s", acceptStat(stat))
+		}
+	default: // MSG_DENIED
+		if d.Uint32() == 0 {
+			low, high := d.Uint32(), d.Uint32()
+			return nil, fmt.Errorf("RPC error: version mismatch (low %d, high %d)", low, high)
+		}
+		return nil, fmt.Errorf("RPC error: authentication error %d", d.Uint32())
+	}
+	if err := d.Err(); err != nil {
+		return nil, err
+	}
+	rest := make([]byte, d.r.Len())
+	d.r.Read(rest)
+	return rest, nil
+}
+
+func acceptStat(stat uint32) string {
+	switch stat {
+	case 1:
+		return "PROG_UNAVAIL"
+	case 2:
+		return "PROG_MISMATCH"
+	case 3:
+		return "PROC_UNAVAIL"
+	case 4:
+		return "GARBAGE_ARGS"
+	case 5:
+		return "SYSTEM_ERR"
+	}
+	return fmt.Sprintf("accept status %d", stat)
+}
@@ -0,0 +1,136 @@
+package nfs4x
+
+// Stateid is a stateid4, it names the state of an open file or of a copy that
+// runs on the server.
+type Stateid [16]byte
+
+// anonymous is the special stateid that reads and writes without an open file.
+var anonymous Stateid
+
+// CopyResult is the outcome of COPY. When the server copies in the background,
+// Async is set and ID names the copy for OFFLOAD_STATUS, otherwise Count bytes
+// were copied. Committed tells how they reached the server, data that is not
+// FileSync needs a COMMIT whose verifier matches Verifier.
+type CopyResult struct {
+	Async     bool
+	ID        Stateid
+	Count     uint64
+	Committed uint32
+	Verifier  []byte
+}
+
+// Copy copies count bytes of the saved filehandle from srcOffset into the
+// current filehandle at dstOffset, RFC 7862 section 15.2. The files are
+// accessed with the anonymous stateid. A server may copy fewer bytes than asked
+// when sync is set, or copy in the background when it is not.
+func Copy(srcOffset, dstOffset, count uint64, sync bool, res *CopyResult) Op {
+	return Op{
+		code: OpCopy,
+		encode: func(e *Encoder) {
+			e.Fixed(anonymous[:])
+			e.Fixed(anonymous[:])
+			e.Uint64(srcOffset)
+			e.Uint64(dstOffset)
+			e.Uint64(count)
+			e.Bool(false) // consecutive
+			e.Bool(sync)
+			e.Uint32(0) // no source server, the copy stays on this one
+		},
+		decode: func(d *Decoder) error {
+			if n := d.Uint32(); n > 0 {
+				res.Async = true
+				copy(res.ID[:], d.Fixed(16))
+			}
+			res.Count = d.Uint64()
+			res.Committed = d.Uint32()
+			res.Verifier = d.Fixed(8)
+			d.Bool() // consecutive
+			d.Bool() // synchronous
+			return d.Err()
+		},
+	}
+}
+
+// Clone shares count bytes of the saved filehandle from srcOffset with the
+// current filehandle at dstOffset, RFC 7862 section 15.13. A count of 0 clones
+// to the end of the file.
+func Clone(srcOffset, dstOffset, count uint64) Op {
+	return Op{
+		code: OpClone,
+		encode: func(e *Encoder) {
+			e.Fixed(anonymous[:])
+			e.Fixed(anonymous[:])
+			e.Uint64(srcOffset)
+			e.Uint64(dstOffset)
+			e.Uint64(count)
+		},
+	}
+}
+
+// OffloadStatus returns the bytes copied so far by the background copy id. When
+// the copy is over, done is set and status holds its outcome.
+func OffloadStatus(id Stateid, count *uint64, done *bool, status *uint32) Op {
+	return Op{
+		code:   OpOffloadStatus,
+		encode: func(e *Encoder) { e.Fixed(id[:]) },
+		decode: func(d *Decoder) error {
+			*count = d.Uint64()
+			if d.Uint32() > 0 {
+				*done, *status = true, d.Uint32()
+			}
+			return d.Err()
+		},
+	}
+}
+
+// OffloadCancel stops the background copy id.
+func OffloadCancel(id Stateid) Op {
+	return Op{code: OpOffloadCancel, encode: func(e *Encoder) { e.Fixed(id[:]) }}
+}
+
+// copyOps returns the ops that make src the saved and dst the current filehandle.
+func copyOps(src, dst string) []Op {
+	ops := append(LookupPath(src), SaveFH())
+	return append(ops, LookupPath(dst)...)
+}
+
+// Clone makes the first size bytes of dst share the blocks of src. Servers whose
+// file system can not share blocks fail with ErrNotSupp.
+func (s *Session) Clone(src, dst string, size uint64) error {
+	return s.Compound(append(copyOps(src, dst), Clone(0, 0, size))...)
+}
+
+// Copy asks the server to copy count bytes of src at offset into dst at the same
+// offset.
+func (s *Session) Copy(src, dst string, offset, count uint64, sync bool) (CopyResult, error) {
+	var res CopyResult
+	err := s.Compound(append(copyOps(src, dst), Copy(offset, offset, count, sync, &res))...)
+	return res, err
+}
+
+// Commit puts the data written to path on stable storage and returns the write
+// verifier of the server.
+func (s *Session) Commit(path string) ([]byte, error) {
+	var verifier []byte
+	err := s.Compound(append(LookupPath(path), Commit(0, 0, &verifier))...)
+	return verifier, err
+}
+
+// OffloadStatus returns the progress of the background copy id, the current
+// filehandle must be its destination. A failed copy gives an *Error.
+func (s *Session) OffloadStatus(dst string, id Stateid) (count uint64, done bool, err error) {
+	var status uint32
+	ops := append(LookupPath(dst), OffloadStatus(id, &count, &done, &status))
+	if err := s.Compound(ops...); err != nil {
+		return 0, false, err
+	}
+	if done && status != 0 {
+		return count, done, &Error{Op: OpCopy, Status: status}
+	}
+	return count, done, nil
+}
+
+// OffloadCancel stops the background copy id, whose destination is dst.
+func (s *Session) OffloadCancel(dst string, id Stateid) error {
+	return s.Compound(append(LookupPath(dst), OffloadCancel(id))...)
+}
@@ -0,0 +1,78 @@
+package nfs4x
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCopyDecode(t *testing.T) {
+	id := Stateid{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	verifier := []byte{9, 8, 7, 6, 5, 4, 3, 2}
+	reply := func(async bool, count uint64, committed uint32) []byte {
+		var e Encoder
+		if async {
+			e.Uint32(1)
+			e.Fixed(id[:])
+		} else {
+			e.Uint32(0)
+		}
+		e.Uint64(count)
+		e.Uint32(committed)
+		e.Fixed(verifier)
+		e.Bool(false)
+		e.Bool(!async)
+		return e.Bytes()
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want CopyResult
+	}{
+		{
+			name: "sync unstable",
+			data: reply(false, 1<<20, Unstable),
+			want: CopyResult{Count: 1 << 20, Committed: Unstable},
+		},
+		{
+			name: "sync file sync",
+			data: reply(false, 4096, FileSync),
+			want: CopyResult{Count: 4096, Committed: FileSync},
+		},
+		{
+			name: "async",
+			data: reply(true, 0, Unstable),
+			want: CopyResult{Async: true, ID: id, Committed: Unstable},
+		},
+	}
+	for _, tt := range tests {
+		var res CopyResult
+		if err := Copy(0, 0, 0, true, &res).decode(NewDecoder(tt.data)); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if res.Async != tt.want.Async || res.ID != tt.want.ID || res.Count != tt.want.Count || res.Committed != tt.want.Committed {
+			t.Errorf("%s: decoded %+v, want %+v", tt.name, res, tt.want)
+		}
+		if !bytes.Equal(res.Verifier, verifier) {
+			t.Errorf("%s: verifier %v, want %v", tt.name, res.Verifier, verifier)
+		}
+	}
+
+	data := reply(false, 4096, Unstable)
+	var res CopyResult
+	if err := Copy(0, 0, 0, true, &res).decode(NewDecoder(data[:len(data)-8])); err == nil {
+		t.Error("a short COPY reply was accepted")
+	}
+}
+
+func TestCommitDecode(t *testing.T) {
+	var e Encoder
+	e.Fixed([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	var verifier []byte
+	if err := Commit(0, 0, &verifier).decode(NewDecoder(e.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(verifier, []byte{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("verifier = %v", verifier)
+	}
+}
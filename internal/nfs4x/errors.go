@@ -0,0 +1,145 @@
+package nfs4x
+
+import (
+	"fmt"
+	"os"
+)
+
+// NFSv4 status codes that callers check for.
+const (
+	ErrPerm        = 1
+	ErrNoEnt       = 2
+	ErrIO          = 5
+	ErrAccess      = 13
+	ErrExist       = 17
+	ErrXDev        = 18
+	ErrNotDir      = 20
+	ErrIsDir       = 21
+	ErrInval       = 22
+	ErrFBig        = 27
+	ErrNoSpc       = 28
+	ErrROFS        = 30
+	ErrNameTooLong = 63
+	ErrNotEmpty    = 66
+	ErrDQuot       = 69
+	ErrStale       = 70
+	ErrNotSupp     = 10004
+	ErrServerFault = 10006
+	ErrDelay       = 10008
+	ErrWrongSec    = 10016
+	ErrMinorVers   = 10021
+	ErrBadStateID  = 10025
+	ErrSymlink     = 10029
+	ErrAttrNotSupp = 10032
+	ErrBadOwner    = 10039
+	ErrOpIllegal   = 10044
+
+	ErrCompleteAlready = 10054
+	ErrOffloadDenied   = 10091
+	ErrOffloadNoReqs   = 10094
+)
+
+var statusNames = map[uint32]string{
+	ErrPerm:        "NFS4ERR_PERM",
+	ErrNoEnt:       "NFS4ERR_NOENT",
+	ErrIO:          "NFS4ERR_IO",
+	ErrAccess:      "NFS4ERR_ACCESS",
+	ErrExist:       "NFS4ERR_EXIST",
+	ErrXDev:        "NFS4ERR_XDEV",
+	ErrNotDir:      "NFS4ERR_NOTDIR",
+	ErrIsDir:       "NFS4ERR_ISDIR",
+	ErrInval:       "NFS4ERR_INVAL",
+	ErrFBig:        "NFS4ERR_FBIG",
+	ErrNoSpc:       "NFS4ERR_NOSPC",
+	ErrROFS:        "NFS4ERR_ROFS",
+	ErrNameTooLong: "NFS4ERR_NAMETOOLONG",
+	ErrNotEmpty:    "NFS4ERR_NOTEMPTY",
+	ErrDQuot:       "NFS4ERR_DQUOT",
+	ErrStale:       "NFS4ERR_STALE",
+	ErrNotSupp:     "NFS4ERR_NOTSUPP",
+	ErrServerFault: "NFS4ERR_SERVERFAULT",
+	ErrDelay:       "NFS4ERR_DELAY",
+	ErrWrongSec:    "NFS4ERR_WRONGSEC",
+	ErrMinorVers:   "NFS4ERR_MINOR_VERS_MISMATCH",
+	ErrBadStateID:  "NFS4ERR_BAD_STATEID",
+	ErrSymlink:     "NFS4ERR_SYMLINK",
+	ErrAttrNotSupp: "NFS4ERR_ATTRNOTSUPP",
+	ErrBadOwner:    "NFS4ERR_BADOWNER",
+	ErrOpIllegal:   "NFS4ERR_OP_ILLEGAL",
+
+	ErrCompleteAlready: "NFS4ERR_COMPLETE_ALREADY",
+	ErrOffloadDenied:   "NFS4ERR_OFFLOAD_DENIED",
+	ErrOffloadNoReqs:   "NFS4ERR_OFFLOAD_NO_REQS",
+}
+
+var opNames = map[uint32]string{
+	OpAccess:             "ACCESS",
+	OpClose:              "CLOSE",
+	OpCommit:             "COMMIT",
+	OpCreate:             "CREATE",
+	OpDelegReturn:        "DELEGRETURN",
+	OpGetAttr:            "GETATTR",
+	OpGetFH:              "GETFH",
+	OpLookup:             "LOOKUP",
+	OpOpen:               "OPEN",
+	OpOpenConfirm:        "OPEN_CONFIRM",
+	OpPutFH:              "PUTFH",
+	OpPutRootFH:          "PUTROOTFH",
+	OpRead:               "READ",
+	OpReadDir:            "READDIR",
+	OpRemove:             "REMOVE",
+	OpRename:             "RENAME",
+	OpRenew:              "RENEW",
+	OpRestoreFH:          "RESTOREFH",
+	OpSaveFH:             "SAVEFH",
+	OpSetAttr:            "SETATTR",
+	OpSetClientID:        "SETCLIENTID",
+	OpSetClientIDConfirm: "SETCLIENTID_CONFIRM",
+	OpWrite:              "WRITE",
+
+	OpExchangeID:      "EXCHANGE_ID",
+	OpCreateSession:   "CREATE_SESSION",
+	OpDestroySession:  "DESTROY_SESSION",
+	OpSequence:        "SEQUENCE",
+	OpDestroyClientID: "DESTROY_CLIENTID",
+	OpReclaimComplete: "RECLAIM_COMPLETE",
+	OpCopy:            "COPY",
+	OpOffloadCancel:   "OFFLOAD_CANCEL",
+	OpOffloadStatus:   "OFFLOAD_STATUS",
+	OpClone:           "CLONE",
+}
+
+// Error is the status of a failed NFSv4 operation.
+type Error struct {
+	Op     uint32
+	Status uint32
+}
+
+func (e *Error) Error() string {
+	name, ok := statusNames[e.Status]
+	if !ok {
+		name = fmt.Sprintf("NFS4ERR %d", e.Status)
+	}
+	if e.Op == 0 {
+		return name
+	}
+	op, ok := opNames[e.Op]
+	if !ok {
+		op = fmt.Sprintf("op %d", e.Op)
+	}
+	return fmt.Sprintf("%s: %s", op, name)
+}
+
+// Is lets errors.Is match the os errors for missing files, existing files and
+// permissions.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case os.ErrNotExist:
+		return e.Status == ErrNoEnt
+	case os.ErrExist:
+		return e.Status == ErrExist
+	case os.ErrPermission:
+		return e.Status == ErrPerm || e.Status == ErrAccess
+	}
+	return false
+}
@@ -0,0 +1,511 @@
+package nfs4x
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How WRITE and COPY data reached the server, stable_how4.
+const (
+	Unstable = 0
+	DataSync = 1
+	FileSync = 2
+)
+
+const (
+	shareAccessWrite = 2
+	// wantNoDeleg asks an NFSv4.1 server for no delegation, there is no back
+	// channel to recall it.
+	wantNoDeleg = 0x0400
+	openConfirm = 2
+	// maxIO caps a single READ or WRITE, servers that do not give their limits
+	// get minIO.
+	maxIO = 1 << 20
+	minIO = 64 << 10
+	// ioOverhead is the room left in a session request or reply for the
+	// headers and ops around the data of a READ or WRITE.
+	ioOverhead = 16 << 10
+	// defaultLease is the lease of a server that does not tell it, RFC 7530
+	// section 9.5 suggests 90 seconds.
+	defaultLease = 90 * time.Second
+)
+
+// errRestarted is returned when the write verifier changed, the server
+// restarted and may have lost the data written UNSTABLE.
+var errRestarted = errors.New("nfs4x: the server restarted during the write, data not yet committed may be lost")
+
+// Files opens files for reading and writing over a Client, RFC 7530 section 9.
+// It holds an NFSv4.0 client ID, or uses the one of the session of the Client,
+// and renews it until Close. Every file gets its own open owner, so files may be
+// opened from several goroutines.
+type Files struct {
+	c        *Client
+	session  *Session
+	clientID uint64
+	owners   uint32
+
+	maxRead, maxWrite uint32
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// NewFiles gets a client ID over c and reads the transfer sizes of the server.
+// A Client with a session uses the client ID of the session. Close releases c.
+func NewFiles(c *Client) (*Files, error) {
+	f := &Files{c: c, session: c.session, stop: make(chan struct{})}
+	if f.session != nil {
+		f.clientID = f.session.clientID
+	} else if err := f.setClientID(); err != nil {
+		return nil, err
+	}
+	var attrs *Attrs
+	if err := c.Compound(PutRootFH(), GetAttr(&attrs, AttrLeaseTime, AttrMaxRead, AttrMaxWrite)); err != nil {
+		return nil, err
+	}
+	f.maxRead, f.maxWrite = ioSize(attrs.MaxRead), ioSize(attrs.MaxWrite)
+	if f.session != nil {
+		f.maxRead = minSize(f.maxRead, f.session.maxResponse)
+		f.maxWrite = minSize(f.maxWrite, f.session.maxRequest)
+	}
+	lease := time.Duration(attrs.LeaseTime) * time.Second
+	if lease <= 0 {
+		lease = defaultLease
+	}
+	f.done.Add(1)
+	go f.renew(lease / 3)
+	return f, nil
+}
+
+func (f *Files) setClientID() error {
+	verifier := make([]byte, 8)
+	rand.Read(verifier)
+	host, _ := os.Hostname()
+	id := fmt.Sprintf("ncp/%s/%d/%x", host, os.Getpid(), verifier)
+
+	var confirm []byte
+	if err := f.c.Compound(setClientID(verifier, id, &f.clientID, &confirm)); err != nil {
+		return err
+	}
+	return f.c.Compound(setClientIDConfirm(f.clientID, confirm))
+}
+
+// minSize returns the smaller of size and what is left of a session message of
+// max bytes for the data.
+func minSize(size, max uint32) uint32 {
+	if max > ioOverhead+minIO && max-ioOverhead < size {
+		return max - ioOverhead
+	}
+	return size
+}
+
+func ioSize(v uint64) uint32 {
+	switch {
+	case v == 0:
+		return minIO
+	case v > maxIO:
+		return maxIO
+	}
+	return uint32(v)
+}
+
+// renew keeps the client ID alive while no open file does it.
+func (f *Files) renew(every time.Duration) {
+	defer f.done.Done()
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			if f.session != nil {
+				// SEQUENCE alone renews the lease of a session
+				f.c.Compound()
+			} else {
+				f.c.Compound(renew(f.clientID))
+			}
+		}
+	}
+}
+
+// Close stops renewing the client ID and closes the connection. The server
+// drops the state of the client once its lease runs out.
+func (f *Files) Close() error {
+	close(f.stop)
+	f.done.Wait()
+	return f.c.Close()
+}
+
+// File is a file of Files. A file opened for writing holds an open stateid
+// until Close, a file opened for reading uses the anonymous stateid. A File is
+// not safe for concurrent use.
+type File struct {
+	f       *Files
+	fh      []byte
+	size    uint64
+	opened  bool
+	stateid Stateid
+	owner   []byte
+	seqid   uint32
+	deleg   *Stateid
+
+	// verifier is the write verifier of the data written UNSTABLE so far.
+	verifier []byte
+}
+
+// OpenRead looks up path for reading.
+func (f *Files) OpenRead(path string) (*File, error) {
+	file := &File{f: f}
+	var attrs *Attrs
+	ops := append(LookupPath(path), GetFH(&file.fh), GetAttr(&attrs, AttrType, AttrSize))
+	if err := f.c.Compound(ops...); err != nil {
+		return nil, err
+	}
+	if attrs.Type == TypeDir {
+		return nil, &Error{Op: OpRead, Status: ErrIsDir}
+	}
+	file.size = attrs.Size
+	return file, nil
+}
+
+// Create opens path for writing, creating it with mode when it does not exist
+// and truncating it when it does.
+func (f *Files) Create(path string, mode uint32) (*File, error) {
+	return f.open(path, true, mode)
+}
+
+// OpenWrite opens the existing file path for writing, its contents are kept.
+func (f *Files) OpenWrite(path string) (*File, error) {
+	return f.open(path, false, 0)
+}
+
+func (f *Files) open(path string, create bool, mode uint32) (*File, error) {
+	dir, name, err := splitParent(path)
+	if err != nil {
+		return nil, err
+	}
+	file := &File{f: f, opened: true}
+	file.owner = []byte(fmt.Sprintf("ncp-%d", atomic.AddUint32(&f.owners, 1)))
+
+	access := uint32(shareAccessWrite)
+	if f.session != nil {
+		access |= wantNoDeleg
+	}
+	var res openResult
+	ops := append(LookupPath(strings.Join(dir, "/")),
+		open(f.clientID, file.owner, file.seqid, access, create, mode, name, &res), GetFH(&file.fh))
+	if err := f.c.Compound(ops...); err != nil {
+		return nil, err
+	}
+	// Sessions replace the seqids of NFSv4.0, they stay 0
+	if f.session == nil {
+		file.seqid++
+	}
+	file.stateid, file.deleg = res.stateid, res.deleg
+	if res.confirm {
+		// The open owner is new to the server, which asks to confirm it once
+		if err := f.c.Compound(PutFH(file.fh), openConfirmOp(file.stateid, file.seqid, &file.stateid)); err != nil {
+			return nil, err
+		}
+		file.seqid++
+	}
+	return file, nil
+}
+
+// Size returns the size of a file opened for reading, when it was opened.
+func (file *File) Size() int64 {
+	return int64(file.size)
+}
+
+// ReadAt reads len(b) bytes at off, in as many READ calls as the server needs.
+// It returns io.EOF when the file ends first.
+func (file *File) ReadAt(b []byte, off int64) (int, error) {
+	n := 0
+	for n < len(b) {
+		count := len(b) - n
+		if count > int(file.f.maxRead) {
+			count = int(file.f.maxRead)
+		}
+		var data []byte
+		var eof bool
+		err := file.f.c.Compound(PutFH(file.fh), Read(file.stateid, uint64(off)+uint64(n), uint32(count), &data, &eof))
+		if err != nil {
+			return n, err
+		}
+		if len(data) > count {
+			return n, fmt.Errorf("nfs4x: READ returned %d bytes, asked for %d", len(data), count)
+		}
+		n += copy(b[n:], data)
+		if eof && n < len(b) {
+			return n, io.EOF
+		}
+		if len(data) == 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	return n, nil
+}
+
+// WriteAt writes b at off, in as many WRITE calls as the server needs. The data
+// is written UNSTABLE and committed by Close. It fails with io.ErrShortWrite
+// when the server stops taking data.
+func (file *File) WriteAt(b []byte, off int64) (int, error) {
+	n := 0
+	for n < len(b) {
+		chunk := b[n:]
+		if len(chunk) > int(file.f.maxWrite) {
+			chunk = chunk[:file.f.maxWrite]
+		}
+		var res WriteResult
+		err := file.f.c.Compound(PutFH(file.fh), Write(file.stateid, uint64(off)+uint64(n), Unstable, chunk, &res))
+		if err != nil {
+			return n, err
+		}
+		if res.Count == 0 || int(res.Count) > len(chunk) {
+			return n, io.ErrShortWrite
+		}
+		if res.Committed != FileSync {
+			if file.verifier == nil {
+				file.verifier = res.Verifier
+			} else if !bytes.Equal(file.verifier, res.Verifier) {
+				return n, errRestarted
+			}
+		}
+		n += int(res.Count)
+	}
+	return n, nil
+}
+
+// Close commits the data written UNSTABLE, then closes a file opened for
+// writing. It fails when the server restarted before the data reached stable
+// storage.
+func (file *File) Close() error {
+	if !file.opened {
+		return nil
+	}
+	var err error
+	if file.verifier != nil {
+		var verifier []byte
+		err = file.f.c.Compound(PutFH(file.fh), Commit(0, 0, &verifier))
+		if err == nil && !bytes.Equal(verifier, file.verifier) {
+			err = errRestarted
+		}
+	}
+	ops := []Op{PutFH(file.fh), closeOp(file.seqid, file.stateid)}
+	if file.deleg != nil {
+		ops = append(ops, delegReturn(*file.deleg))
+	}
+	if cerr := file.f.c.Compound(ops...); err == nil {
+		err = cerr
+	}
+	file.opened = false
+	return err
+}
+
+// WriteResult is the outcome of WRITE, Count bytes reached the server as told
+// by Committed. Data that is not FileSync needs a COMMIT with the same Verifier.
+type WriteResult struct {
+	Count     uint32
+	Committed uint32
+	Verifier  []byte
+}
+
+// Write writes data at offset into the current filehandle, RFC 7530 section
+// 16.36. The server may take fewer bytes than given.
+func Write(stateid Stateid, offset uint64, stable uint32, data []byte, res *WriteResult) Op {
+	return Op{
+		code: OpWrite,
+		encode: func(e *Encoder) {
+			e.Fixed(stateid[:])
+			e.Uint64(offset)
+			e.Uint32(stable)
+			e.Opaque(data)
+		},
+		decode: func(d *Decoder) error {
+			res.Count = d.Uint32()
+			res.Committed = d.Uint32()
+			res.Verifier = d.Fixed(8)
+			return d.Err()
+		},
+	}
+}
+
+// Read reads up to count bytes at offset of the current filehandle into data,
+// eof is set when the data reaches the end of the file.
+func Read(stateid Stateid, offset uint64, count uint32, data *[]byte, eof *bool) Op {
+	return Op{
+		code: OpRead,
+		encode: func(e *Encoder) {
+			e.Fixed(stateid[:])
+			e.Uint64(offset)
+			e.Uint32(count)
+		},
+		decode: func(d *Decoder) error {
+			*eof = d.Bool()
+			*data = d.Opaque()
+			return d.Err()
+		},
+	}
+}
+
+// Commit asks the server to put count bytes of the current filehandle at offset
+// on stable storage, a count of 0 commits to the end of the file. The verifier
+// returned must match the one of the writes.
+func Commit(offset uint64, count uint32, verifier *[]byte) Op {
+	return Op{
+		code: OpCommit,
+		encode: func(e *Encoder) {
+			e.Uint64(offset)
+			e.Uint32(count)
+		},
+		decode: func(d *Decoder) error {
+			*verifier = d.Fixed(8)
+			return d.Err()
+		},
+	}
+}
+
+// openResult is what OPEN returns that the file needs.
+type openResult struct {
+	stateid Stateid
+	confirm bool
+	deleg   *Stateid
+}
+
+// open opens name in the current directory with the share access bits of
+// access. When create is set, the file is created with mode or truncated.
+func open(clientID uint64, owner []byte, seqid, access uint32, create bool, mode uint32, name string, res *openResult) Op {
+	return Op{
+		code: OpOpen,
+		encode: func(e *Encoder) {
+			e.Uint32(seqid)
+			e.Uint32(access)
+			e.Uint32(0) // deny nothing
+			e.Uint64(clientID)
+			e.Opaque(owner)
+			if create {
+				size := uint64(0)
+				e.Uint32(1) // OPEN4_CREATE
+				e.Uint32(0) // UNCHECKED4, an existing file is truncated
+				encodeAttrs(e, SetAttrs{Size: &size, Mode: &mode})
+			} else {
+				e.Uint32(0) // OPEN4_NOCREATE
+			}
+			e.Uint32(0) // CLAIM_NULL
+			e.String(name)
+		},
+		decode: func(d *Decoder) error {
+			copy(res.stateid[:], d.Fixed(16))
+			changeInfo(d)
+			res.confirm = d.Uint32()&openConfirm != 0
+			d.Bitmap() // attributes set
+			res.deleg = decodeDelegation(d)
+			return d.Err()
+		},
+	}
+}
+
+// decodeDelegation reads an open_delegation4 and returns the stateid of the
+// delegation, nil when none was granted.
+func decodeDelegation(d *Decoder) *Stateid {
+	switch kind := d.Uint32(); kind {
+	case 1, 2: // OPEN_DELEGATE_READ, OPEN_DELEGATE_WRITE
+		var id Stateid
+		copy(id[:], d.Fixed(16))
+		d.Bool() // recall
+		if kind == 2 {
+			if d.Uint32() == 1 { // NFS_LIMIT_SIZE
+				d.Uint64()
+			} else { // NFS_LIMIT_BLOCKS
+				d.Uint32()
+				d.Uint32()
+			}
+		}
+		d.Uint32() // ace type
+		d.Uint32() // ace flags
+		d.Uint32() // ace access mask
+		d.Opaque() // ace who
+		return &id
+	case 3: // OPEN_DELEGATE_NONE_EXT, NFSv4.1
+		if why := d.Uint32(); why == 1 || why == 2 {
+			d.Bool()
+		}
+	}
+	return nil
+}
+
+func openConfirmOp(stateid Stateid, seqid uint32, confirmed *Stateid) Op {
+	return Op{
+		code: OpOpenConfirm,
+		encode: func(e *Encoder) {
+			e.Fixed(stateid[:])
+			e.Uint32(seqid)
+		},
+		decode: func(d *Decoder) error {
+			copy(confirmed[:], d.Fixed(16))
+			return d.Err()
+		},
+	}
+}
+
+func closeOp(seqid uint32, stateid Stateid) Op {
+	return Op{
+		code: OpClose,
+		encode: func(e *Encoder) {
+			e.Uint32(seqid)
+			e.Fixed(stateid[:])
+		},
+		decode: func(d *Decoder) error {
+			d.Fixed(16)
+			return d.Err()
+		},
+	}
+}
+
+func delegReturn(stateid Stateid) Op {
+	return Op{code: OpDelegReturn, encode: func(e *Encoder) { e.Fixed(stateid[:]) }}
+}
+
+// setClientID asks for a client ID, RFC 7530 section 16.33. The callback
+// address can not be reached, so the server grants no delegations.
+func setClientID(verifier []byte, id string, clientID *uint64, confirm *[]byte) Op {
+	return Op{
+		code: OpSetClientID,
+		encode: func(e *Encoder) {
+			e.Fixed(verifier)
+			e.String(id)
+			e.Uint32(0x40000000) // callback program
+			e.String("tcp")
+			e.String("0.0.0.0.0.0")
+			e.Uint32(0) // callback ident
+		},
+		decode: func(d *Decoder) error {
+			*clientID = d.Uint64()
+			*confirm = d.Fixed(8)
+			return d.Err()
+		},
+	}
+}
+
+func setClientIDConfirm(clientID uint64, confirm []byte) Op {
+	return Op{
+		code: OpSetClientIDConfirm,
+		encode: func(e *Encoder) {
+			e.Uint64(clientID)
+			e.Fixed(confirm)
+		},
+	}
+}
+
+func renew(clientID uint64) Op {
+	return Op{code: OpRenew, encode: func(e *Encoder) { e.Uint64(clientID) }}
+}
@@ -0,0 +1,789 @@
+package nfs4x
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// call is an op a fakeServer received, with the arguments the tests look at.
+type call struct {
+	op       uint32
+	seqid    uint32
+	stateid  Stateid
+	clientID uint64
+	owner    string
+	create   bool
+	mode     uint32
+	offset   uint64
+	data     []byte
+}
+
+// fakeServer answers the COMPOUND requests of a Client over a pipe. It keeps
+// files in memory, by filehandle, and records every op it receives.
+type fakeServer struct {
+	// lease is the lease time returned, in seconds.
+	lease uint32
+	// maxIO is the MaxRead and MaxWrite returned.
+	maxIO uint64
+	// confirm asks the client to confirm its open owners.
+	confirm bool
+	// deleg grants a write delegation on every OPEN.
+	deleg bool
+	// stable is how WRITE reports the data committed.
+	stable uint32
+	// limit caps the count of a WRITE, 0 takes everything. stall takes nothing.
+	limit uint32
+	stall bool
+	// verifiers are the write verifiers of successive WRITEs, the last one is
+	// repeated. commit is the verifier of COMMIT, verifiers[0] when nil.
+	verifiers [][]byte
+	commit    []byte
+
+	mu     sync.Mutex
+	files  map[string][]byte
+	calls  []call
+	writes int
+}
+
+const testClientID = 0x1234
+
+var (
+	testConfirm = []byte("confirm!")
+	openState   = Stateid{0, 0, 0, 1, 'o', 'p', 'e', 'n'}
+	confirmed   = Stateid{0, 0, 0, 2, 'o', 'p', 'e', 'n'}
+	delegState  = Stateid{0, 0, 0, 1, 'd', 'e', 'l', 'e', 'g'}
+)
+
+// start serves a new Client and returns it.
+func (s *fakeServer) start(t *testing.T) *Client {
+	if s.files == nil {
+		s.files = map[string][]byte{}
+	}
+	if s.verifiers == nil {
+		s.verifiers = [][]byte{[]byte("verifier")}
+	}
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	go s.serve(server)
+	return NewClient(client, Auth{MachineName: "test"})
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			return
+		}
+		msg := make([]byte, binary.BigEndian.Uint32(header[:])&^lastFragment)
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			return
+		}
+		d := NewDecoder(msg)
+		xid := d.Uint32()
+		d.Uint32() // CALL
+		d.Uint32() // RPC version
+		d.Uint32() // program
+		d.Uint32() // version
+		proc := d.Uint32()
+		d.Uint32() // credentials
+		d.Opaque()
+		d.Uint32() // verifier
+		d.Opaque()
+
+		var e Encoder
+		e.Uint32(xid)
+		e.Uint32(1) // REPLY
+		e.Uint32(0) // MSG_ACCEPTED
+		e.Uint32(authNone)
+		e.Opaque(nil)
+		e.Uint32(0) // SUCCESS
+		if proc == procCompound {
+			s.compound(d, &e)
+		}
+		reply := e.Bytes()
+		binary.BigEndian.PutUint32(header[:], lastFragment|uint32(len(reply)))
+		if _, err := conn.Write(append(header[:], reply...)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) compound(d *Decoder, e *Encoder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d.Opaque() // tag
+	d.Uint32() // minor version
+	n := d.Uint32()
+	var res Encoder
+	fh := ""
+	for i := uint32(0); i < n; i++ {
+		c := call{op: d.Uint32()}
+		res.Uint32(c.op)
+		res.Uint32(0)
+		switch c.op {
+		case OpPutRootFH:
+			fh = ""
+		case OpPutFH:
+			fh = string(d.Opaque())
+		case OpLookup:
+			fh += "/" + string(d.Opaque())
+		case OpGetFH:
+			res.Opaque([]byte(fh))
+		case OpGetAttr:
+			var v Encoder
+			var bits []uint32
+			for _, bit := range d.Bitmap() {
+				switch bit {
+				case AttrType:
+					typ := uint32(TypeDir)
+					if _, ok := s.files[fh]; ok {
+						typ = TypeReg
+					}
+					v.Uint32(typ)
+				case AttrSize:
+					v.Uint64(uint64(len(s.files[fh])))
+				case AttrLeaseTime:
+					v.Uint32(s.lease)
+				case AttrMaxRead, AttrMaxWrite:
+					v.Uint64(s.maxIO)
+				default:
+					continue
+				}
+				bits = append(bits, bit)
+			}
+			res.Bitmap(bits...)
+			res.Opaque(v.Bytes())
+		case OpSetClientID:
+			d.Fixed(8) // verifier
+			d.Opaque() // client id
+			d.Uint32() // callback program
+			d.Opaque() // netid
+			d.Opaque() // address
+			d.Uint32() // callback ident
+			res.Uint64(testClientID)
+			res.Fixed(testConfirm)
+		case OpSetClientIDConfirm:
+			c.clientID = d.Uint64()
+			c.data = d.Fixed(8)
+		case OpRenew:
+			c.clientID = d.Uint64()
+		case OpOpen:
+			c.seqid = d.Uint32()
+			d.Uint32() // share access
+			d.Uint32() // share deny
+			c.clientID = d.Uint64()
+			c.owner = string(d.Opaque())
+			if c.create = d.Uint32() == 1; c.create {
+				d.Uint32() // create mode
+				attrs := d.Bitmap()
+				vals := NewDecoder(d.Opaque())
+				for _, bit := range attrs {
+					switch bit {
+					case AttrSize:
+						vals.Uint64()
+					case AttrMode:
+						c.mode = vals.Uint32()
+					}
+				}
+			}
+			d.Uint32() // claim
+			fh += "/" + string(d.Opaque())
+			if _, ok := s.files[fh]; !ok || c.create {
+				s.files[fh] = nil
+			}
+			res.Fixed(openState[:])
+			res.Bool(true)
+			res.Uint64(0)
+			res.Uint64(1)
+			var flags uint32
+			if s.confirm {
+				flags |= openConfirm
+			}
+			res.Uint32(flags)
+			res.Bitmap()
+			if s.deleg {
+				res.Uint32(2) // OPEN_DELEGATE_WRITE
+				res.Fixed(delegState[:])
+				res.Bool(false)
+				res.Uint32(1) // NFS_LIMIT_SIZE
+				res.Uint64(1 << 40)
+				res.Uint32(0)
+				res.Uint32(0)
+				res.Uint32(0)
+				res.String("EVERYONE@")
+			} else {
+				res.Uint32(0)
+			}
+		case OpOpenConfirm:
+			copy(c.stateid[:], d.Fixed(16))
+			c.seqid = d.Uint32()
+			res.Fixed(confirmed[:])
+		case OpWrite:
+			copy(c.stateid[:], d.Fixed(16))
+			c.offset = d.Uint64()
+			d.Uint32() // stable
+			c.data = d.Opaque()
+			count := uint32(len(c.data))
+			if s.limit > 0 && count > s.limit {
+				count = s.limit
+			}
+			if s.stall {
+				count = 0
+			}
+			data := s.files[fh]
+			if end := int(c.offset) + int(count); end > len(data) {
+				data = append(data, make([]byte, end-len(data))...)
+			}
+			copy(data[c.offset:], c.data[:count])
+			s.files[fh] = data
+			verifier := s.verifiers[len(s.verifiers)-1]
+			if s.writes < len(s.verifiers) {
+				verifier = s.verifiers[s.writes]
+			}
+			s.writes++
+			res.Uint32(count)
+			res.Uint32(s.stable)
+			res.Fixed(verifier)
+		case OpRead:
+			copy(c.stateid[:], d.Fixed(16))
+			c.offset = d.Uint64()
+			count := d.Uint32()
+			data := s.files[fh]
+			if c.offset > uint64(len(data)) {
+				c.offset = uint64(len(data))
+			}
+			data = data[c.offset:]
+			if uint32(len(data)) > count {
+				data = data[:count]
+			}
+			res.Bool(int(c.offset)+len(data) == len(s.files[fh]))
+			res.Opaque(data)
+		case OpCommit:
+			c.offset = d.Uint64()
+			d.Uint32()
+			if s.commit != nil {
+				res.Fixed(s.commit)
+			} else {
+				res.Fixed(s.verifiers[0])
+			}
+		case OpClose:
+			c.seqid = d.Uint32()
+			copy(c.stateid[:], d.Fixed(16))
+			res.Fixed(c.stateid[:])
+		case OpDelegReturn:
+			copy(c.stateid[:], d.Fixed(16))
+		}
+		s.calls = append(s.calls, c)
+	}
+	e.Uint32(0) // status
+	e.String("ncp")
+	e.Uint32(n)
+	e.buf.Write(res.Bytes())
+}
+
+// ops returns the calls received of the given kinds, in order.
+func (s *fakeServer) ops(codes ...uint32) []call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []call
+	for _, c := range s.calls {
+		for _, code := range codes {
+			if c.op == code {
+				calls = append(calls, c)
+			}
+		}
+	}
+	return calls
+}
+
+func TestNewFiles(t *testing.T) {
+	s := &fakeServer{lease: 60, maxIO: 32 << 10}
+	files, err := NewFiles(s.start(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+
+	calls := s.ops(OpSetClientID, OpSetClientIDConfirm)
+	if len(calls) != 2 || calls[0].op != OpSetClientID {
+		t.Fatalf("got %+v, want SETCLIENTID then SETCLIENTID_CONFIRM", calls)
+	}
+	if calls[1].clientID != testClientID || !bytes.Equal(calls[1].data, testConfirm) {
+		t.Errorf("confirmed client ID %x with %q, want %x with %q", calls[1].clientID, calls[1].data, testClientID, testConfirm)
+	}
+	if files.clientID != testClientID || files.maxRead != 32<<10 || files.maxWrite != 32<<10 {
+		t.Errorf("client ID %x, max read %d, max write %d", files.clientID, files.maxRead, files.maxWrite)
+	}
+}
+
+func TestIOSize(t *testing.T) {
+	tests := map[uint64]uint32{0: minIO, 4096: 4096, maxIO: maxIO, 16 << 20: maxIO}
+	for v, want := range tests {
+		if got := ioSize(v); got != want {
+			t.Errorf("ioSize(%d) = %d, want %d", v, got, want)
+		}
+	}
+}
+
+func TestFilesRenew(t *testing.T) {
+	s := &fakeServer{lease: 1}
+	files, err := NewFiles(s.start(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The lease is renewed every third of it
+	time.Sleep(800 * time.Millisecond)
+	if err := files.Close(); err != nil {
+		t.Fatal(err)
+	}
+	renewed := s.ops(OpRenew)
+	if len(renewed) < 2 {
+		t.Fatalf("renewed %d times in 800ms with a 1s lease", len(renewed))
+	}
+	for _, c := range renewed {
+		if c.clientID != testClientID {
+			t.Errorf("renewed client ID %x, want %x", c.clientID, testClientID)
+		}
+	}
+	time.Sleep(500 * time.Millisecond)
+	if n := len(s.ops(OpRenew)); n != len(renewed) {
+		t.Errorf("renewed %d more times after Close", n-len(renewed))
+	}
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		confirm bool
+		deleg   bool
+		// state is the stateid the file writes and closes with
+		state Stateid
+		// closeSeqid is the sequence number of CLOSE
+		closeSeqid uint32
+	}{
+		{name: "known owner", state: openState, closeSeqid: 1},
+		{name: "confirmed owner", confirm: true, state: confirmed, closeSeqid: 2},
+		{name: "delegation", deleg: true, state: openState, closeSeqid: 1},
+		{name: "confirmed delegation", confirm: true, deleg: true, state: confirmed, closeSeqid: 2},
+	}
+	for _, tt := range tests {
+		s := &fakeServer{lease: 60, confirm: tt.confirm, deleg: tt.deleg}
+		files, err := NewFiles(s.start(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := files.Create("/srv/data.bin", 0o644)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if _, err := file.WriteAt([]byte("hello"), 0); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := file.Close(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := file.Close(); err != nil {
+			t.Errorf("%s: second Close: %v", tt.name, err)
+		}
+		files.Close()
+
+		calls := s.ops(OpOpen, OpOpenConfirm, OpWrite, OpCommit, OpClose, OpDelegReturn)
+		want := []uint32{OpOpen, OpWrite, OpCommit, OpClose}
+		if tt.confirm {
+			want = []uint32{OpOpen, OpOpenConfirm, OpWrite, OpCommit, OpClose}
+		}
+		if tt.deleg {
+			want = append(want, OpDelegReturn)
+		}
+		if got := codes(calls); !equal(got, want) {
+			t.Errorf("%s: sent %v, want %v", tt.name, got, want)
+			continue
+		}
+		open := calls[0]
+		if !open.create || open.mode != 0o644 || open.seqid != 0 || open.clientID != testClientID || open.owner == "" {
+			t.Errorf("%s: OPEN %+v", tt.name, open)
+		}
+		if tt.confirm && (calls[1].stateid != openState || calls[1].seqid != 1) {
+			t.Errorf("%s: OPEN_CONFIRM of %v with seqid %d, want %v with 1", tt.name, calls[1].stateid, calls[1].seqid, openState)
+		}
+		for _, c := range calls {
+			switch c.op {
+			case OpWrite:
+				if c.stateid != tt.state {
+					t.Errorf("%s: WRITE with %v, want %v", tt.name, c.stateid, tt.state)
+				}
+			case OpClose:
+				if c.stateid != tt.state || c.seqid != tt.closeSeqid {
+					t.Errorf("%s: CLOSE of %v with seqid %d, want %v with %d", tt.name, c.stateid, c.seqid, tt.state, tt.closeSeqid)
+				}
+			case OpDelegReturn:
+				if c.stateid != delegState {
+					t.Errorf("%s: DELEGRETURN of %v, want %v", tt.name, c.stateid, delegState)
+				}
+			}
+		}
+		if got := string(s.files["/srv/data.bin"]); got != "hello" {
+			t.Errorf("%s: server has %q", tt.name, got)
+		}
+	}
+}
+
+func TestOpenOwners(t *testing.T) {
+	s := &fakeServer{lease: 60, confirm: true}
+	files, err := NewFiles(s.start(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+	s.files["/a"] = []byte("keep")
+	a, err := files.OpenWrite("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := files.Create("/b", 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Close()
+	b.Close()
+
+	opens := s.ops(OpOpen)
+	if len(opens) != 2 {
+		t.Fatalf("sent %d OPENs", len(opens))
+	}
+	if opens[0].create || !opens[1].create {
+		t.Errorf("OpenWrite created %v, Create created %v", opens[0].create, opens[1].create)
+	}
+	if opens[0].owner == opens[1].owner {
+		t.Errorf("both files use the open owner %q", opens[0].owner)
+	}
+	for _, c := range s.ops(OpOpen, OpOpenConfirm) {
+		if want := uint32(0); c.op == OpOpenConfirm {
+			want = 1
+			if c.seqid != want {
+				t.Errorf("OPEN_CONFIRM seqid %d, want %d", c.seqid, want)
+			}
+		} else if c.seqid != want {
+			t.Errorf("OPEN seqid %d, want %d", c.seqid, want)
+		}
+	}
+	if got := string(s.files["/a"]); got != "keep" {
+		t.Errorf("OpenWrite left %q, want the file kept", got)
+	}
+	// A file opened for writing and written nothing has nothing to commit
+	if n := len(s.ops(OpCommit)); n != 0 {
+		t.Errorf("sent %d COMMITs for files not written", n)
+	}
+}
+
+func TestWriteAt(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 2000))
+	tests := []struct {
+		name   string
+		server fakeServer
+		writes int
+		err    error
+		// closeErr is the error of Close
+		closeErr error
+		commits  int
+	}{
+		{name: "one write", server: fakeServer{maxIO: 1 << 20}, writes: 1, commits: 1},
+		{name: "split by max write", server: fakeServer{maxIO: 4096}, writes: 5, commits: 1},
+		{name: "short writes", server: fakeServer{maxIO: 1 << 20, limit: 7000}, writes: 3, commits: 1},
+		{name: "file sync", server: fakeServer{maxIO: 4096, stable: FileSync}, writes: 5},
+		{name: "server stops taking data", server: fakeServer{maxIO: 4096, stall: true}, writes: 1, err: io.ErrShortWrite},
+		{
+			name: "restart between writes",
+			server: fakeServer{
+				maxIO:     4096,
+				verifiers: [][]byte{[]byte("before.."), []byte("after...")},
+				commit:    []byte("after..."),
+			},
+			writes: 2, err: errRestarted, closeErr: errRestarted, commits: 1,
+		},
+		{
+			name:   "restart before commit",
+			server: fakeServer{maxIO: 4096, commit: []byte("after...")},
+			writes: 5, closeErr: errRestarted, commits: 1,
+		},
+	}
+	for i := range tests {
+		tt := &tests[i]
+		s := &tt.server
+		s.lease = 60
+		files, err := NewFiles(s.start(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := files.Create("/f", 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := file.WriteAt(data, 100)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: WriteAt error %v, want %v", tt.name, err, tt.err)
+		}
+		if tt.err == nil && n != len(data) {
+			t.Errorf("%s: wrote %d bytes, want %d", tt.name, n, len(data))
+		}
+		if err := file.Close(); !errors.Is(err, tt.closeErr) {
+			t.Errorf("%s: Close error %v, want %v", tt.name, err, tt.closeErr)
+		}
+		files.Close()
+
+		writes := s.ops(OpWrite)
+		if len(writes) != tt.writes {
+			t.Errorf("%s: sent %d WRITEs, want %d", tt.name, len(writes), tt.writes)
+		}
+		off := uint64(100)
+		for _, w := range writes {
+			if w.offset != off {
+				t.Errorf("%s: WRITE at %d, want %d", tt.name, w.offset, off)
+			}
+			count := uint64(len(w.data))
+			if s.limit > 0 && count > uint64(s.limit) {
+				count = uint64(s.limit)
+			}
+			off += count
+		}
+		if n := len(s.ops(OpCommit)); n != tt.commits {
+			t.Errorf("%s: sent %d COMMITs, want %d", tt.name, n, tt.commits)
+		}
+		// A failed commit still closes the file
+		if n := len(s.ops(OpClose)); n != 1 {
+			t.Errorf("%s: sent %d CLOSEs, want 1", tt.name, n)
+		}
+		if tt.err == nil && !bytes.Equal(s.files["/f"][100:], data) {
+			t.Errorf("%s: server has different data", tt.name)
+		}
+	}
+}
+
+func TestOpenRead(t *testing.T) {
+	s := &fakeServer{lease: 60, maxIO: 4}
+	files, err := NewFiles(s.start(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+	s.files["/srv/f"] = []byte("0123456789")
+
+	file, err := files.OpenRead("/srv/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Size() != 10 {
+		t.Errorf("Size() = %d, want 10", file.Size())
+	}
+	b := make([]byte, 6)
+	if n, err := file.ReadAt(b, 2); n != 6 || err != nil || string(b) != "234567" {
+		t.Errorf("ReadAt(6, 2) = %d, %v, %q", n, err, b[:n])
+	}
+	if n, err := file.ReadAt(b, 7); n != 3 || err != io.EOF || string(b[:n]) != "789" {
+		t.Errorf("ReadAt(6, 7) = %d, %v, %q", n, err, b[:n])
+	}
+	if err := file.Close(); err != nil {
+		t.Error(err)
+	}
+	// Reading needs no open state
+	if calls := s.ops(OpOpen, OpClose); len(calls) != 0 {
+		t.Errorf("reading sent %v", codes(calls))
+	}
+	for _, c := range s.ops(OpRead) {
+		if c.stateid != anonymous {
+			t.Errorf("READ with %v, want the anonymous stateid", c.stateid)
+		}
+	}
+
+	var nfsErr *Error
+	if _, err := files.OpenRead("/srv"); !errors.As(err, &nfsErr) || nfsErr.Status != ErrIsDir {
+		t.Errorf("OpenRead of a folder = %v, want ErrIsDir", err)
+	}
+}
+
+func codes(calls []call) []uint32 {
+	var c []uint32
+	for _, call := range calls {
+		c = append(c, call.op)
+	}
+	return c
+}
+
+func equal(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWriteOp(t *testing.T) {
+	stateid := Stateid{0, 0, 0, 1, 'o', 'p', 'e', 'n'}
+	var e Encoder
+	Write(stateid, 1<<32, Unstable, []byte("hello"), nil).encode(&e)
+	d := NewDecoder(e.Bytes())
+	if got := d.Fixed(16); !bytes.Equal(got, stateid[:]) {
+		t.Errorf("stateid = %v", got)
+	}
+	if off, stable, data := d.Uint64(), d.Uint32(), d.Opaque(); off != 1<<32 || stable != Unstable || string(data) != "hello" {
+		t.Errorf("encoded offset %d, stable %d, data %q", off, stable, data)
+	}
+	if d.Err() != nil || d.r.Len() != 0 {
+		t.Errorf("encoding does not end after the data: %v, %d left", d.Err(), d.r.Len())
+	}
+
+	verifier := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	var reply Encoder
+	reply.Uint32(3)
+	reply.Uint32(DataSync)
+	reply.Fixed(verifier)
+	var res WriteResult
+	if err := Write(stateid, 0, Unstable, nil, &res).decode(NewDecoder(reply.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if res.Count != 3 || res.Committed != DataSync || !bytes.Equal(res.Verifier, verifier) {
+		t.Errorf("decoded %+v", res)
+	}
+	if err := Write(stateid, 0, Unstable, nil, &res).decode(NewDecoder(reply.Bytes()[:8])); err == nil {
+		t.Error("a WRITE reply without a verifier was accepted")
+	}
+}
+
+func TestReadOp(t *testing.T) {
+	tests := []struct {
+		name string
+		eof  bool
+		data []byte
+	}{
+		{name: "middle", data: []byte("abcde")},
+		{name: "end", eof: true, data: []byte("xyz")},
+		{name: "past the end", eof: true},
+	}
+	for _, tt := range tests {
+		var e Encoder
+		e.Bool(tt.eof)
+		e.Opaque(tt.data)
+		var data []byte
+		var eof bool
+		if err := Read(anonymous, 0, 1<<20, &data, &eof).decode(NewDecoder(e.Bytes())); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if eof != tt.eof || !bytes.Equal(data, tt.data) {
+			t.Errorf("%s: decoded %q, eof %v", tt.name, data, eof)
+		}
+	}
+}
+
+func TestOpenDecode(t *testing.T) {
+	stateid := Stateid{0, 0, 0, 1, 's', 't', 'a', 't', 'e'}
+	deleg := Stateid{0, 0, 0, 1, 'd', 'e', 'l', 'e', 'g'}
+	ace := func(e *Encoder) {
+		e.Uint32(0)
+		e.Uint32(0)
+		e.Uint32(0)
+		e.String("EVERYONE@")
+	}
+	tests := []struct {
+		name    string
+		rflags  uint32
+		deleg   func(e *Encoder)
+		confirm bool
+		granted bool
+	}{
+		{name: "no delegation", deleg: func(e *Encoder) { e.Uint32(0) }},
+		{name: "confirm", rflags: openConfirm | 4, confirm: true, deleg: func(e *Encoder) { e.Uint32(0) }},
+		{
+			name:    "read delegation",
+			granted: true,
+			deleg: func(e *Encoder) {
+				e.Uint32(1)
+				e.Fixed(deleg[:])
+				e.Bool(false)
+				ace(e)
+			},
+		},
+		{
+			name:    "write delegation limited by size",
+			granted: true,
+			deleg: func(e *Encoder) {
+				e.Uint32(2)
+				e.Fixed(deleg[:])
+				e.Bool(false)
+				e.Uint32(1)
+				e.Uint64(1 << 30)
+				ace(e)
+			},
+		},
+		{
+			name:    "write delegation limited by blocks",
+			granted: true,
+			deleg: func(e *Encoder) {
+				e.Uint32(2)
+				e.Fixed(deleg[:])
+				e.Bool(true)
+				e.Uint32(2)
+				e.Uint32(1024)
+				e.Uint32(4096)
+				ace(e)
+			},
+		},
+		{
+			name: "none with a reason",
+			deleg: func(e *Encoder) {
+				e.Uint32(3)
+				e.Uint32(1) // WND4_CONTENTION
+				e.Bool(false)
+			},
+		},
+		{
+			name: "none without a reason",
+			deleg: func(e *Encoder) {
+				e.Uint32(3)
+				e.Uint32(0) // WND4_NOT_WANTED
+			},
+		},
+	}
+	for _, tt := range tests {
+		var e Encoder
+		e.Fixed(stateid[:])
+		e.Bool(true)
+		e.Uint64(1)
+		e.Uint64(2)
+		e.Uint32(tt.rflags)
+		e.Bitmap(AttrSize, AttrMode)
+		tt.deleg(&e)
+
+		var res openResult
+		d := NewDecoder(e.Bytes())
+		if err := open(1, []byte("ncp-1"), 0, 2, true, 0o644, "file", &res).decode(d); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if d.r.Len() != 0 {
+			t.Errorf("%s: %d bytes left over", tt.name, d.r.Len())
+		}
+		if res.stateid != stateid || res.confirm != tt.confirm {
+			t.Errorf("%s: decoded stateid %v, confirm %v", tt.name, res.stateid, res.confirm)
+		}
+		switch {
+		case tt.granted && (res.deleg == nil || *res.deleg != deleg):
+			t.Errorf("%s: delegation %v, want %v", tt.name, res.deleg, deleg)
+		case !tt.granted && res.deleg != nil:
+			t.Errorf("%s: delegation %v, want none", tt.name, res.deleg)
+		}
+	}
+}
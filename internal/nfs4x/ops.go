@@ -0,0 +1,561 @@
+package nfs4x
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Operation numbers, RFC 7530 and RFC 7862.
+const (
+	OpAccess             = 3
+	OpClose              = 4
+	OpCommit             = 5
+	OpCreate             = 6
+	OpDelegReturn        = 8
+	OpGetAttr            = 9
+	OpGetFH              = 10
+	OpLookup             = 15
+	OpOpen               = 18
+	OpOpenConfirm        = 20
+	OpPutFH              = 22
+	OpPutRootFH          = 24
+	OpRead               = 25
+	OpReadDir            = 26
+	OpRemove             = 28
+	OpRename             = 29
+	OpRenew              = 30
+	OpRestoreFH          = 31
+	OpSaveFH             = 32
+	OpSetAttr            = 34
+	OpSetClientID        = 35
+	OpSetClientIDConfirm = 36
+	OpWrite              = 38
+
+	OpExchangeID      = 42
+	OpCreateSession   = 43
+	OpDestroySession  = 44
+	OpSequence        = 53
+	OpDestroyClientID = 57
+	OpReclaimComplete = 58
+	OpCopy            = 60
+	OpOffloadCancel   = 66
+	OpOffloadStatus   = 67
+	OpClone           = 71
+)
+
+// File types.
+const (
+	TypeReg  = 1
+	TypeDir  = 2
+	TypeBlk  = 3
+	TypeChr  = 4
+	TypeLnk  = 5
+	TypeSock = 6
+	TypeFifo = 7
+)
+
+// Attribute numbers.
+const (
+	AttrType            = 1
+	AttrSize            = 4
+	AttrLeaseTime       = 10
+	AttrCaseInsensitive = 16
+	AttrCasePreserving  = 17
+	AttrChownRestricted = 18
+	AttrFileID          = 20
+	AttrFilesAvail      = 21
+	AttrFilesFree       = 22
+	AttrFilesTotal      = 23
+	AttrMaxFileSize     = 27
+	AttrMaxLink         = 28
+	AttrMaxName         = 29
+	AttrMaxRead         = 30
+	AttrMaxWrite        = 31
+	AttrMode            = 33
+	AttrNoTrunc         = 34
+	AttrNumLinks        = 35
+	AttrOwner           = 36
+	AttrOwnerGroup      = 37
+	AttrSpaceAvail      = 42
+	AttrSpaceFree       = 43
+	AttrSpaceTotal      = 44
+	AttrSpaceUsed       = 45
+	AttrTimeAccess      = 47
+	AttrTimeAccessSet   = 48
+	AttrTimeMetadata    = 52
+	AttrTimeModify      = 53
+	AttrTimeModifySet   = 54
+)
+
+// StatAttrs are the attributes requested by Stat and ReadDir.
+var StatAttrs = []uint32{
+	AttrType, AttrSize, AttrFileID, AttrMode, AttrNumLinks, AttrOwner,
+	AttrOwnerGroup, AttrSpaceUsed, AttrTimeAccess, AttrTimeMetadata, AttrTimeModify,
+}
+
+// FSAttrs are the space and file counts of the file system holding a file.
+var FSAttrs = []uint32{
+	AttrFilesAvail, AttrFilesFree, AttrFilesTotal, AttrSpaceAvail, AttrSpaceFree, AttrSpaceTotal,
+}
+
+// LimitAttrs are the transfer and name limits of the file system holding a file.
+var LimitAttrs = []uint32{
+	AttrCaseInsensitive, AttrCasePreserving, AttrChownRestricted, AttrMaxFileSize,
+	AttrMaxLink, AttrMaxName, AttrMaxRead, AttrMaxWrite, AttrNoTrunc,
+}
+
+// Op is a single operation of a COMPOUND request.
+type Op struct {
+	code   uint32
+	encode func(e *Encoder)
+	decode func(d *Decoder) error
+}
+
+// Attrs are the decoded attributes of a file. Only the attributes returned by
+// the server are set.
+type Attrs struct {
+	Type      uint32
+	Size      uint64
+	FileID    uint64
+	Mode      uint32
+	NumLinks  uint32
+	Owner     string
+	Group     string
+	SpaceUsed uint64
+	Atime     time.Time
+	Ctime     time.Time
+	Mtime     time.Time
+
+	FilesAvail, FilesFree, FilesTotal uint64
+	SpaceAvail, SpaceFree, SpaceTotal uint64
+
+	MaxFileSize, MaxRead, MaxWrite  uint64
+	MaxLink, MaxName                uint32
+	LeaseTime                       uint32
+	CaseInsensitive, CasePreserving bool
+	ChownRestricted, NoTrunc        bool
+}
+
+// decodeAttrs reads a fattr4.
+func decodeAttrs(d *Decoder) (*Attrs, error) {
+	bits := d.Bitmap()
+	vals := NewDecoder(d.Opaque())
+	if err := d.Err(); err != nil {
+		return nil, err
+	}
+	a := &Attrs{}
+	for _, bit := range bits {
+		switch bit {
+		case AttrType:
+			a.Type = vals.Uint32()
+		case AttrSize:
+			a.Size = vals.Uint64()
+		case AttrLeaseTime:
+			a.LeaseTime = vals.Uint32()
+		case AttrFileID:
+			a.FileID = vals.Uint64()
+		case AttrMode:
+			a.Mode = vals.Uint32()
+		case AttrNumLinks:
+			a.NumLinks = vals.Uint32()
+		case AttrOwner:
+			a.Owner = vals.String()
+		case AttrOwnerGroup:
+			a.Group = vals.String()
+		case AttrSpaceUsed:
+			a.SpaceUsed = vals.Uint64()
+		case AttrTimeAccess:
+			a.Atime = vals.Time()
+		case AttrTimeMetadata:
+			a.Ctime = vals.Time()
+		case AttrTimeModify:
+			a.Mtime = vals.Time()
+		case AttrCaseInsensitive:
+			a.CaseInsensitive = vals.Bool()
+		case AttrCasePreserving:
+			a.CasePreserving = vals.Bool()
+		case AttrChownRestricted:
+			a.ChownRestricted = vals.Bool()
+		case AttrFilesAvail:
+			a.FilesAvail = vals.Uint64()
+		case AttrFilesFree:
+			a.FilesFree = vals.Uint64()
+		case AttrFilesTotal:
+			a.FilesTotal = vals.Uint64()
+		case AttrMaxFileSize:
+			a.MaxFileSize = vals.Uint64()
+		case AttrMaxLink:
+			a.MaxLink = vals.Uint32()
+		case AttrMaxName:
+			a.MaxName = vals.Uint32()
+		case AttrMaxRead:
+			a.MaxRead = vals.Uint64()
+		case AttrMaxWrite:
+			a.MaxWrite = vals.Uint64()
+		case AttrNoTrunc:
+			a.NoTrunc = vals.Bool()
+		case AttrSpaceAvail:
+			a.SpaceAvail = vals.Uint64()
+		case AttrSpaceFree:
+			a.SpaceFree = vals.Uint64()
+		case AttrSpaceTotal:
+			a.SpaceTotal = vals.Uint64()
+		default:
+			// Values are packed in bit order, an unknown one can not be skipped
+			return nil, fmt.Errorf("nfs4x: unexpected attribute %d", bit)
+		}
+	}
+	return a, vals.Err()
+}
+
+// PutRootFH sets the current filehandle to the root of the server.
+func PutRootFH() Op {
+	return Op{code: OpPutRootFH}
+}
+
+// PutFH sets the current filehandle.
+func PutFH(fh []byte) Op {
+	return Op{code: OpPutFH, encode: func(e *Encoder) { e.Opaque(fh) }}
+}
+
+// GetFH returns the current filehandle in fh.
+func GetFH(fh *[]byte) Op {
+	return Op{code: OpGetFH, decode: func(d *Decoder) error {
+		*fh = d.Opaque()
+		return d.Err()
+	}}
+}
+
+// SaveFH saves the current filehandle.
+func SaveFH() Op {
+	return Op{code: OpSaveFH}
+}
+
+// RestoreFH makes the saved filehandle current again.
+func RestoreFH() Op {
+	return Op{code: OpRestoreFH}
+}
+
+// Lookup moves the current filehandle to name in the current directory.
+func Lookup(name string) Op {
+	return Op{code: OpLookup, encode: func(e *Encoder) { e.String(name) }}
+}
+
+// GetAttr returns the requested attributes of the current filehandle in attrs.
+func GetAttr(attrs **Attrs, bits ...uint32) Op {
+	return Op{
+		code:   OpGetAttr,
+		encode: func(e *Encoder) { e.Bitmap(bits...) },
+		decode: func(d *Decoder) (err error) {
+			*attrs, err = decodeAttrs(d)
+			return err
+		},
+	}
+}
+
+// DirEntry is an entry returned by READDIR.
+type DirEntry struct {
+	Cookie uint64
+	Name   string
+	Attrs  *Attrs
+}
+
+// dirPage is one READDIR reply.
+type dirPage struct {
+	verifier []byte
+	entries  []DirEntry
+	eof      bool
+}
+
+func readDir(cookie uint64, verifier []byte, page *dirPage, bits ...uint32) Op {
+	return Op{
+		code: OpReadDir,
+		encode: func(e *Encoder) {
+			e.Uint64(cookie)
+			if verifier == nil {
+				verifier = make([]byte, 8)
+			}
+			e.Fixed(verifier)
+			e.Uint32(32 * 1024)  // dircount
+			e.Uint32(128 * 1024) // maxcount
+			e.Bitmap(bits...)
+		},
+		decode: func(d *Decoder) error {
+			page.verifier = d.Fixed(8)
+			for d.Bool() {
+				ent := DirEntry{Cookie: d.Uint64(), Name: d.String()}
+				attrs, err := decodeAttrs(d)
+				if err != nil {
+					return err
+				}
+				ent.Attrs = attrs
+				page.entries = append(page.entries, ent)
+			}
+			page.eof = d.Bool()
+			return d.Err()
+		},
+	}
+}
+
+// LookupPath returns the ops that make path, relative to the server root, the
+// current filehandle.
+func LookupPath(path string) []Op {
+	ops := []Op{PutRootFH()}
+	for _, name := range SplitPath(path) {
+		ops = append(ops, Lookup(name))
+	}
+	return ops
+}
+
+// SplitPath returns the non empty components of path.
+func SplitPath(path string) []string {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name != "" && name != "." {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Stat returns the attributes of path.
+func (c *Client) Stat(path string) (*Attrs, error) {
+	return c.GetAttr(path, StatAttrs...)
+}
+
+// GetAttr returns the requested attributes of path, those the server does not
+// support are left unset.
+func (c *Client) GetAttr(path string, bits ...uint32) (*Attrs, error) {
+	var attrs *Attrs
+	ops := append(LookupPath(path), GetAttr(&attrs, bits...))
+	if err := c.Compound(ops...); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// Access checks which of the access bits in mask the server grants on the
+// current filehandle and returns them in granted.
+func Access(mask uint32, granted *uint32) Op {
+	return Op{
+		code:   OpAccess,
+		encode: func(e *Encoder) { e.Uint32(mask) },
+		decode: func(d *Decoder) error {
+			d.Uint32() // supported
+			*granted = d.Uint32()
+			return d.Err()
+		},
+	}
+}
+
+// Access returns which of the access bits in mask the server grants on path.
+func (c *Client) Access(path string, mask uint32) (uint32, error) {
+	var granted uint32
+	ops := append(LookupPath(path), Access(mask, &granted))
+	if err := c.Compound(ops...); err != nil {
+		return 0, err
+	}
+	return granted, nil
+}
+
+// changeInfo skips a change_info4.
+func changeInfo(d *Decoder) {
+	d.Bool()
+	d.Uint64()
+	d.Uint64()
+}
+
+// CreateDir creates the folder name with the given mode in the current directory.
+func CreateDir(name string, mode uint32) Op {
+	return Op{
+		code: OpCreate,
+		encode: func(e *Encoder) {
+			e.Uint32(TypeDir)
+			e.String(name)
+			e.Bitmap(AttrMode)
+			var v Encoder
+			v.Uint32(mode)
+			e.Opaque(v.Bytes())
+		},
+		decode: func(d *Decoder) error {
+			changeInfo(d)
+			d.Bitmap()
+			return d.Err()
+		},
+	}
+}
+
+// Remove removes name, a file or an empty folder, from the current directory.
+func Remove(name string) Op {
+	return Op{
+		code:   OpRemove,
+		encode: func(e *Encoder) { e.String(name) },
+		decode: func(d *Decoder) error {
+			changeInfo(d)
+			return d.Err()
+		},
+	}
+}
+
+// Rename renames oldName in the saved directory to newName in the current directory.
+func Rename(oldName, newName string) Op {
+	return Op{
+		code: OpRename,
+		encode: func(e *Encoder) {
+			e.String(oldName)
+			e.String(newName)
+		},
+		decode: func(d *Decoder) error {
+			changeInfo(d)
+			changeInfo(d)
+			return d.Err()
+		},
+	}
+}
+
+// splitParent returns the parent folder and the name of path.
+func splitParent(path string) ([]string, string, error) {
+	names := SplitPath(path)
+	if len(names) == 0 {
+		return nil, "", errors.New("nfs4x: the root has no parent")
+	}
+	return names[:len(names)-1], names[len(names)-1], nil
+}
+
+// Mkdir creates the folder path with the given mode, its parent must exist.
+func (c *Client) Mkdir(path string, mode uint32) error {
+	dir, name, err := splitParent(path)
+	if err != nil {
+		return err
+	}
+	ops := append(LookupPath(strings.Join(dir, "/")), CreateDir(name, mode))
+	return c.Compound(ops...)
+}
+
+// Remove removes the file or empty folder at path.
+func (c *Client) Remove(path string) error {
+	dir, name, err := splitParent(path)
+	if err != nil {
+		return err
+	}
+	ops := append(LookupPath(strings.Join(dir, "/")), Remove(name))
+	return c.Compound(ops...)
+}
+
+// Rename moves from to to, replacing to if it exists.
+func (c *Client) Rename(from, to string) error {
+	fromDir, fromName, err := splitParent(from)
+	if err != nil {
+		return err
+	}
+	toDir, toName, err := splitParent(to)
+	if err != nil {
+		return err
+	}
+	ops := append(LookupPath(strings.Join(fromDir, "/")), SaveFH())
+	ops = append(ops, LookupPath(strings.Join(toDir, "/"))...)
+	ops = append(ops, Rename(fromName, toName))
+	return c.Compound(ops...)
+}
+
+// SetAttrs are the attributes changed by SetAttr, nil fields are left alone. A
+// zero time is set to the current time of the server.
+type SetAttrs struct {
+	Size  *uint64
+	Mode  *uint32
+	Owner *string
+	Group *string
+	Atime *time.Time
+	Mtime *time.Time
+}
+
+// encodeAttrs writes a as a fattr4, values in bit order.
+func encodeAttrs(e *Encoder, a SetAttrs) {
+	var (
+		bits []uint32
+		v    Encoder
+	)
+	setTime := func(t time.Time) {
+		if t.IsZero() {
+			v.Uint32(0) // SET_TO_SERVER_TIME4
+			return
+		}
+		v.Uint32(1) // SET_TO_CLIENT_TIME4
+		v.Time(t)
+	}
+	if a.Size != nil {
+		bits = append(bits, AttrSize)
+		v.Uint64(*a.Size)
+	}
+	if a.Mode != nil {
+		bits = append(bits, AttrMode)
+		v.Uint32(*a.Mode)
+	}
+	if a.Owner != nil {
+		bits = append(bits, AttrOwner)
+		v.String(*a.Owner)
+	}
+	if a.Group != nil {
+		bits = append(bits, AttrOwnerGroup)
+		v.String(*a.Group)
+	}
+	if a.Atime != nil {
+		bits = append(bits, AttrTimeAccessSet)
+		setTime(*a.Atime)
+	}
+	if a.Mtime != nil {
+		bits = append(bits, AttrTimeModifySet)
+		setTime(*a.Mtime)
+	}
+	e.Bitmap(bits...)
+	e.Opaque(v.Bytes())
+}
+
+// SetAttr changes the attributes of the current filehandle. It uses the
+// anonymous stateid, so a size change needs no open file.
+func SetAttr(attrs SetAttrs) Op {
+	return Op{
+		code: OpSetAttr,
+		encode: func(e *Encoder) {
+			e.Uint32(0)               // stateid seqid
+			e.Fixed(make([]byte, 12)) // stateid other
+			encodeAttrs(e, attrs)
+		},
+		decode: func(d *Decoder) error {
+			d.Bitmap()
+			return d.Err()
+		},
+	}
+}
+
+// SetAttr changes the attributes of path.
+func (c *Client) SetAttr(path string, attrs SetAttrs) error {
+	ops := append(LookupPath(path), SetAttr(attrs))
+	return c.Compound(ops...)
+}
+
+// ReadDir returns the entries of the directory at path with their attributes.
+func (c *Client) ReadDir(path string) ([]DirEntry, error) {
+	var (
+		fh      []byte
+		page    dirPage
+		entries []DirEntry
+	)
+	ops := append(LookupPath(path), GetFH(&fh), readDir(0, nil, &page, StatAttrs...))
+	if err := c.Compound(ops...); err != nil {
+		return nil, err
+	}
+	for {
+		entries = append(entries, page.entries...)
+		if page.eof || len(page.entries) == 0 {
+			return entries, nil
+		}
+		cookie, verifier := page.entries[len(page.entries)-1].Cookie, page.verifier
+		page = dirPage{}
+		if err := c.Compound(PutFH(fh), readDir(cookie, verifier, &page, StatAttrs...)); err != nil {
+			return nil, err
+		}
+	}
+}
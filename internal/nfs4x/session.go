@@ -0,0 +1,199 @@
+package nfs4x
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Session is an NFSv4.1 or later session on a Client, RFC 5661 section 2.10.
+// Every COMPOUND sent through it starts with SEQUENCE. It has a single slot, so
+// calls are serialized.
+type Session struct {
+	mu       sync.Mutex
+	c        *Client
+	minor    uint32
+	clientID uint64
+	id       []byte
+	seq      uint32
+
+	// maxRequest and maxResponse are the sizes of a COMPOUND the server
+	// agreed to, they bound READ and WRITE.
+	maxRequest, maxResponse uint32
+}
+
+// exchgidUseNonPNFS asks for a client ID for plain file access, without pNFS.
+const exchgidUseNonPNFS = 0x00010000
+
+// NewSession creates a client ID and a session of the given minor version, which
+// must be 1 or more, over c. Sessions have no lease renewal of their own, the
+// SEQUENCE of every call renews it.
+func NewSession(c *Client, minor uint32) (*Session, error) {
+	verifier := make([]byte, 8)
+	rand.Read(verifier)
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("ncp/%s/%d/%x", host, os.Getpid(), verifier)
+
+	s := &Session{c: c, minor: minor}
+	var seq uint32
+	err := c.compound(minor, []Op{exchangeID(verifier, owner, &s.clientID, &seq)})
+	if err != nil {
+		return nil, err
+	}
+	err = c.compound(minor, []Op{createSession(s.clientID, seq, s)})
+	if err != nil {
+		c.compound(minor, []Op{destroyClientID(s.clientID)})
+		return nil, err
+	}
+	s.seq = 1
+	// Nothing is reclaimed, the server may refuse new state until it is told so
+	if err := s.Compound(reclaimComplete()); err != nil && !isStatus(err, ErrCompleteAlready) {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Compound runs ops after a SEQUENCE op as one COMPOUND request.
+func (s *Session) Compound(ops ...Op) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var done bool
+	err := s.c.compound(s.minor, append([]Op{sequence(s.id, s.seq, &done)}, ops...))
+	// The slot moves on once the server has run SEQUENCE, even when a later op failed
+	if done {
+		s.seq++
+	}
+	return err
+}
+
+// Close destroys the session and the client ID, the connection stays open.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.c.compound(s.minor, []Op{destroySession(s.id)})
+	if err2 := s.c.compound(s.minor, []Op{destroyClientID(s.clientID)}); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func isStatus(err error, status uint32) bool {
+	e, ok := err.(*Error)
+	return ok && e.Status == status
+}
+
+func exchangeID(verifier []byte, owner string, clientID *uint64, seq *uint32) Op {
+	return Op{
+		code: OpExchangeID,
+		encode: func(e *Encoder) {
+			e.Fixed(verifier)
+			e.String(owner)
+			e.Uint32(exchgidUseNonPNFS)
+			e.Uint32(0) // SP4_NONE
+			e.Uint32(0) // no implementation id
+		},
+		decode: func(d *Decoder) error {
+			*clientID = d.Uint64()
+			*seq = d.Uint32()
+			d.Uint32() // flags
+			if how := d.Uint32(); how != 0 {
+				return fmt.Errorf("nfs4x: server asked for state protection %d", how)
+			}
+			d.Uint64() // server owner minor id
+			d.Opaque() // server owner major id
+			d.Opaque() // server scope
+			if d.Uint32() > 0 {
+				d.Opaque() // implementation domain
+				d.Opaque() // implementation name
+				d.Time()
+			}
+			return d.Err()
+		},
+	}
+}
+
+// channelAttrs writes a channel_attrs4 for a channel with one slot.
+func channelAttrs(e *Encoder, maxRequest, maxResponse, maxOps uint32) {
+	e.Uint32(0) // header pad
+	e.Uint32(maxRequest)
+	e.Uint32(maxResponse)
+	e.Uint32(4096) // cached response size
+	e.Uint32(maxOps)
+	e.Uint32(1) // slots
+	e.Uint32(0) // no RDMA
+}
+
+// decodeChannelAttrs reads a channel_attrs4 and returns its request and
+// response sizes.
+func decodeChannelAttrs(d *Decoder) (maxRequest, maxResponse uint32) {
+	d.Uint32() // header pad
+	maxRequest, maxResponse = d.Uint32(), d.Uint32()
+	for i := 0; i < 3; i++ {
+		d.Uint32()
+	}
+	if d.Uint32() > 0 {
+		d.Uint32()
+	}
+	return maxRequest, maxResponse
+}
+
+func createSession(clientID uint64, seq uint32, s *Session) Op {
+	return Op{
+		code: OpCreateSession,
+		encode: func(e *Encoder) {
+			e.Uint64(clientID)
+			e.Uint32(seq)
+			e.Uint32(0) // flags, no back channel on this connection
+			// Paths are looked up one name per op, deep ones take many. A
+			// request holds a full READ or WRITE and its headers.
+			channelAttrs(e, maxIO+ioOverhead, maxIO+ioOverhead, 128)
+			channelAttrs(e, 4096, 4096, 2)
+			e.Uint32(0x40000000) // callback program
+			e.Uint32(1)
+			e.Uint32(authNone)
+		},
+		decode: func(d *Decoder) error {
+			s.id = d.Fixed(16)
+			d.Uint32() // sequence
+			d.Uint32() // flags
+			s.maxRequest, s.maxResponse = decodeChannelAttrs(d)
+			decodeChannelAttrs(d)
+			return d.Err()
+		},
+	}
+}
+
+func sequence(id []byte, seq uint32, done *bool) Op {
+	return Op{
+		code: OpSequence,
+		encode: func(e *Encoder) {
+			e.Fixed(id)
+			e.Uint32(seq)
+			e.Uint32(0) // slot
+			e.Uint32(0) // highest slot
+			e.Bool(false)
+		},
+		decode: func(d *Decoder) error {
+			d.Fixed(16)
+			for i := 0; i < 5; i++ {
+				d.Uint32()
+			}
+			*done = true
+			return d.Err()
+		},
+	}
+}
+
+func reclaimComplete() Op {
+	return Op{code: OpReclaimComplete, encode: func(e *Encoder) { e.Bool(false) }}
+}
+
+func destroySession(id []byte) Op {
+	return Op{code: OpDestroySession, encode: func(e *Encoder) { e.Fixed(id) }}
+}
+
+func destroyClientID(clientID uint64) Op {
+	return Op{code: OpDestroyClientID, encode: func(e *Encoder) { e.Uint64(clientID) }}
+}
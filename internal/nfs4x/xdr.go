@@ -0,0 +1,201 @@
+package nfs4x
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// errShort is returned when a reply ends in the middle of a value.
+var errShort = errors.New("nfs4x: short XDR data")
+
+// Encoder writes XDR (RFC 4506) values.
+type Encoder struct {
+	buf bytes.Buffer
+}
+
+// Uint32 writes an unsigned integer.
+func (e *Encoder) Uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+// Uint64 writes an unsigned hyper integer.
+func (e *Encoder) Uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+// Bool writes a boolean.
+func (e *Encoder) Bool(v bool) {
+	if v {
+		e.Uint32(1)
+	} else {
+		e.Uint32(0)
+	}
+}
+
+// Fixed writes fixed length opaque data.
+func (e *Encoder) Fixed(b []byte) {
+	e.buf.Write(b)
+	e.pad(len(b))
+}
+
+// Opaque writes variable length opaque data.
+func (e *Encoder) Opaque(b []byte) {
+	e.Uint32(uint32(len(b)))
+	e.Fixed(b)
+}
+
+// String writes a string.
+func (e *Encoder) String(s string) {
+	e.Opaque([]byte(s))
+}
+
+// Time writes an nfstime4.
+func (e *Encoder) Time(t time.Time) {
+	e.Uint64(uint64(t.Unix()))
+	e.Uint32(uint32(t.Nanosecond()))
+}
+
+// Bitmap writes a bitmap4 with the given attribute bits set.
+func (e *Encoder) Bitmap(bits ...uint32) {
+	words := bitmap(bits)
+	e.Uint32(uint32(len(words)))
+	for _, w := range words {
+		e.Uint32(w)
+	}
+}
+
+// Bytes returns the encoded data.
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+func (e *Encoder) pad(n int) {
+	if r := n % 4; r != 0 {
+		e.buf.Write(make([]byte, 4-r))
+	}
+}
+
+func bitmap(bits []uint32) []uint32 {
+	var words []uint32
+	for _, b := range bits {
+		for uint32(len(words)) <= b/32 {
+			words = append(words, 0)
+		}
+		words[b/32] |= 1 << (b % 32)
+	}
+	return words
+}
+
+// Decoder reads XDR values. The first error is kept and every later read
+// returns zero values, so callers check Err once after decoding.
+type Decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+// NewDecoder returns a decoder for b.
+func NewDecoder(b []byte) *Decoder {
+	return &Decoder{r: bytes.NewReader(b)}
+}
+
+// Err returns the first error met while decoding.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+func (d *Decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > d.r.Len() {
+		d.err = errShort
+		return nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.err = err
+		return nil
+	}
+	return b
+}
+
+// Uint32 reads an unsigned integer.
+func (d *Decoder) Uint32() uint32 {
+	b := d.read(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// Uint64 reads an unsigned hyper integer.
+func (d *Decoder) Uint64() uint64 {
+	b := d.read(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// Bool reads a boolean.
+func (d *Decoder) Bool() bool {
+	return d.Uint32() != 0
+}
+
+// Fixed reads n bytes of fixed length opaque data.
+func (d *Decoder) Fixed(n int) []byte {
+	b := d.read(n)
+	if r := n % 4; r != 0 {
+		d.read(4 - r)
+	}
+	return b
+}
+
+// Opaque reads variable length opaque data.
+func (d *Decoder) Opaque() []byte {
+	n := d.Uint32()
+	if d.err != nil {
+		return nil
+	}
+	return d.Fixed(int(n))
+}
+
+// String reads a string.
+func (d *Decoder) String() string {
+	return string(d.Opaque())
+}
+
+// Time reads an nfstime4.
+func (d *Decoder) Time() time.Time {
+	sec := int64(d.Uint64())
+	nsec := int64(d.Uint32())
+	return time.Unix(sec, nsec)
+}
+
+// Bitmap reads a bitmap4 and returns the attribute bits that are set, in order.
+func (d *Decoder) Bitmap() []uint32 {
+	n := d.Uint32()
+	if d.err != nil || n > 8 {
+		if d.err == nil {
+			d.err = errors.New("nfs4x: bitmap too long")
+		}
+		return nil
+	}
+	var bits []uint32
+	for i := uint32(0); i < n; i++ {
+		w := d.Uint32()
+		for b := uint32(0); b < 32; b++ {
+			if w&(1<<b) != 0 {
+				bits = append(bits, i*32+b)
+			}
+		}
+	}
+	return bits
+}
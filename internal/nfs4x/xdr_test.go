@@ -0,0 +1,141 @@
+package nfs4x
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestXDRRoundTrip(t *testing.T) {
+	mtime := time.Unix(1700000000, 123456789)
+	var e Encoder
+	e.Uint32(0xdeadbeef)
+	e.Uint64(1 << 40)
+	e.Bool(true)
+	e.Bool(false)
+	e.Fixed([]byte{1, 2, 3})
+	e.Opaque([]byte{4, 5, 6, 7, 8})
+	e.String("export")
+	e.Opaque(nil)
+	e.Time(mtime)
+	e.Bitmap(AttrType, AttrSize, AttrMode, AttrTimeModify)
+
+	b := e.Bytes()
+	if len(b)%4 != 0 {
+		t.Fatalf("encoded %d bytes, want a multiple of 4", len(b))
+	}
+	d := NewDecoder(b)
+	if v := d.Uint32(); v != 0xdeadbeef {
+		t.Errorf("Uint32 = %#x", v)
+	}
+	if v := d.Uint64(); v != 1<<40 {
+		t.Errorf("Uint64 = %d", v)
+	}
+	if !d.Bool() || d.Bool() {
+		t.Error("Bool did not round trip")
+	}
+	if v := d.Fixed(3); !bytes.Equal(v, []byte{1, 2, 3}) {
+		t.Errorf("Fixed = %v", v)
+	}
+	if v := d.Opaque(); !bytes.Equal(v, []byte{4, 5, 6, 7, 8}) {
+		t.Errorf("Opaque = %v", v)
+	}
+	if v := d.String(); v != "export" {
+		t.Errorf("String = %q", v)
+	}
+	if v := d.Opaque(); len(v) != 0 {
+		t.Errorf("empty Opaque = %v", v)
+	}
+	if v := d.Time(); !v.Equal(mtime) {
+		t.Errorf("Time = %v, want %v", v, mtime)
+	}
+	want := []uint32{AttrType, AttrSize, AttrMode, AttrTimeModify}
+	if v := d.Bitmap(); !reflect.DeepEqual(v, want) {
+		t.Errorf("Bitmap = %v, want %v", v, want)
+	}
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.r.Len() != 0 {
+		t.Errorf("%d bytes left over", d.r.Len())
+	}
+}
+
+func TestDecoderShort(t *testing.T) {
+	var e Encoder
+	e.Opaque([]byte("a longer value"))
+	b := e.Bytes()
+
+	tests := []struct {
+		name string
+		data []byte
+		read func(d *Decoder)
+	}{
+		{name: "uint32", data: []byte{0, 0, 1}, read: func(d *Decoder) { d.Uint32() }},
+		{name: "uint64", data: []byte{0, 0, 0, 0, 0, 1}, read: func(d *Decoder) { d.Uint64() }},
+		{name: "opaque", data: b[:len(b)-4], read: func(d *Decoder) { d.Opaque() }},
+		{name: "fixed padding", data: []byte{1, 2, 3}, read: func(d *Decoder) { d.Fixed(3) }},
+		{name: "bitmap", data: []byte{0, 0, 0, 2, 0, 0, 0, 1}, read: func(d *Decoder) { d.Bitmap() }},
+	}
+	for _, tt := range tests {
+		d := NewDecoder(tt.data)
+		tt.read(d)
+		if !errors.Is(d.Err(), errShort) {
+			t.Errorf("%s: Err = %v, want %v", tt.name, d.Err(), errShort)
+		}
+		// Reads after the first error return zero values
+		if v := d.Uint32(); v != 0 {
+			t.Errorf("%s: Uint32 after an error = %d", tt.name, v)
+		}
+	}
+
+	d := NewDecoder([]byte{0, 0, 0, 9})
+	d.Bitmap()
+	if d.Err() == nil {
+		t.Error("a bitmap of 9 words was accepted")
+	}
+}
+
+func TestAttrsRoundTrip(t *testing.T) {
+	size, mode := uint64(4096), uint32(0o640)
+	owner, group := "1000", "users"
+	tests := []struct {
+		name  string
+		attrs SetAttrs
+		want  Attrs
+	}{
+		{name: "none", want: Attrs{}},
+		{name: "size", attrs: SetAttrs{Size: &size}, want: Attrs{Size: size}},
+		{
+			name:  "all",
+			attrs: SetAttrs{Size: &size, Mode: &mode, Owner: &owner, Group: &group},
+			want:  Attrs{Size: size, Mode: mode, Owner: owner, Group: group},
+		},
+	}
+	for _, tt := range tests {
+		var e Encoder
+		encodeAttrs(&e, tt.attrs)
+		got, err := decodeAttrs(NewDecoder(e.Bytes()))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: decoded %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+func TestDecodeAttrsUnknown(t *testing.T) {
+	var e Encoder
+	e.Bitmap(AttrSize, 63)
+	var v Encoder
+	v.Uint64(1)
+	v.Uint32(2)
+	e.Opaque(v.Bytes())
+	if _, err := decodeAttrs(NewDecoder(e.Bytes())); err == nil {
+		t.Error("an unknown attribute was accepted")
+	}
+}
@@ -0,0 +1,138 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"time"
+
+	"github.com/go-nfs/nfsv3/nfs"
+	"github.com/go-nfs/nfsv3/nfs/rpc"
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/nfs4x"
+)
+
+// Pinger sends NULL calls to the NFS service of a server.
+type Pinger interface {
+	Null() error
+	Close() error
+}
+
+// DialNull connects to the NFS service of host for NULL calls over NFS
+// version "3" or "4".
+func DialNull(ctx context.Context, host, port, version string, ioTimeout time.Duration) (Pinger, error) {
+	addr := net.JoinHostPort(host, port)
+	switch version {
+	case "3":
+		var client *rpc.Client
+		err := helper.WithV3Timeout(ioTimeout, func() (err error) {
+			client, err = rpc.DialTCP("tcp", nil, addr)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &v3Pinger{client}, nil
+	case "4":
+		conn, err := helper.DialTimeout(ctx, addr, ioTimeout)
+		if err != nil {
+			return nil, err
+		}
+		name, _ := os.Hostname()
+		return nfs4x.NewClient(conn, nfs4x.Auth{MachineName: name}), nil
+	}
+	return nil, fmt.Errorf("unsupported NFS version %q, expected 3 or 4", version)
+}
+
+type v3Pinger struct {
+	client *rpc.Client
+}
+
+func (p *v3Pinger) Null() error {
+	_, err := p.client.Call(&rpc.Header{
+		Rpcvers: 2,
+		Prog:    nfs.Nfs3Prog,
+		Vers:    nfs.Nfs3Vers,
+		Proc:    0,
+		Cred:    rpc.AuthNull,
+		Verf:    rpc.AuthNull,
+	})
+	return err
+}
+
+func (p *v3Pinger) Close() error {
+	return p.client.Close()
+}
+
+// Stats are the round trip times of the NULL calls sent to one NFS version.
+type Stats struct {
+	Version  string
+	Sent     int
+	Received int
+	Min      time.Duration
+	Max      time.Duration
+	sum      time.Duration
+	sumSq    float64
+}
+
+// Add records a call answered after rtt.
+func (s *Stats) Add(rtt time.Duration) {
+	s.Sent++
+	s.Received++
+	if s.Received == 1 || rtt < s.Min {
+		s.Min = rtt
+	}
+	if rtt > s.Max {
+		s.Max = rtt
+	}
+	s.sum += rtt
+	s.sumSq += float64(rtt) * float64(rtt)
+}
+
+// Lost records a call that failed or was not answered.
+func (s *Stats) Lost() {
+	s.Sent++
+}
+
+// Avg returns the mean round trip time.
+func (s *Stats) Avg() time.Duration {
+	if s.Received == 0 {
+		return 0
+	}
+	return s.sum / time.Duration(s.Received)
+}
+
+// StdDev returns the standard deviation of the round trip times.
+func (s *Stats) StdDev() time.Duration {
+	if s.Received == 0 {
+		return 0
+	}
+	mean := float64(s.sum) / float64(s.Received)
+	return time.Duration(math.Sqrt(math.Max(0, s.sumSq/float64(s.Received)-mean*mean)))
+}
+
+// Loss returns the share of calls lost in percent.
+func (s *Stats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Sent-s.Received) * 100 / float64(s.Sent)
+}
+
+// MarshalJSON writes the times in milliseconds.
+func (s *Stats) MarshalJSON() ([]byte, error) {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return json.Marshal(struct {
+		Version  string  `json:"nfs_version"`
+		Sent     int     `json:"sent"`
+		Received int     `json:"received"`
+		Loss     float64 `json:"loss_percent"`
+		Min      float64 `json:"min_ms"`
+		Avg      float64 `json:"avg_ms"`
+		Max      float64 `json:"max_ms"`
+		StdDev   float64 `json:"stddev_ms"`
+	}{s.Version, s.Sent, s.Received, s.Loss(), ms(s.Min), ms(s.Avg()), ms(s.Max), ms(s.StdDev())})
+}
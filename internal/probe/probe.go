@@ -0,0 +1,167 @@
+// Package probe asks an NFS server what it offers: its exports, the RPC
+// programs it registered and how fast it answers, without mounting anything.
+package probe
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-nfs/nfsv3/nfs"
+	"github.com/go-nfs/nfsv3/nfs/rpc"
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/nfs4x"
+)
+
+// Export is a directory exported by the server and the clients allowed to mount it.
+type Export struct {
+	Dir    string   `json:"dir"`
+	Groups []string `json:"groups"`
+}
+
+// MatchExport returns the deepest of exports containing the server path p, nil
+// when none does.
+func MatchExport(exports []Export, p string) *Export {
+	p = path.Clean("/" + p)
+	var best *Export
+	for i, e := range exports {
+		dir := path.Clean("/" + e.Dir)
+		if dir == "/" || p == dir || strings.HasPrefix(p, dir+"/") {
+			if best == nil || len(dir) > len(path.Clean("/"+best.Dir)) {
+				best = &exports[i]
+			}
+		}
+	}
+	return best
+}
+
+// Exports lists the exports of host with MOUNTPROC3_EXPORT, like showmount -e.
+// Every RPC is bounded by ioTimeout.
+func Exports(host string, ioTimeout time.Duration) ([]Export, error) {
+	var mount *nfs.Mount
+	err := helper.WithV3Timeout(ioTimeout, func() (err error) {
+		mount, err = nfs.DialMount(host, false)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to dial MOUNT service: %w", err)
+	}
+	defer mount.Close()
+
+	res, err := mount.Call(&rpc.Header{
+		Rpcvers: 2,
+		Prog:    nfs.MountProg,
+		Vers:    nfs.MountVers,
+		Proc:    nfs.MountProc3Export,
+		Cred:    rpc.AuthNull,
+		Verf:    rpc.AuthNull,
+	})
+	if err != nil {
+		return nil, err
+	}
+	d, err := decoder(res)
+	if err != nil {
+		return nil, err
+	}
+	var exports []Export
+	for d.Bool() {
+		e := Export{Dir: d.String(), Groups: []string{}}
+		for d.Bool() {
+			e.Groups = append(e.Groups, d.String())
+		}
+		exports = append(exports, e)
+	}
+	return exports, d.Err()
+}
+
+// Program is an RPC program registered with the portmapper.
+type Program struct {
+	Program  uint32 `json:"program"`
+	Version  uint32 `json:"version"`
+	Protocol string `json:"protocol"`
+	Port     uint32 `json:"port"`
+	Name     string `json:"name"`
+}
+
+// pmapProcDump lists all mappings, RFC 1833.
+const pmapProcDump = 4
+
+// programNames are the well known programs of an NFS server.
+var programNames = map[uint32]string{
+	100000: "portmapper",
+	100003: "nfs",
+	100005: "mountd",
+	100011: "rquotad",
+	100021: "nlockmgr",
+	100024: "status",
+	100227: "nfs_acl",
+}
+
+// Programs lists the programs registered with the portmapper of host, like rpcinfo -p.
+// Every RPC is bounded by ioTimeout.
+func Programs(host string, ioTimeout time.Duration) ([]Program, error) {
+	var pm *rpc.Portmapper
+	err := helper.WithV3Timeout(ioTimeout, func() (err error) {
+		pm, err = rpc.DialPortmapper("tcp", host)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to dial portmapper: %w", err)
+	}
+	defer pm.Close()
+
+	res, err := pm.Call(&rpc.Header{
+		Rpcvers: 2,
+		Prog:    rpc.PmapProg,
+		Vers:    rpc.PmapVers,
+		Proc:    pmapProcDump,
+		Cred:    rpc.AuthNull,
+		Verf:    rpc.AuthNull,
+	})
+	if err != nil {
+		return nil, err
+	}
+	d, err := decoder(res)
+	if err != nil {
+		return nil, err
+	}
+	var programs []Program
+	for d.Bool() {
+		p := Program{Program: d.Uint32(), Version: d.Uint32()}
+		switch prot := d.Uint32(); prot {
+		case rpc.IPProtoTCP:
+			p.Protocol = "tcp"
+		case rpc.IPProtoUDP:
+			p.Protocol = "udp"
+		default:
+			p.Protocol = fmt.Sprint(prot)
+		}
+		p.Port = d.Uint32()
+		p.Name = programNames[p.Program]
+		programs = append(programs, p)
+	}
+	sort.SliceStable(programs, func(i, j int) bool {
+		a, b := programs[i], programs[j]
+		if a.Program != b.Program {
+			return a.Program < b.Program
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Protocol < b.Protocol
+	})
+	return programs, d.Err()
+}
+
+// decoder reads the rest of a reply. The XDR helpers of the v3 library do not
+// skip the padding of strings, the NFS v4 decoder does.
+func decoder(r io.Reader) (*nfs4x.Decoder, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return nfs4x.NewDecoder(b), nil
+}
@@ -0,0 +1,43 @@
+package probe
+
+import "testing"
+
+func TestMatchExport(t *testing.T) {
+	exports := []Export{{Dir: "/srv"}, {Dir: "/srv/data/"}, {Dir: "/home"}, {Dir: "/srv/data/archive"}}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/srv", want: "/srv"},
+		{path: "/srv/www/index.html", want: "/srv"},
+		{path: "/srv/data", want: "/srv/data/"},
+		{path: "srv/data/file", want: "/srv/data/"},
+		{path: "/srv/data/archive/2023", want: "/srv/data/archive"},
+		{path: "/srv/database", want: "/srv"},
+		{path: "/home/../srv/data", want: "/srv/data/"},
+		{path: "/homes"},
+		{path: "/"},
+	}
+	for _, tt := range tests {
+		got := MatchExport(exports, tt.path)
+		switch {
+		case got == nil && tt.want != "":
+			t.Errorf("MatchExport(%q) = nil, want %q", tt.path, tt.want)
+		case got != nil && got.Dir != tt.want:
+			t.Errorf("MatchExport(%q) = %q, want %q", tt.path, got.Dir, tt.want)
+		}
+	}
+}
+
+func TestMatchExportRoot(t *testing.T) {
+	exports := []Export{{Dir: "/"}, {Dir: "/srv"}}
+	if got := MatchExport(exports, "/home/user"); got == nil || got.Dir != "/" {
+		t.Errorf("MatchExport(/home/user) = %v, want /", got)
+	}
+	if got := MatchExport(exports, "/srv/data"); got == nil || got.Dir != "/srv" {
+		t.Errorf("MatchExport(/srv/data) = %v, want /srv", got)
+	}
+	if got := MatchExport(nil, "/srv"); got != nil {
+		t.Errorf("MatchExport with no exports = %v, want nil", got)
+	}
+}
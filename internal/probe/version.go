@@ -0,0 +1,174 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-nfs/nfsv3/nfs"
+	"github.com/go-nfs/nfsv3/nfs/rpc"
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/nfs4x"
+)
+
+// maxMinor is the highest NFS v4 minor version probed, 4.2 per RFC 7862.
+const maxMinor = 2
+
+// cacheTTL is how long a negotiated version is reused before the server is probed again.
+const cacheTTL = 24 * time.Hour
+
+// Negotiated is the NFS version chosen for a server.
+type Negotiated struct {
+	// Version is "4" or "3".
+	Version string `json:"version"`
+	// Minors are the NFS v4 minor versions the server accepts, even when v3 was chosen.
+	Minors  []uint32  `json:"minors"`
+	Checked time.Time `json:"checked"`
+}
+
+// HasMinor reports whether the server accepts NFS v4 minor version minor.
+func (n *Negotiated) HasMinor(minor uint32) bool {
+	for _, m := range n.Minors {
+		if m == minor {
+			return true
+		}
+	}
+	return false
+}
+
+// MinorVersions returns the NFS v4 minor versions, up to 4.2, that the server
+// on host and port accepts. It fails when the server does not speak NFS v4 at all.
+func MinorVersions(ctx context.Context, host, port string, ioTimeout time.Duration) ([]uint32, error) {
+	conn, err := helper.DialTimeout(ctx, net.JoinHostPort(host, port), ioTimeout)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := os.Hostname()
+	client := nfs4x.NewClient(conn, nfs4x.Auth{MachineName: name})
+	defer client.Close()
+
+	minors := []uint32{}
+	for minor := uint32(0); minor <= maxMinor; minor++ {
+		err := client.MinorVersion(minor)
+		var nfsErr *nfs4x.Error
+		switch {
+		case err == nil:
+			minors = append(minors, minor)
+		case errors.As(err, &nfsErr) && nfsErr.Status == nfs4x.ErrMinorVers:
+		default:
+			return nil, err
+		}
+	}
+	return minors, nil
+}
+
+// MountV3 checks that the MOUNT v3 service of host answers, which NFS v3 needs.
+// Every RPC is bounded by ioTimeout.
+func MountV3(host string, ioTimeout time.Duration) error {
+	var mount *nfs.Mount
+	err := helper.WithV3Timeout(ioTimeout, func() (err error) {
+		mount, err = nfs.DialMount(host, false)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to dial MOUNT service: %w", err)
+	}
+	defer mount.Close()
+	_, err = mount.Call(&rpc.Header{
+		Rpcvers: 2,
+		Prog:    nfs.MountProg,
+		Vers:    nfs.MountVers,
+		Proc:    0, // NULL
+		Cred:    rpc.AuthNull,
+		Verf:    rpc.AuthNull,
+	})
+	return err
+}
+
+// Negotiate picks the NFS version for host: NFS v4 when the server accepts one
+// of its minor versions, otherwise NFS v3 when its mount protocol answers.
+func Negotiate(ctx context.Context, host, port string, ioTimeout time.Duration) (*Negotiated, error) {
+	n := &Negotiated{Minors: []uint32{}, Checked: time.Now()}
+	minors, err4 := MinorVersions(ctx, host, port, ioTimeout)
+	if err4 == nil {
+		n.Minors = minors
+		if len(minors) > 0 {
+			n.Version = "4"
+			return n, nil
+		}
+		err4 = fmt.Errorf("no minor version up to 4.%d is offered", maxMinor)
+	}
+	err3 := MountV3(host, ioTimeout)
+	if err3 != nil {
+		return nil, fmt.Errorf("no NFS version usable on %s, v4: %v, v3: %v", host, err4, err3)
+	}
+	n.Version = "3"
+	return n, nil
+}
+
+// Cached returns the version negotiated with host and port during the last
+// day, or negotiates it and remembers the result. The cache is only a shortcut,
+// failing to read or write it is not an error.
+func Cached(ctx context.Context, host, port string, ioTimeout time.Duration) (*Negotiated, error) {
+	file := cachePath()
+	key := net.JoinHostPort(host, port)
+	cache := map[string]*Negotiated{}
+	if b, err := os.ReadFile(file); err == nil {
+		json.Unmarshal(b, &cache)
+	}
+	if n, ok := cache[key]; ok && n != nil && time.Since(n.Checked) < cacheTTL {
+		return n, nil
+	}
+
+	n, err := Negotiate(ctx, host, port, ioTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if file != "" {
+		cache[key] = n
+		writeCache(file, cache)
+	}
+	return n, nil
+}
+
+// cachePath returns the file negotiated versions are kept in, empty when the
+// system has no cache directory.
+func cachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ncp", "versions.json")
+}
+
+// writeCache replaces the cache file, through a rename so concurrent runs
+// never read half of it.
+func writeCache(file string, cache map[string]*Negotiated) {
+	b, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".versions-*.json")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,220 @@
+package remote
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kha7iq/ncp/internal/config"
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/urfave/cli/v2"
+)
+
+// Location is a command line argument naming either a local path or a path on
+// an NFS server, written as host:/path, @profile:/path or as an nfs:// URL.
+type Location struct {
+	// Host is empty for a local path and for a profile.
+	Host string
+	// Profile is the profile of the config file that names the server.
+	Profile string
+	Path    string
+	// Port and Version are empty when the argument does not set them.
+	Port    string
+	Version string
+	UID     *uint32
+	GID     *uint32
+	// Root and Addrs come from the profile, the argument can not set them.
+	Root  string
+	Addrs []string
+	// Dir is set when the argument ends with a slash.
+	Dir bool
+}
+
+// ParseLocation parses a local path, an scp style host:/path or host:path, a
+// path on the server of a profile as @profile:/path, or an RFC 2224 style
+// nfs://host:port/path?version=4&uid=1000&gid=1000. Like scp, a local path with
+// a colon before its first slash needs a ./ in front.
+func ParseLocation(arg string) (Location, error) {
+	if strings.HasPrefix(arg, "nfs://") {
+		return parseURL(arg)
+	}
+	loc := Location{Path: arg, Dir: strings.HasSuffix(arg, "/")}
+	if strings.HasPrefix(arg, "@") {
+		name, p, ok := strings.Cut(arg[1:], ":")
+		if !ok || name == "" {
+			return Location{}, fmt.Errorf("%s: expected @profile:/path", arg)
+		}
+		loc.Profile, loc.Path = name, Clean(p)
+		return loc, nil
+	}
+	host, p, ok := splitHost(arg)
+	if !ok {
+		return loc, nil
+	}
+	loc.Host, loc.Path = host, Clean(p)
+	return loc, nil
+}
+
+// splitHost splits host:path, host may be an IPv6 address in brackets.
+func splitHost(arg string) (string, string, bool) {
+	if strings.HasPrefix(arg, "[") {
+		end := strings.Index(arg, "]:")
+		if end < 0 {
+			return "", "", false
+		}
+		return arg[1:end], arg[end+2:], true
+	}
+	colon := strings.Index(arg, ":")
+	if colon <= 0 {
+		return "", "", false
+	}
+	if slash := strings.Index(arg, "/"); slash >= 0 && slash < colon {
+		return "", "", false
+	}
+	// A single letter is a Windows drive such as C:\data
+	if colon == 1 {
+		return "", "", false
+	}
+	return arg[:colon], arg[colon+1:], true
+}
+
+func parseURL(arg string) (Location, error) {
+	u, err := url.Parse(arg)
+	if err != nil {
+		return Location{}, err
+	}
+	if u.Hostname() == "" {
+		return Location{}, fmt.Errorf("%s: missing the host of the NFS server", arg)
+	}
+	loc := Location{
+		Host: u.Hostname(),
+		Port: u.Port(),
+		Path: Clean(u.Path),
+		Dir:  strings.HasSuffix(u.Path, "/"),
+	}
+	for key, values := range u.Query() {
+		value := values[len(values)-1]
+		switch key {
+		case "version":
+			loc.Version = value
+		case "uid", "gid":
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return Location{}, fmt.Errorf("%s: invalid %s %q", arg, key, value)
+			}
+			v := uint32(id)
+			if key == "uid" {
+				loc.UID = &v
+			} else {
+				loc.GID = &v
+			}
+		default:
+			return Location{}, fmt.Errorf("%s: unknown parameter %q, expected version, uid or gid", arg, key)
+		}
+	}
+	return loc, nil
+}
+
+// Remote reports whether the location is on an NFS server.
+func (l Location) Remote() bool {
+	return l.Host != "" || l.Profile != ""
+}
+
+// String returns the location as host:/path or @profile:/path, or the local path.
+func (l Location) String() string {
+	if !l.Remote() {
+		return l.Path
+	}
+	if l.Profile != "" {
+		return "@" + l.Profile + ":" + l.Path
+	}
+	host := l.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return host + ":" + l.Path
+}
+
+// Config returns the settings to reach the location. The settings of its profile
+// come first, what the argument and the profile do not set comes from the global
+// credentials and from the nfs-version, port, root and server-ip flags.
+func (l Location) Config(ctx *cli.Context) (Config, error) {
+	if l.Profile != "" {
+		var err error
+		if l, err = l.fromProfile(ctx); err != nil {
+			return Config{}, err
+		}
+	}
+	uid, gid := helper.CheckUID(ctx.Int("uid"), ctx.Int("gid"))
+	if l.UID != nil {
+		uid = *l.UID
+	}
+	if l.GID != nil {
+		gid = *l.GID
+	}
+	cfg := Config{
+		Host:      l.Host,
+		Port:      firstSet(l.Port, ctx.String("port")),
+		UID:       uid,
+		GID:       gid,
+		IOTimeout: ctx.Duration("io-timeout"),
+		Root:      firstSet(l.Root, ctx.String("root")),
+		Export:    ctx.String("export"),
+		NConnect:  ctx.Int("nconnect"),
+		Addrs:     l.Addrs,
+	}
+	if cfg.Addrs == nil {
+		cfg.Addrs = ctx.StringSlice("server-ip")
+	}
+	if _, err := strconv.ParseUint(cfg.Port, 10, 16); err != nil {
+		return cfg, fmt.Errorf("invalid port %q for %s", cfg.Port, net.JoinHostPort(cfg.Host, cfg.Port))
+	}
+	err := cfg.SetVersion(ctx.Context, firstSet(l.Version, ctx.String("nfs-version")))
+	return cfg, err
+}
+
+// fromProfile fills the server settings of the location from its profile.
+func (l Location) fromProfile(ctx *cli.Context) (Location, error) {
+	p, err := config.Lookup(ctx, l.Profile)
+	if err != nil {
+		return l, err
+	}
+	var ok bool
+	if l.Host, ok = p.String("host"); !ok {
+		return l, fmt.Errorf("%s: profile %q does not set a host", l, l.Profile)
+	}
+	l.Port, _ = p.String("port")
+	l.Version, _ = p.String("nfs-version")
+	l.Root, _ = p.String("root")
+	if addrs, ok := p.String("server-ip"); ok {
+		l.Addrs = strings.Split(addrs, ",")
+	}
+	for _, key := range []string{"uid", "gid"} {
+		value, ok := p.String(key)
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return l, fmt.Errorf("profile %q: invalid %s %q", l.Profile, key, value)
+		}
+		v := uint32(id)
+		if key == "uid" {
+			l.UID = &v
+		} else {
+			l.GID = &v
+		}
+	}
+	return l, nil
+}
+
+func firstSet(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package remote
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLocation(t *testing.T) {
+	id := func(v uint32) *uint32 { return &v }
+	tests := []struct {
+		arg  string
+		want Location
+		err  bool
+	}{
+		{arg: "dist", want: Location{Path: "dist"}},
+		{arg: "out/", want: Location{Path: "out/", Dir: true}},
+		{arg: "./a:b", want: Location{Path: "./a:b"}},
+		{arg: "dir/a:b", want: Location{Path: "dir/a:b"}},
+		{arg: `C:\data`, want: Location{Path: `C:\data`}},
+		{arg: "192.168.0.80:/data/src", want: Location{Host: "192.168.0.80", Path: "/data/src"}},
+		{arg: "filer:data/src/", want: Location{Host: "filer", Path: "/data/src", Dir: true}},
+		{arg: "filer:", want: Location{Host: "filer", Path: "/"}},
+		{arg: "[fd00::80]:/data", want: Location{Host: "fd00::80", Path: "/data"}},
+		{arg: "[fd00::80]/data", want: Location{Path: "[fd00::80]/data"}},
+		{arg: "@build:/releases/42/", want: Location{Profile: "build", Path: "/releases/42", Dir: true}},
+		{arg: "@build:releases", want: Location{Profile: "build", Path: "/releases"}},
+		{arg: "@build", err: true},
+		{arg: "@:/releases", err: true},
+		{arg: "nfs://filer/data/src", want: Location{Host: "filer", Path: "/data/src"}},
+		{arg: "nfs://filer:2049/data/", want: Location{Host: "filer", Port: "2049", Path: "/data", Dir: true}},
+		{arg: "nfs://[fd00::80]:2049/data", want: Location{Host: "fd00::80", Port: "2049", Path: "/data"}},
+		{arg: "nfs://filer", want: Location{Host: "filer", Path: "/"}},
+		{
+			arg:  "nfs://filer/data?version=4.1&uid=1000&gid=100",
+			want: Location{Host: "filer", Path: "/data", Version: "4.1", UID: id(1000), GID: id(100)},
+		},
+		{arg: "nfs:///data", err: true},
+		{arg: "nfs://filer/data?uid=root", err: true},
+		{arg: "nfs://filer/data?gid=-1", err: true},
+		{arg: "nfs://filer/data?mode=ro", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLocation(tt.arg)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseLocation(%q) = %+v, want an error", tt.arg, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseLocation(%q): %v", tt.arg, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseLocation(%q) = %+v, want %+v", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestSplitHost(t *testing.T) {
+	tests := []struct {
+		arg        string
+		host, path string
+		ok         bool
+	}{
+		{arg: "filer:/data", host: "filer", path: "/data", ok: true},
+		{arg: "filer:data", host: "filer", path: "data", ok: true},
+		{arg: "[::1]:/data", host: "::1", path: "/data", ok: true},
+		{arg: "[::1]", ok: false},
+		{arg: ":data", ok: false},
+		{arg: "d:/data", ok: false},
+		{arg: "a/b:c", ok: false},
+		{arg: "plain", ok: false},
+	}
+	for _, tt := range tests {
+		host, p, ok := splitHost(tt.arg)
+		if ok != tt.ok || host != tt.host || p != tt.path {
+			t.Errorf("splitHost(%q) = %q, %q, %v, want %q, %q, %v", tt.arg, host, p, ok, tt.host, tt.path, tt.ok)
+		}
+	}
+}
+
+func TestLocationString(t *testing.T) {
+	for _, arg := range []string{"dist", "filer:/data/src", "[fd00::80]:/data", "@build:/releases"} {
+		loc, err := ParseLocation(arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := loc.String(); s != arg {
+			t.Errorf("ParseLocation(%q).String() = %q", arg, s)
+		}
+	}
+}
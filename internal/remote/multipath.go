@@ -0,0 +1,421 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/go-nfs/nfsv3/nfs"
+	"github.com/go-nfs/nfsv3/nfs/rpc"
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/nfs4x"
+)
+
+// stripeSize is the part of a file one connection reads or writes at a time
+// when file data is spread over several connections.
+const stripeSize = 4 << 20
+
+// Conns returns how many connections file data is spread over, NConnect but at
+// least one for every address of the server.
+func (cfg Config) Conns() int {
+	n := cfg.NConnect
+	if len(cfg.Addrs) > 0 && n < len(cfg.Addrs)+1 {
+		n = len(cfg.Addrs) + 1
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// addr returns the address of connection i, the connections go round Host and
+// Addrs.
+func (cfg Config) addr(i int) string {
+	if i%(len(cfg.Addrs)+1) == 0 {
+		return cfg.Host
+	}
+	return cfg.Addrs[i%(len(cfg.Addrs)+1)-1]
+}
+
+// V3Conns are the mounts of one export a worker spreads file data over. The
+// first one is also used for everything else.
+type V3Conns []*nfs.Target
+
+// MountV3Conns mounts the export holding target like MountV3, once for every
+// connection of cfg.
+func MountV3Conns(cfg Config, target string) (V3Conns, string, error) {
+	first, export, err := MountV3(cfg, target)
+	if err != nil {
+		return nil, "", err
+	}
+	conns := V3Conns{first}
+	for i := 1; i < cfg.Conns(); i++ {
+		t, err := mountV3At(cfg, cfg.addr(i), export)
+		if err != nil {
+			conns.Close()
+			return nil, "", fmt.Errorf("connection %d to %s: %w", i+1, cfg.addr(i), err)
+		}
+		conns = append(conns, t)
+	}
+	return conns, export, nil
+}
+
+// mountV3At mounts export through the address host of the server.
+func mountV3At(cfg Config, host, export string) (*nfs.Target, error) {
+	var t *nfs.Target
+	err := helper.WithV3Timeout(cfg.IOTimeout, func() error {
+		mount, err := nfs.DialMount(host, false)
+		if err != nil {
+			return fmt.Errorf("unable to dial MOUNT service: %w", err)
+		}
+		defer mount.Close()
+		if t, err = mount.Mount(export, rpc.NewAuthUnix(machineName(), cfg.UID, cfg.GID).Auth()); err != nil {
+			return fmt.Errorf("unable to mount %s: %w", export, err)
+		}
+		mount.Unmount()
+		return nil
+	})
+	return t, err
+}
+
+// ReadFile copies the contents of rel, relative to the export, from offset to
+// the end into w.
+func (c V3Conns) ReadFile(rel string, offset int64, w io.Writer) (int64, error) {
+	if len(c) == 1 {
+		file, err := c[0].Open(rel)
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return io.Copy(w, file)
+	}
+	info, fh, err := c[0].Lookup(rel)
+	if err != nil {
+		return 0, err
+	}
+	files, err := c.openByFh(fh)
+	if err != nil {
+		return 0, err
+	}
+	defer closeFiles(files)
+	return readStriped(len(c), offset, info.Size()-offset, w, func(conn int, off int64, b []byte) error {
+		if _, err := files[conn].Seek(off, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := io.ReadFull(files[conn], b)
+		return err
+	})
+}
+
+// WriteFile creates or truncates rel, relative to the export, and copies r into
+// it until EOF.
+func (c V3Conns) WriteFile(rel string, perm os.FileMode, r io.Reader) (int64, error) {
+	// OpenFile keeps the old contents of an existing file
+	if _, err := c[0].CreateTruncate(rel, perm, 0); err != nil {
+		return 0, err
+	}
+	if len(c) == 1 {
+		file, err := c[0].OpenFile(rel, perm)
+		if err != nil {
+			return 0, err
+		}
+		n, err := io.Copy(file, r)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		return n, err
+	}
+
+	_, fh, err := c[0].Lookup(rel)
+	if err != nil {
+		return 0, err
+	}
+	files, err := c.openByFh(fh)
+	if err != nil {
+		return 0, err
+	}
+	n, err := writeStriped(len(c), r, func(conn int, off int64, b []byte) error {
+		if _, err := files[conn].Seek(off, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := files[conn].Write(b)
+		return err
+	})
+	// Close commits the file
+	if cerr := closeFiles(files); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// openByFh opens the file fh on every connection.
+func (c V3Conns) openByFh(fh []byte) ([]*nfs.File, error) {
+	files := make([]*nfs.File, 0, len(c))
+	for _, t := range c {
+		file, err := t.OpenByFh(fh, nil)
+		if err != nil {
+			closeFiles(files)
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// closeFiles closes every file and returns the first error.
+func closeFiles(files []*nfs.File) error {
+	var first error
+	for _, f := range files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Close closes every connection.
+func (c V3Conns) Close() error {
+	var first error
+	for _, t := range c {
+		if err := t.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// V4Conns are the connections a worker spreads NFS v4 file data over, each with
+// its own client ID.
+type V4Conns []*nfs4x.Files
+
+// DialV4Conns connects to the server of cfg once for every connection of cfg.
+func DialV4Conns(ctx context.Context, cfg Config) (V4Conns, error) {
+	conns := make(V4Conns, 0, cfg.Conns())
+	for i := 0; i < cfg.Conns(); i++ {
+		files, err := dialV4Files(ctx, cfg, cfg.addr(i))
+		if err != nil {
+			conns.Close()
+			if i == 0 {
+				return nil, err
+			}
+			return nil, fmt.Errorf("connection %d to %s: %w", i+1, cfg.addr(i), err)
+		}
+		conns = append(conns, files)
+	}
+	return conns, nil
+}
+
+func dialV4Files(ctx context.Context, cfg Config, host string) (*nfs4x.Files, error) {
+	client, err := dialV4Client(ctx, cfg, host)
+	if err != nil {
+		return nil, err
+	}
+	files, err := nfs4x.NewFiles(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return files, nil
+}
+
+// ReadFile copies the contents of the server path p from offset to the end into w.
+func (c V4Conns) ReadFile(p string, offset int64, w io.Writer) (int64, error) {
+	files := make([]*nfs4x.File, len(c))
+	for i, f := range c {
+		file, err := f.OpenRead(p)
+		if err != nil {
+			return 0, err
+		}
+		files[i] = file
+	}
+	return readStriped(len(c), offset, files[0].Size()-offset, w, func(conn int, off int64, b []byte) error {
+		n, err := files[conn].ReadAt(b, off)
+		if err == io.EOF || (err == nil && n != len(b)) {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	})
+}
+
+// WriteFile creates or truncates the server path p and copies r into it until
+// EOF. A new file gets mode. Every connection opens the file once and writes
+// its stripes with the same open state, the data is committed when the file is
+// closed.
+func (c V4Conns) WriteFile(p string, mode uint32, r io.Reader) (int64, error) {
+	files := make([]*nfs4x.File, 0, len(c))
+	closeAll := func(err error) error {
+		for _, file := range files {
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}
+	// The first open truncates the file, the others keep what it holds
+	first, err := c[0].Create(p, mode)
+	if err != nil {
+		return 0, err
+	}
+	files = append(files, first)
+	for _, f := range c[1:] {
+		file, err := f.OpenWrite(p)
+		if err != nil {
+			return 0, closeAll(err)
+		}
+		files = append(files, file)
+	}
+	n, err := writeStriped(len(c), r, func(conn int, off int64, b []byte) error {
+		n, err := files[conn].WriteAt(b, off)
+		if err == nil && n != len(b) {
+			err = io.ErrShortWrite
+		}
+		return err
+	})
+	return n, closeAll(err)
+}
+
+// Close closes every connection.
+func (c V4Conns) Close() {
+	for _, files := range c {
+		files.Close()
+	}
+}
+
+// readStriped copies size bytes of a file from offset into w. The file is read
+// in stripes by conns connections at once, readAt fills b with the stripe at
+// off using connection conn. The stripes are written to w in order.
+func readStriped(conns int, offset, size int64, w io.Writer, readAt func(conn int, off int64, b []byte) error) (int64, error) {
+	type stripe struct {
+		off  int64
+		buf  []byte
+		done chan error
+	}
+	// ordered holds the stripes in file order, at most conns of them wait to
+	// be written to w
+	ordered := make(chan *stripe, conns)
+	work := make(chan *stripe)
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < conns; i++ {
+		wg.Add(1)
+		go func(conn int) {
+			defer wg.Done()
+			for s := range work {
+				s.done <- readAt(conn, s.off, s.buf)
+			}
+		}(i)
+	}
+	go func() {
+		defer close(ordered)
+		defer close(work)
+		for off := offset; off < offset+size; off += stripeSize {
+			n := offset + size - off
+			if n > stripeSize {
+				n = stripeSize
+			}
+			s := &stripe{off: off, buf: make([]byte, n), done: make(chan error, 1)}
+			select {
+			case ordered <- s:
+			case <-stop:
+				return
+			}
+			select {
+			case work <- s:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var written int64
+	var err error
+	for s := range ordered {
+		if err = <-s.done; err != nil {
+			err = fmt.Errorf("reading at %d: %w", s.off, err)
+			break
+		}
+		n, werr := w.Write(s.buf)
+		written += int64(n)
+		if werr != nil {
+			err = werr
+			break
+		}
+	}
+	close(stop)
+	for range ordered {
+	}
+	wg.Wait()
+	return written, err
+}
+
+// writeStriped copies r into a file from its start. The data is cut in stripes
+// that conns connections write at once, writeAt writes b at off using
+// connection conn.
+func writeStriped(conns int, r io.Reader, writeAt func(conn int, off int64, b []byte) error) (int64, error) {
+	type stripe struct {
+		off int64
+		buf []byte
+	}
+	work := make(chan stripe)
+	failed := make(chan struct{})
+	var once sync.Once
+	var writeErr error
+
+	var wg sync.WaitGroup
+	for i := 0; i < conns; i++ {
+		wg.Add(1)
+		go func(conn int) {
+			defer wg.Done()
+			for s := range work {
+				if err := writeAt(conn, s.off, s.buf); err != nil {
+					once.Do(func() {
+						writeErr = fmt.Errorf("writing at %d: %w", s.off, err)
+						close(failed)
+					})
+					return
+				}
+			}
+		}(i)
+	}
+
+	var off int64
+	var err error
+read:
+	for {
+		// A free connection may be ready as well, stop before handing it more
+		select {
+		case <-failed:
+			break read
+		default:
+		}
+		buf := make([]byte, stripeSize)
+		n, rerr := io.ReadFull(r, buf)
+		if n > 0 {
+			select {
+			case work <- stripe{off: off, buf: buf[:n]}:
+				off += int64(n)
+			case <-failed:
+				break read
+			}
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			err = rerr
+			break
+		}
+	}
+	close(work)
+	wg.Wait()
+	if err == nil {
+		err = writeErr
+	}
+	return off, err
+}
@@ -0,0 +1,166 @@
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stripedData returns n bytes that differ from one stripe to the next.
+func stripedData(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+// jitter sleeps a little so stripes finish out of order.
+func jitter(off int64) {
+	time.Sleep(time.Duration(off/stripeSize%3) * time.Millisecond)
+}
+
+func TestReadStriped(t *testing.T) {
+	file := stripedData(3*stripeSize + 1234)
+	tests := []struct {
+		name   string
+		conns  int
+		offset int64
+	}{
+		{name: "one connection", conns: 1},
+		{name: "more connections than stripes", conns: 8},
+		{name: "offset", conns: 3, offset: stripeSize + 17},
+		{name: "empty", conns: 2, offset: int64(len(file))},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		n, err := readStriped(tt.conns, tt.offset, int64(len(file))-tt.offset, &out, func(conn int, off int64, b []byte) error {
+			if conn < 0 || conn >= tt.conns {
+				t.Errorf("%s: connection %d out of range", tt.name, conn)
+			}
+			jitter(off)
+			copy(b, file[off:])
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		want := file[tt.offset:]
+		if n != int64(len(want)) || !bytes.Equal(out.Bytes(), want) {
+			t.Errorf("%s: read %d bytes out of order or incomplete, want %d", tt.name, n, len(want))
+		}
+	}
+}
+
+func TestReadStripedErrors(t *testing.T) {
+	file := stripedData(4*stripeSize + 1)
+	failing := errors.New("stale handle")
+
+	// A failed stripe stops the copy after the stripes before it
+	var out bytes.Buffer
+	n, err := readStriped(3, 0, int64(len(file)), &out, func(conn int, off int64, b []byte) error {
+		if off == 2*stripeSize {
+			return failing
+		}
+		copy(b, file[off:])
+		return nil
+	})
+	if !errors.Is(err, failing) {
+		t.Errorf("read error = %v, want %v", err, failing)
+	}
+	if n != 2*stripeSize || !bytes.Equal(out.Bytes(), file[:2*stripeSize]) {
+		t.Errorf("wrote %d bytes before the failed stripe, want %d", n, 2*stripeSize)
+	}
+
+	// A failing writer stops the copy, the readers still in flight are waited for
+	n, err = readStriped(2, 0, int64(len(file)), failingWriter{}, func(conn int, off int64, b []byte) error {
+		return nil
+	})
+	if !errors.Is(err, io.ErrClosedPipe) || n != 0 {
+		t.Errorf("write error = %d, %v, want 0, %v", n, err, io.ErrClosedPipe)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(b []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestWriteStriped(t *testing.T) {
+	tests := []struct {
+		name  string
+		conns int
+		size  int
+	}{
+		{name: "empty", conns: 2},
+		{name: "one stripe", conns: 4, size: 100},
+		{name: "one connection", conns: 1, size: 2*stripeSize + 3},
+		{name: "several", conns: 3, size: 5*stripeSize + 4321},
+	}
+	for _, tt := range tests {
+		data := stripedData(tt.size)
+		var mu sync.Mutex
+		file := make([]byte, tt.size)
+		used := map[int]bool{}
+		n, err := writeStriped(tt.conns, bytes.NewReader(data), func(conn int, off int64, b []byte) error {
+			jitter(off)
+			mu.Lock()
+			defer mu.Unlock()
+			used[conn] = true
+			copy(file[off:], b)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if n != int64(tt.size) || !bytes.Equal(file, data) {
+			t.Errorf("%s: wrote %d bytes, want %d in place", tt.name, n, tt.size)
+		}
+		for conn := range used {
+			if conn < 0 || conn >= tt.conns {
+				t.Errorf("%s: connection %d out of range", tt.name, conn)
+			}
+		}
+	}
+}
+
+func TestWriteStripedErrors(t *testing.T) {
+	data := stripedData(6 * stripeSize)
+	failing := errors.New("no space left")
+	n, err := writeStriped(2, bytes.NewReader(data), func(conn int, off int64, b []byte) error {
+		if off == stripeSize {
+			return failing
+		}
+		// The other connection is still busy when the failure is seen
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	if !errors.Is(err, failing) {
+		t.Errorf("write error = %v, want %v", err, failing)
+	}
+	if n >= int64(len(data)) {
+		t.Errorf("kept writing after a failed stripe, %d bytes handed out", n)
+	}
+
+	readErr := errors.New("input gone")
+	r := io.MultiReader(bytes.NewReader(data[:stripeSize+10]), errReader{readErr})
+	n, err = writeStriped(2, r, func(conn int, off int64, b []byte) error { return nil })
+	if !errors.Is(err, readErr) {
+		t.Errorf("read error = %v, want %v", err, readErr)
+	}
+	// What was read before the error is still written
+	if n != stripeSize+10 {
+		t.Errorf("handed out %d bytes before the read error, want %d", n, stripeSize+10)
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read(b []byte) (int, error) {
+	return 0, r.err
+}
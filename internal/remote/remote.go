@@ -0,0 +1,460 @@
+// Package remote gives the commands that inspect or change files on the server
+// one view of an export, whether it is reached over NFS v3 or NFS v4.
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/probe"
+	"github.com/urfave/cli/v2"
+)
+
+// FileMode is the mode of the files ncp creates on the server, on every upload
+// path. cp --preserve and chmod change it afterwards.
+const FileMode os.FileMode = 0o644
+
+// FS is a file system on an NFS server. Paths are absolute paths on the server.
+type FS interface {
+	// Stat returns the attributes of path, a symbolic link is not followed.
+	Stat(path string) (*FileInfo, error)
+	// ReadDir returns the entries of the directory at path, without "." and "..".
+	ReadDir(path string) ([]*FileInfo, error)
+	// Mkdir creates a folder, its parent must exist.
+	Mkdir(path string, perm os.FileMode) error
+	// Remove removes a file or a symbolic link.
+	Remove(path string) error
+	// RmDir removes an empty folder.
+	RmDir(path string) error
+	// Rename moves from to to, replacing to when it is a file.
+	Rename(from, to string) error
+	// Create creates an empty file, it fails with os.ErrExist if path exists.
+	Create(path string, perm os.FileMode) error
+	// SetAttr changes the attributes of path, a symbolic link is not followed.
+	SetAttr(path string, c Change) error
+	// ReadFile copies the contents of path from offset to the end into w.
+	ReadFile(path string, offset int64, w io.Writer) (int64, error)
+	// WriteFile creates or truncates path and copies r into it until EOF. A
+	// new file gets perm, an existing one keeps its mode.
+	WriteFile(path string, perm os.FileMode, r io.Reader) (int64, error)
+	// StatFS returns the capacity of the file system holding path.
+	StatFS(path string) (*FSStat, error)
+	// Limits returns the transfer sizes and name limits of the file system holding path.
+	Limits(path string) (*Limits, error)
+	// Access returns which of the Access bits in mask the server grants on path
+	// to the credentials in use.
+	Access(path string, mask uint32) (uint32, error)
+	// Version is the NFS version in use.
+	Version() string
+	Close() error
+}
+
+// FileInfo describes a file on the server.
+type FileInfo struct {
+	Name   string
+	Path   string
+	Type   string
+	Size   int64
+	Used   int64
+	Mode   os.FileMode
+	Owner  string
+	Group  string
+	Nlink  uint32
+	FileID uint64
+	Atime  time.Time
+	Mtime  time.Time
+	Ctime  time.Time
+}
+
+// Change lists the attributes changed by SetAttr, nil fields are left alone. A
+// zero Atime or Mtime is set to the current time of the server.
+type Change struct {
+	Mode  *os.FileMode
+	UID   *uint32
+	GID   *uint32
+	Size  *uint64
+	Atime *time.Time
+	Mtime *time.Time
+}
+
+// FSStat is the capacity of a file system. The available counts are what the
+// user may still use, which can be less than what is free.
+type FSStat struct {
+	TotalBytes uint64 `json:"total_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	AvailBytes uint64 `json:"avail_bytes"`
+	TotalFiles uint64 `json:"total_files"`
+	FreeFiles  uint64 `json:"free_files"`
+	AvailFiles uint64 `json:"avail_files"`
+}
+
+// Limits are the limits a server reports for a file system. NFS v4 has no
+// preferred sizes, they are 0 there.
+type Limits struct {
+	ReadMax         uint64 `json:"read_max"`
+	ReadPref        uint64 `json:"read_pref"`
+	WriteMax        uint64 `json:"write_max"`
+	WritePref       uint64 `json:"write_pref"`
+	DirPref         uint64 `json:"readdir_pref"`
+	MaxFileSize     uint64 `json:"max_file_size"`
+	NameMax         uint32 `json:"name_max"`
+	LinkMax         uint32 `json:"link_max"`
+	NoTrunc         bool   `json:"no_trunc"`
+	ChownRestricted bool   `json:"chown_restricted"`
+	CaseInsensitive bool   `json:"case_insensitive"`
+	CasePreserving  bool   `json:"case_preserving"`
+}
+
+// Access bits of FS.Access, NFS v3 and v4 share them.
+const (
+	AccessRead    = 0x01
+	AccessLookup  = 0x02
+	AccessModify  = 0x04
+	AccessExtend  = 0x08
+	AccessDelete  = 0x10
+	AccessExecute = 0x20
+)
+
+// File types of a FileInfo.
+const (
+	TypeFile    = "file"
+	TypeDir     = "dir"
+	TypeSymlink = "symlink"
+	TypeBlock   = "block"
+	TypeChar    = "char"
+	TypeSocket  = "socket"
+	TypeFifo    = "fifo"
+)
+
+// IsDir reports whether the file is a directory.
+func (fi *FileInfo) IsDir() bool {
+	return fi.Type == TypeDir
+}
+
+// MarshalJSON writes the mode in octal along with its symbolic form.
+func (fi *FileInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name        string    `json:"name"`
+		Path        string    `json:"path"`
+		Type        string    `json:"type"`
+		Size        int64     `json:"size"`
+		Used        int64     `json:"used"`
+		Mode        string    `json:"mode"`
+		Permissions string    `json:"permissions"`
+		Owner       string    `json:"owner"`
+		Group       string    `json:"group"`
+		Nlink       uint32    `json:"nlink"`
+		FileID      uint64    `json:"fileid"`
+		Atime       time.Time `json:"atime"`
+		Mtime       time.Time `json:"mtime"`
+		Ctime       time.Time `json:"ctime"`
+	}{
+		fi.Name, fi.Path, fi.Type, fi.Size, fi.Used,
+		fmt.Sprintf("%04o", UnixMode(fi.Mode)), fi.Mode.String(),
+		fi.Owner, fi.Group, fi.Nlink, fi.FileID, fi.Atime, fi.Mtime, fi.Ctime,
+	})
+}
+
+// fileType returns the name of an NFS file type, v3 and v4 share the numbers.
+func fileType(t uint32) string {
+	switch t {
+	case 1:
+		return TypeFile
+	case 2:
+		return TypeDir
+	case 3:
+		return TypeBlock
+	case 4:
+		return TypeChar
+	case 5:
+		return TypeSymlink
+	case 6:
+		return TypeSocket
+	case 7:
+		return TypeFifo
+	}
+	return "unknown"
+}
+
+// fileMode converts the unix permission bits sent by the server to an os.FileMode.
+func fileMode(typ string, mode uint32) os.FileMode {
+	m := os.FileMode(mode & 0o777)
+	if mode&0o4000 != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		m |= os.ModeSticky
+	}
+	switch typ {
+	case TypeDir:
+		m |= os.ModeDir
+	case TypeSymlink:
+		m |= os.ModeSymlink
+	case TypeBlock:
+		m |= os.ModeDevice
+	case TypeChar:
+		m |= os.ModeDevice | os.ModeCharDevice
+	case TypeSocket:
+		m |= os.ModeSocket
+	case TypeFifo:
+		m |= os.ModeNamedPipe
+	}
+	return m
+}
+
+// UnixMode returns the permission bits of m as the server expects them.
+func UnixMode(m os.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		mode |= 0o4000
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= 0o2000
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= 0o1000
+	}
+	return mode
+}
+
+// ParseMode parses permissions given in octal such as 0755.
+func ParseMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0o7777 {
+		return 0, fmt.Errorf("invalid mode %q, expected octal permissions such as 0755", s)
+	}
+	return fileMode(TypeFile, uint32(mode)), nil
+}
+
+// Config selects the server and the protocol of a FS.
+type Config struct {
+	Host    string
+	Port    string
+	Version string
+	// Minor is the NFS v4 minor version, from 4.1 on every call goes through
+	// a session.
+	Minor     uint32
+	UID, GID  uint32
+	IOTimeout time.Duration
+	// Root is the folder on the server that paths are taken from, empty for
+	// the root of the server.
+	Root string
+	// Export is the NFS v3 export to mount, paths are then taken inside it.
+	// When empty the export holding a path is looked up in the export list.
+	Export string
+	// NConnect is the number of connections file data is spread over, see
+	// Conns.
+	NConnect int
+	// Addrs are other addresses of the server, the connections go round Host
+	// and them.
+	Addrs []string
+}
+
+// Flags are the connection flags shared by the remote commands, which negotiate
+// the NFS version with the server unless told otherwise.
+func Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     "host",
+			Aliases:  []string{"t"},
+			Required: true,
+			Usage:    "IP address or DNS of the NFS server.",
+		},
+		&cli.StringFlag{
+			Name:  "nfs-version",
+			Usage: "NFS version to use: 3, 4, 4.1, 4.2, or auto to try v4 and fall back to v3.",
+			Value: "auto",
+		},
+		&cli.StringFlag{
+			Name:    "port",
+			Aliases: []string{"pr"},
+			Usage:   "NFS v4 server port, if other then default.",
+			Value:   "2049",
+		},
+		&cli.StringFlag{
+			Name:  "export",
+			Usage: "Export to mount over NFS v3, paths are then inside it. By default the deepest export holding the path is used.",
+		},
+	}
+}
+
+// FanOutFlags are the connection flags of the uploads, whose --host may be
+// repeated to write to several servers at once.
+func FanOutFlags() []cli.Flag {
+	flags := Flags()
+	flags[0] = &cli.StringSliceFlag{
+		Name:     "host",
+		Aliases:  []string{"t"},
+		Required: true,
+		Usage:    "IP address or DNS of the NFS server, repeat it to upload to several servers at once.",
+	}
+	return flags
+}
+
+// PinVersion sets the --nfs-version flag of cmd to version and hides it, for the
+// commands bound to one NFS version.
+func PinVersion(cmd *cli.Command, version string) {
+	for _, f := range cmd.Flags {
+		if sf, ok := f.(*cli.StringFlag); ok && sf.Name == "nfs-version" {
+			sf.Value, sf.Hidden = version, true
+		}
+	}
+	action := cmd.Action
+	cmd.Action = func(ctx *cli.Context) error {
+		if err := ctx.Set("nfs-version", version); err != nil {
+			return err
+		}
+		return action(ctx)
+	}
+}
+
+// NewConfig reads the connection flags and the global credentials.
+func NewConfig(ctx *cli.Context) (Config, error) {
+	return newConfig(ctx, ctx.String("host"))
+}
+
+// NewConfigs returns a Config for every --host of FanOutFlags.
+func NewConfigs(ctx *cli.Context) ([]Config, error) {
+	var cfgs []Config
+	for _, host := range ctx.StringSlice("host") {
+		cfg, err := newConfig(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", host, err)
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	return cfgs, nil
+}
+
+func newConfig(ctx *cli.Context, host string) (Config, error) {
+	uid, gid := helper.CheckUID(ctx.Int("uid"), ctx.Int("gid"))
+	cfg := Config{
+		Host:      host,
+		Port:      ctx.String("port"),
+		UID:       uid,
+		GID:       gid,
+		IOTimeout: ctx.Duration("io-timeout"),
+		Root:      ctx.String("root"),
+		Export:    ctx.String("export"),
+		NConnect:  ctx.Int("nconnect"),
+		Addrs:     ctx.StringSlice("server-ip"),
+	}
+	err := cfg.SetVersion(ctx.Context, ctx.String("nfs-version"))
+	return cfg, err
+}
+
+// SetVersion selects the NFS version given as 3, 4, 4.1, 4.2 or auto. The auto
+// version and the v4 minor versions are checked with the server, the answer is
+// cached per host.
+func (cfg *Config) SetVersion(ctx context.Context, version string) error {
+	switch version {
+	case "3", "4":
+		cfg.Version = version
+		return nil
+	case "auto":
+		n, err := probe.Cached(ctx, cfg.Host, cfg.Port, cfg.IOTimeout)
+		if err != nil {
+			return err
+		}
+		cfg.Version = n.Version
+		// v4.0 needs no session, the lowest minor version is used otherwise
+		if n.Version == "4" && !n.HasMinor(0) {
+			cfg.Minor = n.Minors[0]
+		}
+		return nil
+	case "4.0", "4.1", "4.2":
+		cfg.Version, cfg.Minor = "4", uint32(version[2]-'0')
+		n, err := probe.Cached(ctx, cfg.Host, cfg.Port, cfg.IOTimeout)
+		if err != nil {
+			return err
+		}
+		if !n.HasMinor(cfg.Minor) {
+			return fmt.Errorf("%s does not offer NFS v%s, it offers minor versions %v", cfg.Host, version, n.Minors)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported NFS version %q, expected 3, 4, 4.1, 4.2 or auto", version)
+}
+
+// Dial connects to the server. Over NFS v3 the export containing target is mounted,
+// so every path used with the FS must be inside it. With an Export or a Root in
+// cfg the paths of the FS, target included, are inside them.
+func Dial(ctx context.Context, cfg Config, target string) (FS, error) {
+	var fsys FS
+	if cfg.Version == "4" {
+		v4, err := dialV4(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		fsys = v4
+	} else {
+		v3, err := dialV3(cfg, cfg.Abs(target))
+		if err != nil {
+			return nil, err
+		}
+		fsys = v3
+	}
+	if root := cfg.Abs("/"); root != "/" {
+		return &rootFS{fs: fsys, root: root}, nil
+	}
+	return fsys, nil
+}
+
+// Abs returns the server path of p, which is inside Export and Root.
+func (cfg Config) Abs(p string) string {
+	return path.Join(Clean(cfg.Export), Clean(cfg.Root), Clean(p))
+}
+
+// Clean returns p as an absolute server path.
+func Clean(p string) string {
+	return path.Clean("/" + p)
+}
+
+func machineName() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+func owner(id uint32) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// CommonDir returns the deepest directory containing all the given server paths.
+func CommonDir(paths []string) string {
+	if len(paths) == 0 {
+		return "/"
+	}
+	dir := Clean(paths[0])
+	for _, p := range paths[1:] {
+		p = Clean(p)
+		for dir != "/" && p != dir && !strings.HasPrefix(p, dir+"/") {
+			dir = path.Dir(dir)
+		}
+	}
+	return dir
+}
+
+// FormatLong returns fi as a line of ls -l, with the fileid first when inode is set.
+func FormatLong(fi *FileInfo, human, inode bool) string {
+	size := strconv.FormatInt(fi.Size, 10)
+	if human {
+		size = helper.FormatBytes(fi.Size)
+	}
+	line := fmt.Sprintf("%s %3d %-8s %-8s %9s %s %s",
+		fi.Mode, fi.Nlink, fi.Owner, fi.Group, size, fi.Mtime.Local().Format("Jan _2 15:04 2006"), fi.Name)
+	if inode {
+		line = fmt.Sprintf("%10d %s", fi.FileID, line)
+	}
+	return line
+}
@@ -0,0 +1,96 @@
+package remote
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// rootFS is an FS whose paths are taken inside the folder root of the server,
+// it is used when --root or a profile sets one.
+type rootFS struct {
+	fs   FS
+	root string
+}
+
+// abs returns the server path of p.
+func (r *rootFS) abs(p string) string {
+	return path.Join(r.root, Clean(p))
+}
+
+// rel turns the server path of info back into a path inside the root.
+func (r *rootFS) rel(info *FileInfo) *FileInfo {
+	if info.Path == r.root || strings.HasPrefix(info.Path, r.root+"/") {
+		info.Path = Clean(strings.TrimPrefix(info.Path, r.root))
+	}
+	return info
+}
+
+func (r *rootFS) Stat(p string) (*FileInfo, error) {
+	info, err := r.fs.Stat(r.abs(p))
+	if err != nil {
+		return nil, err
+	}
+	return r.rel(info), nil
+}
+
+func (r *rootFS) ReadDir(p string) ([]*FileInfo, error) {
+	infos, err := r.fs.ReadDir(r.abs(p))
+	for _, info := range infos {
+		r.rel(info)
+	}
+	return infos, err
+}
+
+func (r *rootFS) Mkdir(p string, perm os.FileMode) error {
+	return r.fs.Mkdir(r.abs(p), perm)
+}
+
+func (r *rootFS) Remove(p string) error {
+	return r.fs.Remove(r.abs(p))
+}
+
+func (r *rootFS) RmDir(p string) error {
+	return r.fs.RmDir(r.abs(p))
+}
+
+func (r *rootFS) Rename(from, to string) error {
+	return r.fs.Rename(r.abs(from), r.abs(to))
+}
+
+func (r *rootFS) Create(p string, perm os.FileMode) error {
+	return r.fs.Create(r.abs(p), perm)
+}
+
+func (r *rootFS) SetAttr(p string, c Change) error {
+	return r.fs.SetAttr(r.abs(p), c)
+}
+
+func (r *rootFS) ReadFile(p string, offset int64, w io.Writer) (int64, error) {
+	return r.fs.ReadFile(r.abs(p), offset, w)
+}
+
+func (r *rootFS) WriteFile(p string, perm os.FileMode, rd io.Reader) (int64, error) {
+	return r.fs.WriteFile(r.abs(p), perm, rd)
+}
+
+func (r *rootFS) StatFS(p string) (*FSStat, error) {
+	return r.fs.StatFS(r.abs(p))
+}
+
+func (r *rootFS) Limits(p string) (*Limits, error) {
+	return r.fs.Limits(r.abs(p))
+}
+
+func (r *rootFS) Access(p string, mask uint32) (uint32, error) {
+	return r.fs.Access(r.abs(p), mask)
+}
+
+func (r *rootFS) Version() string {
+	return r.fs.Version()
+}
+
+func (r *rootFS) Close() error {
+	return r.fs.Close()
+}
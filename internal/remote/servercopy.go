@@ -0,0 +1,209 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/nfs4x"
+)
+
+// ErrNoServerCopy is returned when the server can not copy a file by itself,
+// the data then has to go through the client.
+var ErrNoServerCopy = errors.New("the server does not copy files by itself")
+
+// offloadPoll is how often the progress of a background copy is asked for.
+const offloadPoll = 500 * time.Millisecond
+
+// ServerCopy copies files inside one NFS v4.2 server with CLONE or COPY, so the
+// data never leaves the server. Paths are server paths, see Config.Abs.
+type ServerCopy struct {
+	client  *nfs4x.Client
+	session *nfs4x.Session
+}
+
+// DialServerCopy opens an NFS v4.2 session to the server of cfg, whatever the
+// version of cfg. It fails with ErrNoServerCopy when the server has no v4.2.
+func DialServerCopy(ctx context.Context, cfg Config) (*ServerCopy, error) {
+	conn, err := helper.DialTimeout(ctx, net.JoinHostPort(cfg.Host, cfg.Port), cfg.IOTimeout)
+	if err != nil {
+		return nil, err
+	}
+	client := nfs4x.NewClient(conn, nfs4x.Auth{MachineName: machineName(), UID: cfg.UID, GID: cfg.GID})
+	session, err := nfs4x.NewSession(client, 2)
+	if err != nil {
+		client.Close()
+		if unsupported(err) {
+			return nil, fmt.Errorf("%w: %v", ErrNoServerCopy, err)
+		}
+		return nil, err
+	}
+	return &ServerCopy{client: client, session: session}, nil
+}
+
+// Copy makes dst, which must exist, a copy of the first size bytes of src.
+// Blocks are shared with CLONE when the file system can, otherwise the server
+// copies them with COPY and progress is called with the bytes copied as the
+// copy goes on. Data that COPY did not write FILE_SYNC is committed at the end.
+// It fails with ErrNoServerCopy when the server can do neither for these files.
+func (c *ServerCopy) Copy(ctx context.Context, src, dst string, size int64, progress func(n int64)) error {
+	if size == 0 {
+		return nil
+	}
+	err := c.session.Clone(src, dst, uint64(size))
+	if err == nil {
+		progress(size)
+		return nil
+	}
+	if !unsupported(err) && nfsStatus(err) != nfs4x.ErrInval {
+		return err
+	}
+
+	var cm commit
+	for offset := uint64(0); offset < uint64(size); {
+		n, err := c.copy(ctx, src, dst, offset, uint64(size)-offset, &cm, progress)
+		if err != nil {
+			if unsupported(err) {
+				return fmt.Errorf("%w: %v", ErrNoServerCopy, err)
+			}
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("the server copied nothing at offset %d of %s", offset, src)
+		}
+		offset += n
+	}
+	if !cm.needed {
+		return nil
+	}
+	verifier, err := c.session.Commit(dst)
+	if err != nil {
+		return fmt.Errorf("committing %s: %w", dst, err)
+	}
+	if cm.verifier != nil && !bytes.Equal(verifier, cm.verifier) {
+		return restarted(src)
+	}
+	return nil
+}
+
+// commit is what the COMMIT after the copies of a file has to check.
+type commit struct {
+	needed bool
+	// verifier is the write verifier of the synchronous copies, nil when only
+	// background copies wrote the file
+	verifier []byte
+}
+
+// restarted is the error of a copy of src whose write verifier changed, the
+// server restarted and may have lost data that was not committed.
+func restarted(src string) error {
+	return fmt.Errorf("the server restarted while copying %s, the copy may be incomplete", src)
+}
+
+// add records the result of a synchronous COPY.
+func (cm *commit) add(res nfs4x.CopyResult, src string) error {
+	if res.Committed == nfs4x.FileSync {
+		return nil
+	}
+	cm.needed = true
+	if cm.verifier == nil {
+		cm.verifier = res.Verifier
+	} else if !bytes.Equal(cm.verifier, res.Verifier) {
+		return restarted(src)
+	}
+	return nil
+}
+
+// copy runs one COPY of count bytes at offset. It asks for a background copy
+// so its progress can be followed with OFFLOAD_STATUS, a server that is busy or
+// decides otherwise copies before replying. cm learns whether the data needs a
+// COMMIT, a background copy always does.
+func (c *ServerCopy) copy(ctx context.Context, src, dst string, offset, count uint64, cm *commit, progress func(n int64)) (uint64, error) {
+	res, err := c.session.Copy(src, dst, offset, count, false)
+	if nfsStatus(err) == nfs4x.ErrDelay {
+		res, err = c.session.Copy(src, dst, offset, count, true)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !res.Async {
+		if err := cm.add(res, src); err != nil {
+			return 0, err
+		}
+		progress(int64(res.Count))
+		return res.Count, nil
+	}
+	cm.needed = true
+
+	var reported uint64
+	ticker := time.NewTicker(offloadPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.session.OffloadCancel(dst, res.ID)
+			return reported, ctx.Err()
+		case <-ticker.C:
+		}
+		n, done, err := c.session.OffloadStatus(dst, res.ID)
+		if nfsStatus(err) == nfs4x.ErrBadStateID {
+			// Some servers forget a background copy as soon as it is over, the
+			// size of dst tells whether it went through
+			n, done, err = c.finished(dst, offset+count)
+			n -= offset
+		}
+		if err != nil {
+			return reported, err
+		}
+		if n > reported {
+			progress(int64(n - reported))
+			reported = n
+		}
+		if done {
+			return n, nil
+		}
+	}
+}
+
+// finished reports whether dst reached end bytes, for a background copy the
+// server no longer knows.
+func (c *ServerCopy) finished(dst string, end uint64) (uint64, bool, error) {
+	var attrs *nfs4x.Attrs
+	if err := c.session.Compound(append(nfs4x.LookupPath(dst), nfs4x.GetAttr(&attrs, nfs4x.AttrSize))...); err != nil {
+		return 0, false, err
+	}
+	if attrs.Size < end {
+		return 0, false, fmt.Errorf("the server lost track of the copy to %s at %d of %d bytes", dst, attrs.Size, end)
+	}
+	return end, true, nil
+}
+
+// Close ends the session and closes the connection.
+func (c *ServerCopy) Close() error {
+	c.session.Close()
+	return c.client.Close()
+}
+
+// nfsStatus returns the NFS v4 status of err, 0 when it has none.
+func nfsStatus(err error) uint32 {
+	var nfsErr *nfs4x.Error
+	if errors.As(err, &nfsErr) {
+		return nfsErr.Status
+	}
+	return 0
+}
+
+// unsupported reports whether err means the server does not offer the operation
+// for these files, rather than that it failed.
+func unsupported(err error) bool {
+	switch nfsStatus(err) {
+	case nfs4x.ErrNotSupp, nfs4x.ErrOpIllegal, nfs4x.ErrMinorVers, nfs4x.ErrXDev,
+		nfs4x.ErrOffloadDenied, nfs4x.ErrOffloadNoReqs:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package remote
+
+import (
+	"testing"
+
+	"github.com/kha7iq/ncp/internal/nfs4x"
+)
+
+func TestCommitAdd(t *testing.T) {
+	a, b := []byte{1, 1, 1, 1, 1, 1, 1, 1}, []byte{2, 2, 2, 2, 2, 2, 2, 2}
+	tests := []struct {
+		name    string
+		results []nfs4x.CopyResult
+		needed  bool
+		err     bool
+	}{
+		{name: "none"},
+		{
+			name:    "file sync",
+			results: []nfs4x.CopyResult{{Committed: nfs4x.FileSync, Verifier: a}, {Committed: nfs4x.FileSync, Verifier: b}},
+		},
+		{
+			name:    "unstable",
+			results: []nfs4x.CopyResult{{Committed: nfs4x.Unstable, Verifier: a}, {Committed: nfs4x.DataSync, Verifier: a}},
+			needed:  true,
+		},
+		{
+			name:    "mixed",
+			results: []nfs4x.CopyResult{{Committed: nfs4x.FileSync, Verifier: b}, {Committed: nfs4x.Unstable, Verifier: a}},
+			needed:  true,
+		},
+		{
+			name:    "restarted",
+			results: []nfs4x.CopyResult{{Committed: nfs4x.Unstable, Verifier: a}, {Committed: nfs4x.Unstable, Verifier: b}},
+			needed:  true,
+			err:     true,
+		},
+	}
+	for _, tt := range tests {
+		var cm commit
+		var err error
+		for _, res := range tt.results {
+			if err = cm.add(res, "/src"); err != nil {
+				break
+			}
+		}
+		if (err != nil) != tt.err {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.err)
+		}
+		if cm.needed != tt.needed {
+			t.Errorf("%s: needed = %v, want %v", tt.name, cm.needed, tt.needed)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/kha7iq/ncp/internal/helper"
+)
+
+// ErrNoSpace is returned by CheckSpace when an upload will not fit.
+var ErrNoSpace = errors.New("not enough free space")
+
+// CheckSpace fails with ErrNoSpace when need bytes are more than the space
+// available to the user on the file system holding dir. dir does not have to
+// exist yet, its nearest existing parent is checked. When the server can not
+// be asked, a warning is printed and the upload goes ahead.
+func CheckSpace(ctx context.Context, cfg Config, dir string, need int64) error {
+	avail, err := availableSpace(ctx, cfg, Clean(dir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to check free space on %s: %v\n", dir, err)
+		return nil
+	}
+	if uint64(need) > avail {
+		return fmt.Errorf("%w on %s: the upload needs %s but only %s is available, use --no-space-check to copy anyway",
+			ErrNoSpace, dir, helper.FormatBytes(need), helper.FormatBytes(int64(avail)))
+	}
+	return nil
+}
+
+func availableSpace(ctx context.Context, cfg Config, dir string) (uint64, error) {
+	fsys, err := Dial(ctx, cfg, dir)
+	if err != nil {
+		return 0, err
+	}
+	defer fsys.Close()
+	for {
+		_, err := fsys.Stat(dir)
+		if err == nil || !errors.Is(err, os.ErrNotExist) || dir == "/" {
+			break
+		}
+		dir = path.Dir(dir)
+	}
+	st, err := fsys.StatFS(dir)
+	if err != nil {
+		return 0, err
+	}
+	return st.AvailBytes, nil
+}
@@ -0,0 +1,503 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-nfs/nfsv3/nfs"
+	"github.com/go-nfs/nfsv3/nfs/rpc"
+	"github.com/go-nfs/nfsv3/nfs/xdr"
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/probe"
+)
+
+// v3FS is a mounted NFS v3 export.
+type v3FS struct {
+	target *nfs.Target
+	// conns start with target, file data is spread over them
+	conns  V3Conns
+	auth   rpc.Auth
+	export string
+}
+
+// dialV3 mounts the export holding target, see MountV3Conns.
+func dialV3(cfg Config, target string) (*v3FS, error) {
+	conns, export, err := MountV3Conns(cfg, target)
+	if err != nil {
+		return nil, err
+	}
+	return &v3FS{target: conns[0], conns: conns, auth: rpc.NewAuthUnix(machineName(), cfg.UID, cfg.GID).Auth(), export: export}, nil
+}
+
+// MountV3 mounts the export holding the server path target and returns it with
+// the path of the export. The export is cfg.Export when set, otherwise the
+// deepest export holding target in the export list of the server. Servers that
+// hide their export list get the deepest folder of target they agree to mount.
+// Paths below the export are found with LOOKUP, so target can be at any depth.
+func MountV3(cfg Config, target string) (*nfs.Target, string, error) {
+	target = Clean(target)
+	candidates, err := exportCandidates(cfg, target)
+	if err != nil {
+		return nil, "", err
+	}
+	var (
+		t      *nfs.Target
+		export string
+	)
+	err = helper.WithV3Timeout(cfg.IOTimeout, func() error {
+		mount, err := nfs.DialMount(cfg.Host, false)
+		if err != nil {
+			return fmt.Errorf("unable to dial MOUNT service: %w", err)
+		}
+		defer mount.Close()
+
+		auth := rpc.NewAuthUnix(machineName(), cfg.UID, cfg.GID).Auth()
+		var firstErr error
+		for _, export = range candidates {
+			if t, err = mount.Mount(export, auth); err == nil {
+				mount.Unmount()
+				return nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return fmt.Errorf("unable to mount %s: %w", target, firstErr)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return t, export, nil
+}
+
+// listExports asks the server for its exports; tests replace it.
+var listExports = probe.Exports
+
+// exportCandidates returns the folders MountV3 tries to mount for target, in order.
+func exportCandidates(cfg Config, target string) ([]string, error) {
+	if cfg.Export != "" {
+		export := Clean(cfg.Export)
+		if export != "/" && target != export && !strings.HasPrefix(target, export+"/") {
+			return nil, fmt.Errorf("%s is not inside the export %s", target, export)
+		}
+		return []string{export}, nil
+	}
+	var candidates []string
+	if exports, err := listExports(cfg.Host, cfg.IOTimeout); err == nil {
+		if e := probe.MatchExport(exports, target); e != nil {
+			candidates = append(candidates, Clean(e.Dir))
+		}
+	}
+	for dir := target; ; dir = path.Dir(dir) {
+		if len(candidates) == 0 || candidates[0] != dir {
+			candidates = append(candidates, dir)
+		}
+		if dir == "/" {
+			return candidates, nil
+		}
+	}
+}
+
+// Rel returns the server path p relative to export, "." for the export itself.
+func Rel(export, p string) string {
+	export, p = Clean(export), Clean(p)
+	if p == export {
+		return "."
+	}
+	if export == "/" {
+		return strings.TrimPrefix(p, "/")
+	}
+	return strings.TrimPrefix(p, export+"/")
+}
+
+// rel returns p relative to the mounted export.
+func (f *v3FS) rel(p string) (string, error) {
+	p = Clean(p)
+	if f.export == "/" {
+		return strings.TrimPrefix(p, "/"), nil
+	}
+	if p == f.export {
+		return ".", nil
+	}
+	if !strings.HasPrefix(p, f.export+"/") {
+		return "", fmt.Errorf("%s is outside of the mounted export %s", p, f.export)
+	}
+	return strings.TrimPrefix(p, f.export+"/"), nil
+}
+
+func (f *v3FS) Stat(p string) (*FileInfo, error) {
+	rel, err := f.rel(p)
+	if err != nil {
+		return nil, err
+	}
+	p = Clean(p)
+	if rel == "." || rel == "" {
+		attr, _, err := f.target.GetAttr(".")
+		if err != nil {
+			return nil, err
+		}
+		return v3Info(path.Base(p), p, attr), nil
+	}
+	attr, _, err := f.lookup(rel)
+	if err != nil {
+		return nil, err
+	}
+	return v3Info(path.Base(p), p, attr), nil
+}
+
+// lookup returns the attributes and the handle of rel. Unlike Target.Lookup a
+// symbolic link at the end of rel is not followed.
+func (f *v3FS) lookup(rel string) (*nfs.Fattr, []byte, error) {
+	dir, name := path.Split(rel)
+	_, dirFh, err := f.target.Lookup(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := f.call(nfs.NFSProc3Lookup, &struct {
+		What nfs.Diropargs3
+	}{nfs.Diropargs3{FH: dirFh, Filename: name}})
+	if err != nil {
+		return nil, nil, err
+	}
+	var ok struct {
+		FH      []byte
+		Attr    nfs.PostOpAttr
+		DirAttr nfs.PostOpAttr
+	}
+	if err := xdr.Read(res, &ok); err != nil {
+		return nil, nil, err
+	}
+	if !ok.Attr.IsSet {
+		attr, err := f.target.GetAttrFh(ok.FH)
+		return attr, ok.FH, err
+	}
+	return &ok.Attr.Attr, ok.FH, nil
+}
+
+// call makes an NFS v3 call with args that the library has no method for and
+// returns the result after the status.
+func (f *v3FS) call(proc uint32, args interface{}) (io.ReadSeeker, error) {
+	res, err := f.target.Call(&struct {
+		rpc.Header
+		Args interface{}
+	}{
+		Header: rpc.Header{
+			Rpcvers: 2,
+			Prog:    nfs.Nfs3Prog,
+			Vers:    nfs.Nfs3Vers,
+			Proc:    proc,
+			Cred:    f.auth,
+			Verf:    rpc.AuthNull,
+		},
+		Args: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+	status, err := xdr.ReadUint32(res)
+	if err != nil {
+		return nil, err
+	}
+	if err := nfs.NFS3Error(status); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (f *v3FS) ReadDir(p string) ([]*FileInfo, error) {
+	rel, err := f.rel(p)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := f.target.ReadDirPlus(rel)
+	if err != nil {
+		return nil, err
+	}
+	p = Clean(p)
+	infos := make([]*FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.FileName == "." || e.FileName == ".." {
+			continue
+		}
+		if !e.Attr.IsSet {
+			infos = append(infos, &FileInfo{Name: e.FileName, Path: path.Join(p, e.FileName), FileID: e.FileId})
+			continue
+		}
+		infos = append(infos, v3Info(e.FileName, path.Join(p, e.FileName), &e.Attr.Attr))
+	}
+	return infos, nil
+}
+
+func (f *v3FS) Mkdir(p string, perm os.FileMode) error {
+	rel, err := f.rel(p)
+	if err != nil {
+		return err
+	}
+	_, err = f.target.Mkdir(rel, perm)
+	return err
+}
+
+func (f *v3FS) Remove(p string) error {
+	rel, err := f.rel(p)
+	if err != nil {
+		return err
+	}
+	return f.target.Remove(rel)
+}
+
+func (f *v3FS) RmDir(p string) error {
+	rel, err := f.rel(p)
+	if err != nil {
+		return err
+	}
+	return f.target.RmDir(rel)
+}
+
+func (f *v3FS) Rename(from, to string) error {
+	relFrom, err := f.rel(from)
+	if err != nil {
+		return err
+	}
+	relTo, err := f.rel(to)
+	if err != nil {
+		return err
+	}
+	return f.target.Rename(relFrom, relTo)
+}
+
+func (f *v3FS) Create(p string, perm os.FileMode) error {
+	rel, err := f.rel(p)
+	if err != nil {
+		return err
+	}
+	dir, name := path.Split(rel)
+	_, dirFh, err := f.target.Lookup(dir)
+	if err != nil {
+		return err
+	}
+	// Target.Create is UNCHECKED and would reset the mode of an existing file
+	_, err = f.call(nfs.NFSProc3Create, &struct {
+		Where nfs.Diropargs3
+		How   uint32
+		Attr  nfs.Sattr3
+	}{
+		Where: nfs.Diropargs3{FH: dirFh, Filename: name},
+		How:   1, // GUARDED
+		Attr:  nfs.Sattr3{Mode: nfs.SetMode{SetIt: true, Mode: UnixMode(perm)}},
+	})
+	return err
+}
+
+// handle returns the file handle of rel, a symbolic link at its end is not followed.
+func (f *v3FS) handle(rel string) ([]byte, error) {
+	if rel == "." || rel == "" {
+		_, fh, err := f.target.GetAttr(".")
+		return fh, err
+	}
+	_, fh, err := f.lookup(rel)
+	return fh, err
+}
+
+func (f *v3FS) SetAttr(p string, c Change) error {
+	rel, err := f.rel(p)
+	if err != nil {
+		return err
+	}
+	fh, err := f.handle(rel)
+	if err != nil {
+		return err
+	}
+	var attr nfs.Sattr3
+	if c.Mode != nil {
+		attr.Mode = nfs.SetMode{SetIt: true, Mode: UnixMode(*c.Mode)}
+	}
+	if c.UID != nil {
+		attr.UID = nfs.SetUID{SetIt: true, UID: *c.UID}
+	}
+	if c.GID != nil {
+		attr.GID = nfs.SetUID{SetIt: true, UID: *c.GID}
+	}
+	if c.Size != nil {
+		attr.Size = nfs.SetSize{SetIt: true, Size: *c.Size}
+	}
+	attr.Atime = v3SetTime(c.Atime)
+	attr.Mtime = v3SetTime(c.Mtime)
+	return f.target.SetAttrByFh(fh, attr)
+}
+
+func (f *v3FS) ReadFile(p string, offset int64, w io.Writer) (int64, error) {
+	rel, err := f.rel(p)
+	if err != nil {
+		return 0, err
+	}
+	return f.conns.ReadFile(rel, offset, w)
+}
+
+func (f *v3FS) WriteFile(p string, perm os.FileMode, r io.Reader) (int64, error) {
+	rel, err := f.rel(p)
+	if err != nil {
+		return 0, err
+	}
+	return f.conns.WriteFile(rel, perm, r)
+}
+
+// Procedures the library has no method for, RFC 1813.
+const (
+	nfsProc3FSStat   = 18
+	nfsProc3PathConf = 20
+)
+
+func (f *v3FS) StatFS(p string) (*FSStat, error) {
+	rel, err := f.rel(p)
+	if err != nil {
+		return nil, err
+	}
+	fh, err := f.handle(rel)
+	if err != nil {
+		return nil, err
+	}
+	res, err := f.call(nfsProc3FSStat, &struct{ FH []byte }{fh})
+	if err != nil {
+		return nil, err
+	}
+	var ok struct {
+		Attr     nfs.PostOpAttr
+		TBytes   uint64
+		FBytes   uint64
+		ABytes   uint64
+		TFiles   uint64
+		FFiles   uint64
+		AFiles   uint64
+		Invarsec uint32
+	}
+	if err := xdr.Read(res, &ok); err != nil {
+		return nil, err
+	}
+	return &FSStat{
+		TotalBytes: ok.TBytes, FreeBytes: ok.FBytes, AvailBytes: ok.ABytes,
+		TotalFiles: ok.TFiles, FreeFiles: ok.FFiles, AvailFiles: ok.AFiles,
+	}, nil
+}
+
+func (f *v3FS) Limits(p string) (*Limits, error) {
+	rel, err := f.rel(p)
+	if err != nil {
+		return nil, err
+	}
+	fh, err := f.handle(rel)
+	if err != nil {
+		return nil, err
+	}
+	res, err := f.call(nfs.NFSProc3FSInfo, &struct{ FH []byte }{fh})
+	if err != nil {
+		return nil, err
+	}
+	var info nfs.FSInfo
+	if err := xdr.Read(res, &info); err != nil {
+		return nil, err
+	}
+	res, err = f.call(nfsProc3PathConf, &struct{ FH []byte }{fh})
+	if err != nil {
+		return nil, err
+	}
+	var conf struct {
+		Attr            nfs.PostOpAttr
+		LinkMax         uint32
+		NameMax         uint32
+		NoTrunc         bool
+		ChownRestricted bool
+		CaseInsensitive bool
+		CasePreserving  bool
+	}
+	if err := xdr.Read(res, &conf); err != nil {
+		return nil, err
+	}
+	return &Limits{
+		ReadMax:         uint64(info.RTMax),
+		ReadPref:        uint64(info.RTPref),
+		WriteMax:        uint64(info.WTMax),
+		WritePref:       uint64(info.WTPref),
+		DirPref:         uint64(info.DTPref),
+		MaxFileSize:     info.Size,
+		NameMax:         conf.NameMax,
+		LinkMax:         conf.LinkMax,
+		NoTrunc:         conf.NoTrunc,
+		ChownRestricted: conf.ChownRestricted,
+		CaseInsensitive: conf.CaseInsensitive,
+		CasePreserving:  conf.CasePreserving,
+	}, nil
+}
+
+func (f *v3FS) Access(p string, mask uint32) (uint32, error) {
+	rel, err := f.rel(p)
+	if err != nil {
+		return 0, err
+	}
+	fh, err := f.handle(rel)
+	if err != nil {
+		return 0, err
+	}
+	res, err := f.call(nfs.NFSProc3Access, &struct {
+		FH     []byte
+		Access uint32
+	}{fh, mask})
+	if err != nil {
+		return 0, err
+	}
+	var ok struct {
+		Attr   nfs.PostOpAttr
+		Access uint32
+	}
+	if err := xdr.Read(res, &ok); err != nil {
+		return 0, err
+	}
+	return ok.Access, nil
+}
+
+func v3SetTime(t *time.Time) nfs.SetTime {
+	switch {
+	case t == nil:
+		return nfs.SetTime{SetIt: nfs.DontChange}
+	case t.IsZero():
+		return nfs.SetTime{SetIt: nfs.SetToServerTime}
+	}
+	return nfs.SetTime{SetIt: nfs.SetToClientTime, Time: nfs.NFS3Time{
+		Seconds:  uint32(t.Unix()),
+		Nseconds: uint32(t.Nanosecond()),
+	}}
+}
+
+func (f *v3FS) Version() string {
+	return "3"
+}
+
+func (f *v3FS) Close() error {
+	return f.conns.Close()
+}
+
+func v3Info(name, p string, attr *nfs.Fattr) *FileInfo {
+	typ := fileType(attr.Type)
+	return &FileInfo{
+		Name:   name,
+		Path:   p,
+		Type:   typ,
+		Size:   int64(attr.Filesize),
+		Used:   int64(attr.Used),
+		Mode:   fileMode(typ, attr.FileMode),
+		Owner:  owner(attr.UID),
+		Group:  owner(attr.GID),
+		Nlink:  attr.Nlink,
+		FileID: attr.Fileid,
+		Atime:  v3Time(attr.Atime),
+		Mtime:  v3Time(attr.Mtime),
+		Ctime:  v3Time(attr.Ctime),
+	}
+}
+
+func v3Time(t nfs.NFS3Time) time.Time {
+	return time.Unix(int64(t.Seconds), int64(t.Nseconds))
+}
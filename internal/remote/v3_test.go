@@ -0,0 +1,60 @@
+package remote
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kha7iq/ncp/internal/probe"
+)
+
+func TestExportCandidates(t *testing.T) {
+	defer func(f func(string, time.Duration) ([]probe.Export, error)) { listExports = f }(listExports)
+
+	tests := []struct {
+		name    string
+		export  string
+		exports []probe.Export
+		fail    bool
+		target  string
+		want    []string
+		err     bool
+	}{
+		{
+			name: "export list", exports: []probe.Export{{Dir: "/srv"}, {Dir: "/srv/data"}},
+			target: "/srv/data/2023", want: []string{"/srv/data", "/srv/data/2023", "/srv", "/"},
+		},
+		{
+			name: "target is the export", exports: []probe.Export{{Dir: "/srv/data"}},
+			target: "/srv/data", want: []string{"/srv/data", "/srv", "/"},
+		},
+		{
+			name: "no matching export", exports: []probe.Export{{Dir: "/home"}},
+			target: "/srv/data", want: []string{"/srv/data", "/srv", "/"},
+		},
+		{name: "export list unavailable", fail: true, target: "/srv/data", want: []string{"/srv/data", "/srv", "/"}},
+		{name: "root", fail: true, target: "/", want: []string{"/"}},
+		{name: "given export", export: "/srv/", target: "/srv/data", want: []string{"/srv"}},
+		{name: "given root export", export: "/", target: "/srv/data", want: []string{"/"}},
+		{name: "target outside export", export: "/srv/data", target: "/srv/database", err: true},
+	}
+	for _, tt := range tests {
+		listExports = func(string, time.Duration) ([]probe.Export, error) {
+			if tt.fail {
+				return nil, errors.New("no MOUNT service")
+			}
+			return tt.exports, nil
+		}
+		got, err := exportCandidates(Config{Host: "filer", Export: tt.export}, tt.target)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: got %q, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
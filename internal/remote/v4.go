@@ -0,0 +1,216 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path"
+
+	"github.com/kha7iq/ncp/internal/helper"
+	"github.com/kha7iq/ncp/internal/nfs4x"
+)
+
+// v4FS is the pseudo file system of an NFS v4 server.
+type v4FS struct {
+	client *nfs4x.Client
+
+	ctx   context.Context
+	cfg   Config
+	files V4Conns
+}
+
+func dialV4(ctx context.Context, cfg Config) (*v4FS, error) {
+	client, err := dialV4Client(ctx, cfg, cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+	return &v4FS{client: client, ctx: ctx, cfg: cfg}, nil
+}
+
+// dialV4Client connects to the address host of the server of cfg. From NFS
+// v4.1 on every call goes through a session of the minor version of cfg.
+func dialV4Client(ctx context.Context, cfg Config, host string) (*nfs4x.Client, error) {
+	conn, err := helper.DialTimeout(ctx, net.JoinHostPort(host, cfg.Port), cfg.IOTimeout)
+	if err != nil {
+		return nil, err
+	}
+	client := nfs4x.NewClient(conn, nfs4x.Auth{MachineName: machineName(), UID: cfg.UID, GID: cfg.GID})
+	if cfg.Minor > 0 {
+		session, err := nfs4x.NewSession(client, cfg.Minor)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		client.UseSession(session)
+	}
+	return client, nil
+}
+
+// fileClient returns the connections used for file contents. Files are opened
+// with OPEN, which needs a client ID of its own, so they are only dialed once a
+// command reads or writes a file.
+func (f *v4FS) fileClient() (V4Conns, error) {
+	if f.files != nil {
+		return f.files, nil
+	}
+	files, err := DialV4Conns(f.ctx, f.cfg)
+	if err != nil {
+		return nil, err
+	}
+	f.files = files
+	return files, nil
+}
+
+func (f *v4FS) Stat(p string) (*FileInfo, error) {
+	p = Clean(p)
+	attrs, err := f.client.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	return v4Info(path.Base(p), p, attrs), nil
+}
+
+func (f *v4FS) ReadDir(p string) ([]*FileInfo, error) {
+	p = Clean(p)
+	entries, err := f.client.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*FileInfo, 0, len(entries))
+	for _, e := range entries {
+		infos = append(infos, v4Info(e.Name, path.Join(p, e.Name), e.Attrs))
+	}
+	return infos, nil
+}
+
+func (f *v4FS) Mkdir(p string, perm os.FileMode) error {
+	return f.client.Mkdir(Clean(p), UnixMode(perm))
+}
+
+func (f *v4FS) Remove(p string) error {
+	return f.client.Remove(Clean(p))
+}
+
+func (f *v4FS) RmDir(p string) error {
+	return f.client.Remove(Clean(p))
+}
+
+func (f *v4FS) Rename(from, to string) error {
+	return f.client.Rename(Clean(from), Clean(to))
+}
+
+func (f *v4FS) Create(p string, perm os.FileMode) error {
+	p = Clean(p)
+	if _, err := f.client.Stat(p); err == nil {
+		return os.ErrExist
+	}
+	files, err := f.fileClient()
+	if err != nil {
+		return err
+	}
+	file, err := files[0].Create(p, UnixMode(perm))
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func (f *v4FS) SetAttr(p string, c Change) error {
+	var attrs nfs4x.SetAttrs
+	if c.Mode != nil {
+		mode := UnixMode(*c.Mode)
+		attrs.Mode = &mode
+	}
+	if c.UID != nil {
+		// Numeric ids are accepted by servers that do not map AUTH_SYS users
+		o := owner(*c.UID)
+		attrs.Owner = &o
+	}
+	if c.GID != nil {
+		g := owner(*c.GID)
+		attrs.Group = &g
+	}
+	attrs.Size, attrs.Atime, attrs.Mtime = c.Size, c.Atime, c.Mtime
+	return f.client.SetAttr(Clean(p), attrs)
+}
+
+func (f *v4FS) ReadFile(p string, offset int64, w io.Writer) (int64, error) {
+	files, err := f.fileClient()
+	if err != nil {
+		return 0, err
+	}
+	return files.ReadFile(Clean(p), offset, w)
+}
+
+func (f *v4FS) WriteFile(p string, perm os.FileMode, r io.Reader) (int64, error) {
+	files, err := f.fileClient()
+	if err != nil {
+		return 0, err
+	}
+	// OPEN sets the mode of a new file, an existing one keeps its own
+	return files.WriteFile(Clean(p), UnixMode(perm), r)
+}
+
+func (f *v4FS) StatFS(p string) (*FSStat, error) {
+	a, err := f.client.GetAttr(Clean(p), nfs4x.FSAttrs...)
+	if err != nil {
+		return nil, err
+	}
+	return &FSStat{
+		TotalBytes: a.SpaceTotal, FreeBytes: a.SpaceFree, AvailBytes: a.SpaceAvail,
+		TotalFiles: a.FilesTotal, FreeFiles: a.FilesFree, AvailFiles: a.FilesAvail,
+	}, nil
+}
+
+func (f *v4FS) Limits(p string) (*Limits, error) {
+	a, err := f.client.GetAttr(Clean(p), nfs4x.LimitAttrs...)
+	if err != nil {
+		return nil, err
+	}
+	return &Limits{
+		ReadMax:         a.MaxRead,
+		WriteMax:        a.MaxWrite,
+		MaxFileSize:     a.MaxFileSize,
+		NameMax:         a.MaxName,
+		LinkMax:         a.MaxLink,
+		NoTrunc:         a.NoTrunc,
+		ChownRestricted: a.ChownRestricted,
+		CaseInsensitive: a.CaseInsensitive,
+		CasePreserving:  a.CasePreserving,
+	}, nil
+}
+
+func (f *v4FS) Access(p string, mask uint32) (uint32, error) {
+	return f.client.Access(Clean(p), mask)
+}
+
+func (f *v4FS) Version() string {
+	return "4"
+}
+
+func (f *v4FS) Close() error {
+	if f.files != nil {
+		f.files.Close()
+	}
+	return f.client.Close()
+}
+
+func v4Info(name, p string, attrs *nfs4x.Attrs) *FileInfo {
+	typ := fileType(attrs.Type)
+	return &FileInfo{
+		Name:   name,
+		Path:   p,
+		Type:   typ,
+		Size:   int64(attrs.Size),
+		Used:   int64(attrs.SpaceUsed),
+		Mode:   fileMode(typ, attrs.Mode),
+		Owner:  attrs.Owner,
+		Group:  attrs.Group,
+		Nlink:  attrs.NumLinks,
+		FileID: attrs.FileID,
+		Atime:  attrs.Atime,
+		Mtime:  attrs.Mtime,
+		Ctime:  attrs.Ctime,
+	}
+}
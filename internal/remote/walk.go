@@ -0,0 +1,295 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SkipDir can be returned by a WalkFunc to skip the directory it was called for.
+var SkipDir = fs.SkipDir
+
+// WalkFunc is called by Walk for every file, err is set when a directory can not
+// be read, in which case info is that directory.
+type WalkFunc func(path string, info *FileInfo, err error) error
+
+// Walk calls fn for root and everything below it, directories before their
+// contents and entries in name order. Files are reported while the tree is being
+// read, so a large tree does not have to fit in memory.
+func Walk(fsys FS, root string, fn WalkFunc) error {
+	info, err := fsys.Stat(root)
+	if err != nil {
+		return fn(Clean(root), nil, err)
+	}
+	err = walk(fsys, info, fn)
+	if err == SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walk(fsys FS, info *FileInfo, fn WalkFunc) error {
+	if err := fn(info.Path, info, nil); err != nil || !info.IsDir() {
+		return err
+	}
+	entries, err := fsys.ReadDir(info.Path)
+	if err != nil {
+		if err := fn(info.Path, info, err); err != nil && err != SkipDir {
+			return err
+		}
+		return nil
+	}
+	Sort(entries, SortName, false)
+	for _, e := range entries {
+		if err := walk(fsys, e, fn); err != nil {
+			if err == SkipDir {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Depth returns how many levels the path p, as passed to a WalkFunc, is below
+// root.
+func Depth(root, p string) int {
+	if p == root {
+		return 0
+	}
+	if root == "/" {
+		return strings.Count(p, "/")
+	}
+	return strings.Count(strings.TrimPrefix(p, root), "/")
+}
+
+// WalkParallel calls fn for root and everything below it like Walk, but reads
+// folders with one worker per FS in fss, all connected to the same server.
+// Entries are reported in no particular order, fn is never called concurrently.
+func WalkParallel(ctx context.Context, fss []FS, root string, fn WalkFunc) error {
+	info, err := fss[0].Stat(root)
+	if err != nil {
+		return fn(Clean(root), nil, err)
+	}
+
+	var (
+		mu      sync.Mutex // serializes fn and guards the state below
+		cond    = sync.NewCond(&mu)
+		queue   []*FileInfo
+		active  int
+		walkErr error
+	)
+	visit := func(info *FileInfo) {
+		err := fn(info.Path, info, nil)
+		if err == SkipDir {
+			return
+		}
+		if err != nil {
+			walkErr = err
+			return
+		}
+		if info.IsDir() {
+			queue = append(queue, info)
+		}
+	}
+	visit(info)
+
+	var wg sync.WaitGroup
+	for _, fsys := range fss {
+		wg.Add(1)
+		go func(fsys FS) {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			for {
+				for len(queue) == 0 && active > 0 && walkErr == nil {
+					cond.Wait()
+				}
+				if walkErr == nil && ctx.Err() != nil {
+					walkErr = ctx.Err()
+				}
+				if len(queue) == 0 || walkErr != nil {
+					cond.Broadcast()
+					return
+				}
+				// Taking the newest folder first keeps the queue short on wide trees
+				dir := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+				active++
+				mu.Unlock()
+				entries, err := fsys.ReadDir(dir.Path)
+				mu.Lock()
+				active--
+				if err != nil {
+					if err := fn(dir.Path, dir, err); err != nil && err != SkipDir && walkErr == nil {
+						walkErr = err
+					}
+				}
+				for _, e := range entries {
+					if walkErr != nil {
+						break
+					}
+					visit(e)
+				}
+				cond.Broadcast()
+			}
+		}(fsys)
+	}
+	wg.Wait()
+	return walkErr
+}
+
+// Sort orders accepted by Sort.
+const (
+	SortName = "name"
+	SortSize = "size"
+	SortTime = "time"
+	SortNone = "none"
+)
+
+// Sort orders infos by name, size (largest first) or modification time (newest
+// first), like ls does. SortNone keeps the order of the server.
+func Sort(infos []*FileInfo, by string, reverse bool) {
+	var less func(a, b *FileInfo) bool
+	switch by {
+	case SortSize:
+		less = func(a, b *FileInfo) bool { return a.Size > b.Size }
+	case SortTime:
+		less = func(a, b *FileInfo) bool { return a.Mtime.After(b.Mtime) }
+	case SortNone:
+		if reverse {
+			for i, j := 0, len(infos)-1; i < j; i, j = i+1, j-1 {
+				infos[i], infos[j] = infos[j], infos[i]
+			}
+		}
+		return
+	default:
+		less = func(a, b *FileInfo) bool { return a.Name < b.Name }
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		if reverse {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return a.Name < b.Name
+	})
+}
+
+// ValidSort checks a sort order given on the command line.
+func ValidSort(by string) bool {
+	switch by {
+	case SortName, SortSize, SortTime, SortNone:
+		return true
+	}
+	return false
+}
+
+// Hidden reports whether name is a dot file.
+func Hidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// MkdirAll creates the folder p along with any missing parents, like mkdir -p.
+// It reports the folders it created through created, which may be nil.
+func MkdirAll(fsys FS, p string, perm os.FileMode, created func(path string)) error {
+	p = Clean(p)
+	info, err := fsys.Stat(p)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s exists and is not a folder", p)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if parent := path.Dir(p); parent != p {
+		if err := MkdirAll(fsys, parent, perm, created); err != nil {
+			return err
+		}
+	}
+	if err := fsys.Mkdir(p, perm); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	if created != nil {
+		created(p)
+	}
+	return nil
+}
+
+// List returns root and everything below it, folders before their contents.
+func List(fsys FS, root string) ([]*FileInfo, error) {
+	var infos []*FileInfo
+	err := Walk(fsys, root, func(p string, info *FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		infos = append(infos, info)
+		return nil
+	})
+	return infos, err
+}
+
+// RemoveList removes the files and folders returned by List, contents before
+// their folder. removed is called after each one, it may be nil.
+func RemoveList(fsys FS, infos []*FileInfo, removed func(info *FileInfo)) error {
+	for i := len(infos) - 1; i >= 0; i-- {
+		info := infos[i]
+		var err error
+		if info.IsDir() {
+			err = fsys.RmDir(info.Path)
+		} else {
+			err = fsys.Remove(info.Path)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", info.Path, err)
+		}
+		if removed != nil {
+			removed(info)
+		}
+	}
+	return nil
+}
+
+// SetAttrAll changes the attributes of p, and with recursive of everything
+// below it as well. Symbolic links below p are skipped, like chmod -R does.
+// changed is called after each file, it may be nil.
+func SetAttrAll(fsys FS, p string, c Change, recursive bool, changed func(path string)) error {
+	if !recursive {
+		if err := fsys.SetAttr(p, c); err != nil {
+			return err
+		}
+		if changed != nil {
+			changed(Clean(p))
+		}
+		return nil
+	}
+	root := Clean(p)
+	return Walk(fsys, root, func(p string, info *FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		if info.Type == TypeSymlink && p != root {
+			return nil
+		}
+		if err := fsys.SetAttr(p, c); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		if changed != nil {
+			changed(p)
+		}
+		return nil
+	})
+}
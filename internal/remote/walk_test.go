@@ -0,0 +1,180 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+)
+
+// memFS is a read-only tree in memory, only Stat and ReadDir are implemented.
+type memFS struct {
+	FS
+	files map[string]*FileInfo
+	// broken folders fail to be read
+	broken map[string]bool
+	reads  int32
+}
+
+// newMemFS returns a tree holding paths, those ending with a slash are folders.
+func newMemFS(paths ...string) *memFS {
+	m := &memFS{files: map[string]*FileInfo{"/": {Name: "/", Path: "/", Type: TypeDir}}, broken: map[string]bool{}}
+	for _, p := range paths {
+		typ := TypeFile
+		if p[len(p)-1] == '/' {
+			typ = TypeDir
+		}
+		p = Clean(p)
+		m.files[p] = &FileInfo{Name: path.Base(p), Path: p, Type: typ}
+	}
+	return m
+}
+
+func (m *memFS) Stat(p string) (*FileInfo, error) {
+	info, ok := m.files[Clean(p)]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", p, os.ErrNotExist)
+	}
+	return info, nil
+}
+
+func (m *memFS) ReadDir(p string) ([]*FileInfo, error) {
+	atomic.AddInt32(&m.reads, 1)
+	if m.broken[p] {
+		return nil, errors.New("permission denied")
+	}
+	var entries []*FileInfo
+	for q, info := range m.files {
+		if q != "/" && path.Dir(q) == p {
+			entries = append(entries, info)
+		}
+	}
+	return entries, nil
+}
+
+var tree = []string{
+	"/data/", "/data/a.txt", "/data/b/", "/data/b/c.txt", "/data/b/d/", "/data/b/d/e.txt",
+	"/data/f/", "/data/f/g.txt", "/data/f/h.txt", "/other.txt",
+}
+
+func TestWalk(t *testing.T) {
+	var got []string
+	err := Walk(newMemFS(tree...), "/data", func(p string, info *FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, p)
+		if p == "/data/f" {
+			return SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Folders come before their contents, entries in name order
+	want := []string{"/data", "/data/a.txt", "/data/b", "/data/b/c.txt", "/data/b/d", "/data/b/d/e.txt", "/data/f"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk visited %q, want %q", got, want)
+	}
+}
+
+func TestWalkParallel(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		root    string
+		skip    string
+		broken  string
+		want    []string
+		failed  []string
+	}{
+		{
+			name: "one worker", workers: 1, root: "/data",
+			want: []string{"/data", "/data/a.txt", "/data/b", "/data/b/c.txt", "/data/b/d", "/data/b/d/e.txt", "/data/f", "/data/f/g.txt", "/data/f/h.txt"},
+		},
+		{
+			name: "several workers", workers: 4, root: "/",
+			want: []string{"/", "/data", "/data/a.txt", "/data/b", "/data/b/c.txt", "/data/b/d", "/data/b/d/e.txt", "/data/f", "/data/f/g.txt", "/data/f/h.txt", "/other.txt"},
+		},
+		{
+			name: "skip a folder", workers: 3, root: "/data", skip: "/data/b",
+			want: []string{"/data", "/data/a.txt", "/data/b", "/data/f", "/data/f/g.txt", "/data/f/h.txt"},
+		},
+		{
+			name: "unreadable folder", workers: 2, root: "/data", broken: "/data/f",
+			want:   []string{"/data", "/data/a.txt", "/data/b", "/data/b/c.txt", "/data/b/d", "/data/b/d/e.txt", "/data/f"},
+			failed: []string{"/data/f"},
+		},
+		{name: "file root", workers: 2, root: "/data/a.txt", want: []string{"/data/a.txt"}},
+		{name: "missing root", workers: 2, root: "/missing", failed: []string{"/missing"}},
+	}
+	for _, tt := range tests {
+		fsys := newMemFS(tree...)
+		if tt.broken != "" {
+			fsys.broken[tt.broken] = true
+		}
+		fss := make([]FS, tt.workers)
+		for i := range fss {
+			fss[i] = fsys
+		}
+		var (
+			got, failed []string
+			inside      int32
+		)
+		err := WalkParallel(context.Background(), fss, tt.root, func(p string, info *FileInfo, err error) error {
+			if atomic.AddInt32(&inside, 1) != 1 {
+				t.Errorf("%s: fn called concurrently", tt.name)
+			}
+			defer atomic.AddInt32(&inside, -1)
+			if err != nil {
+				failed = append(failed, p)
+				return nil
+			}
+			got = append(got, p)
+			if p == tt.skip {
+				return SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		// Entries come in no particular order
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(failed, tt.failed) {
+			t.Errorf("%s: visited %q and failed %q, want %q and %q", tt.name, got, failed, tt.want, tt.failed)
+		}
+	}
+}
+
+func TestWalkParallelStops(t *testing.T) {
+	stop := errors.New("enough")
+	fsys := newMemFS(tree...)
+	err := WalkParallel(context.Background(), []FS{fsys, fsys}, "/", func(p string, info *FileInfo, err error) error {
+		if p == "/data/b" {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("WalkParallel = %v, want %v", err, stop)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fsys = newMemFS(tree...)
+	err = WalkParallel(ctx, []FS{fsys, fsys}, "/", func(p string, info *FileInfo, err error) error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("WalkParallel after cancel = %v, want %v", err, context.Canceled)
+	}
+	if fsys.reads != 0 {
+		t.Errorf("%d folders read after the context was canceled", fsys.reads)
+	}
+}
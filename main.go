@@ -3,11 +3,33 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
-	"github.com/kha7iq/ncp/cmd/nfs3/from"
-	"github.com/kha7iq/ncp/cmd/nfs3/to"
-	"github.com/kha7iq/ncp/cmd/nfs4/v4from"
-	"github.com/kha7iq/ncp/cmd/nfs4/v4to"
+	"github.com/kha7iq/ncp/cmd/cat"
+	"github.com/kha7iq/ncp/cmd/chmod"
+	"github.com/kha7iq/ncp/cmd/chown"
+	"github.com/kha7iq/ncp/cmd/cp"
+	"github.com/kha7iq/ncp/cmd/df"
+	"github.com/kha7iq/ncp/cmd/doctor"
+	"github.com/kha7iq/ncp/cmd/du"
+	"github.com/kha7iq/ncp/cmd/exports"
+	"github.com/kha7iq/ncp/cmd/find"
+	"github.com/kha7iq/ncp/cmd/fsinfo"
+	"github.com/kha7iq/ncp/cmd/get"
+	"github.com/kha7iq/ncp/cmd/history"
+	"github.com/kha7iq/ncp/cmd/ls"
+	"github.com/kha7iq/ncp/cmd/mkdir"
+	"github.com/kha7iq/ncp/cmd/mv"
+	"github.com/kha7iq/ncp/cmd/ping"
+	"github.com/kha7iq/ncp/cmd/put"
+	"github.com/kha7iq/ncp/cmd/rm"
+	"github.com/kha7iq/ncp/cmd/rpcinfo"
+	"github.com/kha7iq/ncp/cmd/stat"
+	"github.com/kha7iq/ncp/cmd/tail"
+	"github.com/kha7iq/ncp/cmd/touch"
+	"github.com/kha7iq/ncp/cmd/tree"
+	"github.com/kha7iq/ncp/cmd/truncate"
+	"github.com/kha7iq/ncp/internal/config"
 	"github.com/kha7iq/ncp/internal/helper"
 	"github.com/urfave/cli/v2"
 )
@@ -40,17 +62,129 @@ func main() {
 			Value:   true,
 			EnvVars: []string{"NCP_FILENAME_TURNICATE"},
 		},
+		&cli.DurationFlag{
+			Name:    "timeout",
+			Usage:   "Maximum duration of the whole job (e.g 30m), 0 means no limit.",
+			EnvVars: []string{"NCP_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:    "io-timeout",
+			Usage:   "Maximum duration of a single RPC to the NFS server.",
+			Value:   30 * time.Second,
+			EnvVars: []string{"NCP_IO_TIMEOUT"},
+		},
+		&cli.BoolFlag{
+			Name:    "keep-partial",
+			Usage:   "Keep partially written files when a transfer is interrupted instead of removing them.",
+			EnvVars: []string{"NCP_KEEP_PARTIAL"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-space-check",
+			Usage:   "Upload without first checking that the files fit in the free space of the server.",
+			EnvVars: []string{"NCP_NO_SPACE_CHECK"},
+		},
+		&cli.IntFlag{
+			Name:    "parallel",
+			Aliases: []string{"P"},
+			Usage:   "Number of files transferred at the same time, each worker uses its own connection.",
+			Value:   1,
+			EnvVars: []string{"NCP_PARALLEL"},
+		},
+		&cli.IntFlag{
+			Name:    "nconnect",
+			Usage:   "Number of connections each worker opens to the NFS server, the reads and writes of a file are spread over them.",
+			Value:   1,
+			EnvVars: []string{"NCP_NCONNECT"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "server-ip",
+			Usage:   "Other address of the same NFS server, the connections go round --host and these. Can be repeated.",
+			EnvVars: []string{"NCP_SERVER_IP"},
+		},
+		&cli.StringFlag{
+			Name:    "progress",
+			Usage:   "Progress output: bar, plain or none. Defaults to bar on a terminal and plain otherwise.",
+			EnvVars: []string{"NCP_PROGRESS"},
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Usage:   "Output format: text, or json to write newline-delimited JSON events to stdout.",
+			Value:   "text",
+			EnvVars: []string{"NCP_OUTPUT"},
+		},
+		&cli.BoolFlag{
+			Name:    "history",
+			Usage:   "Record the job and its outcome in the local history, see 'ncp history'.",
+			EnvVars: []string{"NCP_HISTORY"},
+		},
+		&cli.StringFlag{
+			Name:    "history-file",
+			Usage:   "Path of the history file, defaults to ~/.local/share/ncp/history.jsonl.",
+			EnvVars: []string{"NCP_HISTORY_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    "bwlimit",
+			Usage:   "Bandwidth limit for the whole job, e.g 50M, or a timetable such as \"08:00,10M 18:00,off\".",
+			EnvVars: []string{"NCP_BWLIMIT"},
+		},
+		&cli.StringFlag{
+			Name:  "config",
+			Usage: "Path of the config file holding the profiles, defaults to ~/.config/ncp/config.yaml.",
+		},
+		&cli.StringFlag{
+			Name:  "profile",
+			Usage: "Profile of the config file whose settings are used for the flags not given.",
+		},
+		&cli.StringFlag{
+			Name:  "root",
+			Usage: "Folder on the NFS server that remote paths are taken from, defaults to the root of the server.",
+		},
+		&cli.StringSliceFlag{
+			Name:  "exclude",
+			Usage: "Skip the files and folders inside a transferred folder whose name matches the pattern, e.g \"*.tmp\". Can be repeated.",
+		},
+		&cli.StringFlag{
+			Name:  "verify",
+			Usage: "Verification of transferred files: sha256 to read them back and compare the sums, or none.",
+			Value: "sha256",
+		},
 	}
 	app.Version = version + " CommitSHA: " + helper.TrimSHA(commitSHA)
 	app.Usage = "provides a straightforward and efficient way to handle file transfers between the local machine and a NFS server."
 	app.Description = `NCP offers a user-friendly solution for efficiently transferring files and folders between your local machine
 and the NFS server. It enables seamless recursive upload and download operations, supporting both NFS v3 and NFS V4 protocols.`
 	app.Commands = []*cli.Command{
-		to.ToServerV3(),
-		from.FromServerV3(),
-		v4to.ToServerV4(),
-		v4from.FromServerV4(),
+		put.Alias("to", "3"),
+		get.Alias("from", "3"),
+		put.Alias("v4to", "4"),
+		get.Alias("v4from", "4"),
+		get.Get(),
+		cp.Copy(),
+		ls.ListFiles(),
+		stat.StatFiles(),
+		tree.ShowTree(),
+		find.FindFiles(),
+		du.DiskUsage(),
+		df.DiskFree(),
+		fsinfo.ShowFSInfo(),
+		exports.ShowExports(),
+		rpcinfo.ShowPrograms(),
+		ping.Ping(),
+		doctor.Doctor(),
+		mkdir.MakeDir(),
+		rm.Remove(),
+		mv.Move(),
+		chmod.ChangeMode(),
+		chown.ChangeOwner(),
+		touch.Touch(),
+		truncate.Truncate(),
+		cat.Cat(),
+		put.Put(),
+		tail.Tail(),
+		history.ShowHistory(),
 	}
+	config.AddEnvVars(app)
+	app.Before = config.Apply
 
 	err := app.Run(os.Args)
 	if err != nil {